@@ -0,0 +1,13 @@
+// Command sqlite-locking-bench tests sqlite3 locking situations, see the
+// README for its flags
+package main
+
+import (
+	"os"
+
+	"github.com/mostlygeek/go-sqlite3-locking/pkg/bench"
+)
+
+func main() {
+	os.Exit(bench.Main())
+}
@@ -0,0 +1,75 @@
+//go:build ignore
+// +build ignore
+
+// kv is an example -plugin. It registers a key/value workload and a locker
+// that only lets one op at a time through, reads included.
+//
+//	go build -buildmode=plugin -o kv.so examples/plugin/kv.go
+//	./test-sqlite -plugin kv.so -workload kv -type exclusive
+package main
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"sync"
+
+	"github.com/mostlygeek/go-sqlite3-locking/pkg/lockers"
+	"github.com/mostlygeek/go-sqlite3-locking/pkg/workloads"
+)
+
+const numKeys = 1000
+
+func init() {
+	workloads.Register("kv", func() (workloads.Workload, error) { return kv{}, nil })
+	lockers.Register("exclusive", func() lockers.Locker { return &exclusive{} })
+}
+
+// kv reads and overwrites random keys of a pluginKV table
+type kv struct{}
+
+func (kv) Setup(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, "CREATE TABLE pluginKV(k integer primary key, v integer not null)"); err != nil {
+		return err
+	}
+	for k := 0; k < numKeys; k++ {
+		if _, err := db.ExecContext(ctx, "INSERT INTO pluginKV(k, v) VALUES (?, 0)", k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (kv) ReadOp() workloads.Op {
+	s := workloads.Statement{Query: "SELECT v FROM pluginKV WHERE k=?", Args: []interface{}{rand.Intn(numKeys)}}
+	return workloads.Op{
+		Name: "get",
+		Read: true,
+		Run: func(ctx context.Context, c workloads.Conn) error {
+			return c.Query(ctx, s, nil)
+		},
+	}
+}
+
+func (kv) WriteOp() workloads.Op {
+	s := workloads.Statement{Query: "UPDATE pluginKV SET v=? WHERE k=?", Args: []interface{}{rand.Int63(), rand.Intn(numKeys)}}
+	return workloads.Op{
+		Name: "put",
+		Run: func(ctx context.Context, c workloads.Conn) error {
+			_, err := c.Exec(ctx, s)
+			return err
+		},
+	}
+}
+
+func (kv) Verify(ctx context.Context, c workloads.Conn) error {
+	return nil
+}
+
+// exclusive takes the same mutex for reads and writes
+type exclusive struct {
+	sync.Mutex
+}
+
+func (l *exclusive) RLock()   { l.Lock() }
+func (l *exclusive) RUnlock() { l.Unlock() }
@@ -0,0 +1,22 @@
+-- Example -workload-file. CREATE statements run once after the test tables
+-- are made, readers cycle through the SELECTs and writers through the rest.
+--
+-- :id is an existing testData row, :new_id a new row id and :value the value
+-- being written.
+
+CREATE TABLE IF NOT EXISTS comments(
+    id integer primary key,
+    post_id integer not null,
+    body text not null
+);
+CREATE INDEX IF NOT EXISTS comments_post ON comments(post_id);
+
+SELECT value FROM testData WHERE id = :id;
+SELECT COUNT(*) FROM comments WHERE post_id = :id;
+
+UPDATE testData SET value = :value WHERE id = :id;
+INSERT INTO comments(post_id, body) VALUES (:id, 'comment ' || :value);
+
+-- {{randint lo hi}} and {{randstring n}} bind a new random value every time
+SELECT id, body FROM comments WHERE post_id BETWEEN {{randint 1 10}} AND {{randint 5 20}};
+INSERT INTO comments(post_id, body) VALUES ({{randint 1 10}}, {{randstring 64}});
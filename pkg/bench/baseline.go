@@ -0,0 +1,139 @@
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// baseline is a result kept by -save-baseline for -check-baseline to compare
+// later runs against, stored as JSON in -baseline-dir
+type baseline struct {
+	Saved time.Time `json:"saved"`
+
+	// Args are the arguments of the run that saved it
+	Args []string `json:"args"`
+
+	Configurations []baselineConfiguration `json:"configurations"`
+}
+
+// baselineConfiguration is the mean result of one configuration, named like
+// the runs of compare and sweep, the only one of run has no name
+type baselineConfiguration struct {
+	Name       string  `json:"name"`
+	Iterations int     `json:"iterations"`
+	Ops        float64 `json:"ops_per_sec"`
+	Reads      float64 `json:"reads_per_sec"`
+	Writes     float64 `json:"writes_per_sec"`
+	WriteP99   float64 `json:"write_p99_us"`
+}
+
+func baselinePath(dir, name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid baseline name %q", name)
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+func newBaseline(results []benchmarkResult) *baseline {
+	b := &baseline{Saved: time.Now().UTC(), Args: os.Args[1:]}
+	for _, r := range results {
+		b.Configurations = append(b.Configurations, baselineConfiguration{
+			Name:       r.name,
+			Iterations: len(r.runs),
+			Ops:        r.mean(metricOps),
+			Reads:      r.mean(metricReads),
+			Writes:     r.mean(metricWrites),
+			WriteP99:   r.mean(metricP99),
+		})
+	}
+	return b
+}
+
+func (b *baseline) save(dir, name string) (string, error) {
+	path, err := baselinePath(dir, name)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return path, ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func loadBaseline(dir, name string) (*baseline, error) {
+	path, err := baselinePath(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := &baseline{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(b.Configurations) == 0 {
+		return nil, fmt.Errorf("%s has no results", path)
+	}
+	return b, nil
+}
+
+// check prints every result next to its baseline and returns false when one
+// has no baseline, its ops/sec dropped or its write p99 rose by more than
+// tolerance percent
+func (b *baseline) check(results []benchmarkResult, tolerance float64) bool {
+	saved := make(map[string]baselineConfiguration)
+	for _, c := range b.Configurations {
+		saved[c.Name] = c
+	}
+
+	fmt.Println()
+	fmt.Println()
+	fmt.Printf("Baseline of %s, tolerance %g%%\n", b.Saved.Local().Format(time.RFC3339), tolerance)
+	fmt.Println("---------------------------")
+	ok := true
+	for _, r := range results {
+		name := r.name
+		if name == "" {
+			name = "run"
+		}
+		c, found := saved[r.name]
+		if !found {
+			fmt.Printf("%-24s:  not in the baseline, FAIL\n", name)
+			ok = false
+			continue
+		}
+
+		ops, p99 := r.mean(metricOps), r.mean(metricP99)
+		verdict := "ok"
+		if ops < c.Ops*(1-tolerance/100) {
+			verdict = "FAIL, throughput dropped"
+		} else if c.WriteP99 > 0 && p99 > c.WriteP99*(1+tolerance/100) {
+			verdict = "FAIL, write p99 rose"
+		}
+		if verdict != "ok" {
+			ok = false
+		}
+		fmt.Printf("%-24s:  %.0f ops/sec (%+.1f%%), write p99 %.0fµs (%+.1f%%), %s\n",
+			name, ops, percentChange(c.Ops, ops), p99, percentChange(c.WriteP99, p99), verdict)
+	}
+	return ok
+}
+
+// percentChange returns how much now differs from was, in percent of was
+func percentChange(was, now float64) float64 {
+	if was == 0 {
+		return 0
+	}
+	return 100 * (now - was) / was
+}
@@ -0,0 +1,64 @@
+package bench
+
+import (
+	"testing"
+	"time"
+)
+
+// resultOf returns a configuration of one second long runs with the given
+// writes and write p99 each
+func resultOf(name string, writes int64, p99 time.Duration) benchmarkResult {
+	return benchmarkResult{name: name, runs: []testResult{{
+		duration: time.Second,
+		ops:      []opResult{{name: "update", ops: writes, latency: latencyStats{p99: p99}}},
+	}}}
+}
+
+func TestBaselineCheck(t *testing.T) {
+	b := newBaseline([]benchmarkResult{
+		resultOf("", 1000, time.Millisecond),
+		resultOf("no p99", 1000, 0),
+	})
+
+	tests := []struct {
+		name      string
+		result    benchmarkResult
+		tolerance float64
+		want      bool
+	}{
+		{"same", resultOf("", 1000, time.Millisecond), 0, true},
+		{"faster", resultOf("", 2000, 500*time.Microsecond), 0, true},
+		{"slower within tolerance", resultOf("", 960, time.Millisecond), 5, true},
+		{"slower", resultOf("", 940, time.Millisecond), 5, false},
+		{"p99 within tolerance", resultOf("", 1000, 1040*time.Microsecond), 5, true},
+		{"p99 rose", resultOf("", 1000, 1060*time.Microsecond), 5, false},
+		{"no baseline p99", resultOf("no p99", 1000, time.Second), 5, true},
+		{"not in baseline", resultOf("other", 1000, time.Millisecond), 5, false},
+	}
+	for _, tt := range tests {
+		if got := b.check([]benchmarkResult{tt.result}, tt.tolerance); got != tt.want {
+			t.Errorf("%s: check = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBaselineSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	saved := newBaseline([]benchmarkResult{resultOf("wal", 1000, time.Millisecond)})
+	if _, err := saved.save(dir, "main"); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadBaseline(dir, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Configurations) != 1 || loaded.Configurations[0] != saved.Configurations[0] {
+		t.Errorf("loaded %+v, want %+v", loaded.Configurations, saved.Configurations)
+	}
+
+	for _, name := range []string{"", ".", "..", "a/b", `a\b`, "missing"} {
+		if _, err := loadBaseline(dir, name); err == nil {
+			t.Errorf("loadBaseline(%q) succeeded, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// Package bench is the engine of the sqlite locking benchmark. It sets up
+// the database, runs readers and writers through a workload under a Go level
+// locker and reports what they measured. Main is the command line on top.
+package bench
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+const (
+	WRITE_CODE        = "."
+	WRITE_RETRY_CODE  = "|"
+	SELECT_CODE       = "-"
+	SELECT_RETRY_CODE = "!"
+	INSERT_CODE       = "+"
+	DELETE_CODE       = "x"
+	UPSERT_CODE       = "*"
+	RETAIN_CODE       = "~"
+	RMW_CODE          = "&"
+	INCREMENT_CODE    = "#"
+	ENQUEUE_CODE      = ">"
+	CLAIM_CODE        = "<"
+	APPEND_CODE       = "a"
+	POLL_CODE         = "?"
+	RETURNING_CODE    = "r"
+	BOX_CODE          = "b"
+	FLIP_CODE         = "%"
+	SAVEPOINT_CODE    = "s"
+	CROSS_CODE        = "@"
+
+	SNAPSHOT_START_CODE = "["
+	SNAPSHOT_END_CODE   = "]"
+	STALL_START_CODE    = "{"
+	STALL_END_CODE      = "}"
+	MAINT_START_CODE    = "("
+	MAINT_END_CODE      = ")"
+)
+
+const (
+	workloadUpdate     = "update"
+	workloadInsert     = "insert"
+	workloadUpsert     = "upsert"
+	workloadRetention  = "retention"
+	workloadRMW        = "rmw"
+	workloadCounter    = "counter"
+	workloadQueue      = "queue"
+	workloadTimeSeries = "timeseries"
+	workloadReturning  = "returning"
+	workloadSpatial    = "spatial"
+	workloadVTab       = "vtab"
+	workloadFlip       = "flip"
+	workloadSavepoint  = "savepoint"
+	workloadAttach     = "attach"
+)
+
+// driverName is the sql driver registered with the -pragma ConnectHook
+const driverName = "sqlite3_pragmas"
+
+// benchmarkResult is the results of one configuration of the benchmark
+// command, named after what set it apart from the others
+type benchmarkResult struct {
+	name string
+
+	// runs has the result of every -iterations run
+	runs []testResult
+}
+
+// benchmark registers the benchmark flags on fs, parses args with them and
+// runs the test once for every variant, every -table-form and every
+// -stmt-cache size. variants is called with no results after parsing, then
+// with the results so far every time its variants have run, until it returns
+// none. nil runs the flags as given. It returns the results of every run,
+// false when one could not be set up.
+func benchmark(fs *flag.FlagSet, args []string, variants func(done []benchmarkResult) ([]variant, error)) ([]benchmarkResult, bool) {
+	f := registerFlags(fs)
+	if !f.parse(fs, args) {
+		return nil, false
+	}
+
+	runs := []variant{{}}
+	if variants != nil {
+		var err error
+		if runs, err = variants(nil); err != nil {
+			fmt.Println(err)
+			return nil, false
+		}
+	}
+
+	if f.pluginPath != "" {
+		if err := loadPlugin(f.pluginPath); err != nil {
+			fmt.Println("Failed to load -plugin:", err)
+			return nil, false
+		}
+	}
+
+	printLegend()
+
+	r, ok := newRunner(f)
+	if !ok {
+		return nil, false
+	}
+
+	tableForms := []string{f.tableForm}
+	switch f.tableForm {
+	case formWithoutRowID, formRowID:
+	case formBoth:
+		tableForms = []string{formWithoutRowID, formRowID}
+	default:
+		fmt.Println("Invalid -table-form:", f.tableForm)
+		return nil, false
+	}
+	cacheSizes, err := parseCacheSizes(f.stmtCache)
+	if err != nil {
+		fmt.Println("Invalid -stmt-cache:", err)
+		return nil, false
+	}
+	if !f.raw && (len(cacheSizes) > 1 || cacheSizes[0] != 0) {
+		fmt.Println("-stmt-cache requires -raw")
+		return nil, false
+	}
+	if f.iterations < 1 {
+		fmt.Println("-iterations must be at least 1")
+		return nil, false
+	}
+	if f.recordFilename != "" && (variants != nil || len(tableForms)*len(cacheSizes) > 1 || f.iterations > 1) {
+		fmt.Println("-record can only record a single run, not the runs of other commands, -table-form both, several -stmt-cache sizes or -iterations")
+		return nil, false
+	}
+	if f.tolerance < 0 {
+		fmt.Println("-tolerance can not be negative")
+		return nil, false
+	}
+
+	// the baseline is loaded first, so a missing one fails before the runs
+	var checked *baseline
+	if f.checkBaseline != "" {
+		if checked, err = loadBaseline(f.baselineDir, f.checkBaseline); err != nil {
+			fmt.Println("Invalid -check-baseline:", err)
+			return nil, false
+		}
+	}
+
+	var results []benchmarkResult
+	for k := 0; k < len(runs); k++ {
+		v := runs[k]
+		for _, flag := range v.flags {
+			if err := fs.Set(flag.name, flag.value); err != nil {
+				fmt.Printf("Invalid -%s: %v\n", flag.name, err)
+				return nil, false
+			}
+		}
+		for i, form := range tableForms {
+			for j, cacheSize := range cacheSizes {
+				if k > 0 || i > 0 || j > 0 {
+					fmt.Println()
+					fmt.Println()
+				}
+				var names []string
+				if v.name != "" {
+					fmt.Println("Variant:", v.name)
+					names = append(names, v.name)
+				}
+				if len(tableForms) > 1 || form != formWithoutRowID {
+					fmt.Println("Table form:", form)
+					names = append(names, form)
+				}
+				if len(cacheSizes) > 1 {
+					fmt.Println("Statement cache size:", cacheSizeName(cacheSize))
+					names = append(names, "cache "+cacheSizeName(cacheSize))
+				}
+				br := benchmarkResult{name: strings.Join(names, " ")}
+				for n := 1; n <= f.iterations; n++ {
+					if f.iterations > 1 {
+						if n > 1 {
+							fmt.Println()
+							fmt.Println()
+						}
+						fmt.Printf("Iteration: %d of %d\n", n, f.iterations)
+					}
+					result, ok := r.run(form, cacheSize)
+					if !ok {
+						return nil, false
+					}
+					br.runs = append(br.runs, result)
+				}
+				if f.iterations > 1 {
+					br.printIterations()
+				}
+				results = append(results, br)
+			}
+		}
+		if k == len(runs)-1 && variants != nil {
+			more, err := variants(results)
+			if err != nil {
+				fmt.Println(err)
+				return nil, false
+			}
+			runs = append(runs, more...)
+		}
+	}
+
+	if len(cacheSizes) > 1 {
+		fmt.Println()
+		fmt.Println()
+		fmt.Println("Statement cache sweep")
+		fmt.Println("---------------------------")
+		for _, s := range r.cacheSweep {
+			name := cacheSizeName(s.cacheSize)
+			if len(tableForms) > 1 {
+				name = s.form + " " + name
+			}
+			fmt.Printf("%-24s:  %.0f ops/sec, %.1f%% hits\n", name, s.perSecond, s.hitRate)
+		}
+	}
+
+	if f.saveBaseline != "" {
+		path, err := newBaseline(results).save(f.baselineDir, f.saveBaseline)
+		if err != nil {
+			fmt.Println("Failed to save -save-baseline:", err)
+			return nil, false
+		}
+		fmt.Println()
+		fmt.Println("Saved baseline to", path)
+	}
+	if checked != nil && !checked.check(results, f.tolerance) {
+		fmt.Println("Regression against baseline", f.checkBaseline)
+		return nil, false
+	}
+	return results, true
+}
+
+// printLegend prints what the progress codes of a run stand for
+func printLegend() {
+	fmt.Println("Legend")
+	fmt.Println("---------------------------")
+	fmt.Println("Write       : ", WRITE_CODE)
+	fmt.Println("Write Retry : ", WRITE_RETRY_CODE)
+	fmt.Println("Read        : ", SELECT_CODE)
+	fmt.Println("Read Retry  : ", SELECT_RETRY_CODE)
+	fmt.Println("Insert      : ", INSERT_CODE)
+	fmt.Println("Delete      : ", DELETE_CODE)
+	fmt.Println("Upsert      : ", UPSERT_CODE)
+	fmt.Println("Retain      : ", RETAIN_CODE)
+	fmt.Println("Read/Write  : ", RMW_CODE)
+	fmt.Println("Increment   : ", INCREMENT_CODE)
+	fmt.Println("Enqueue     : ", ENQUEUE_CODE)
+	fmt.Println("Claim       : ", CLAIM_CODE)
+	fmt.Println("Append      : ", APPEND_CODE)
+	fmt.Println("Poll        : ", POLL_CODE)
+	fmt.Println("Returning   : ", RETURNING_CODE)
+	fmt.Println("Box         : ", BOX_CODE)
+	fmt.Println("Flip        : ", FLIP_CODE)
+	fmt.Println("Savepoint   : ", SAVEPOINT_CODE)
+	fmt.Println("Cross DB    : ", CROSS_CODE)
+	fmt.Println("Snapshot    : ", SNAPSHOT_START_CODE+" "+SNAPSHOT_END_CODE)
+	fmt.Println("Stall       : ", STALL_START_CODE+" "+STALL_END_CODE)
+	fmt.Println("Maintenance : ", MAINT_START_CODE+" "+MAINT_END_CODE)
+	fmt.Println()
+}
@@ -0,0 +1,186 @@
+package bench
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mostlygeek/go-sqlite3-locking/pkg/lockers"
+	"github.com/mostlygeek/go-sqlite3-locking/pkg/workloads"
+)
+
+// Benchmark runs readers and writers against a database the caller opened,
+// the engine behind Main without its flags. Make one with New.
+type Benchmark struct {
+	db       *sql.DB
+	writers  int
+	readers  int
+	rows     int
+	updates  int
+	out      io.Writer
+	locker   lockers.Locker
+	workload workloads.Workload
+	duration time.Duration
+}
+
+// Option configures a Benchmark made by New
+type Option func(*Benchmark)
+
+// WithWriters sets the number of parallel writers, 2 by default
+func WithWriters(n int) Option {
+	return func(b *Benchmark) { b.writers = n }
+}
+
+// WithReaders sets the number of parallel readers, 2 by default
+func WithReaders(n int) Option {
+	return func(b *Benchmark) { b.readers = n }
+}
+
+// WithRows sets the number of rows the built in workload updates and reads,
+// 10 by default, fewer rows mean more contention
+func WithRows(n int) Option {
+	return func(b *Benchmark) { b.rows = n }
+}
+
+// WithUpdates sets the number of updates the writers make before the run
+// ends, 500 by default
+func WithUpdates(n int) Option {
+	return func(b *Benchmark) { b.updates = n }
+}
+
+// WithOutput prints the progress codes of the run to w, by default or when
+// w is nil they are discarded
+func WithOutput(w io.Writer) Option {
+	return func(b *Benchmark) {
+		b.out = w
+		if w == nil {
+			b.out = io.Discard
+		}
+	}
+}
+
+// WithLocker sets the Go level lock taken around every op, lockers.None by
+// default
+func WithLocker(l lockers.Locker) Option {
+	return func(b *Benchmark) { b.locker = l }
+}
+
+// WithWorkload runs w instead of the built in update workload. Its Setup is
+// called by Run.
+func WithWorkload(w workloads.Workload) Option {
+	return func(b *Benchmark) { b.workload = w }
+}
+
+// WithDuration runs readers and writers for d instead of until the writers
+// made WithUpdates updates
+func WithDuration(d time.Duration) Option {
+	return func(b *Benchmark) { b.duration = d }
+}
+
+// New returns a Benchmark of db with the same defaults as the command line
+func New(db *sql.DB, opts ...Option) *Benchmark {
+	b := &Benchmark{
+		db:      db,
+		writers: 2,
+		readers: 2,
+		rows:    10,
+		updates: 500,
+		out:     io.Discard,
+		locker:  lockers.None{},
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Result is what a Benchmark measured
+type Result struct {
+	Duration time.Duration
+
+	// Ops are the counts and latencies of every kind of op that ran
+	Ops []OpResult
+}
+
+// OpResult is how often one kind of op ran and how long it took, from asking
+// for the lock until it succeeded, retries included
+type OpResult struct {
+	Name      string
+	Read      bool
+	Ops       int64
+	Retries   int64
+	PerSecond float64
+
+	Avg, P50, P99, Max time.Duration
+}
+
+// Run sets up the workload and runs it. Progress is printed to the
+// WithOutput writer like Main prints it to stdout.
+func (b *Benchmark) Run() (Result, error) {
+	if b.writers < 0 || b.readers < 0 {
+		return Result{}, fmt.Errorf("readers and writers can not be negative")
+	}
+	if b.rows < 1 {
+		return Result{}, fmt.Errorf("rows must be at least 1")
+	}
+	if b.updates < 0 {
+		return Result{}, fmt.Errorf("updates can not be negative")
+	}
+
+	tableSchema, err := newSchema(schemaSimple, 0, false)
+	if err != nil {
+		return Result{}, err
+	}
+	config := testConfig{
+		writerCount:  b.writers,
+		readerCount:  b.readers,
+		numRows:      b.rows,
+		numUpdates:   b.updates,
+		duration:     b.duration,
+		out:          b.out,
+		readerMix:    singleOp(opRead),
+		writerMix:    singleOp(opUpdate),
+		distribution: distUniform,
+		schema:       tableSchema,
+		txSize:       1,
+		batch:        1,
+		retryPolicy:  retryBusy,
+	}
+
+	config.workload = b.workload
+	if config.workload == nil {
+		if config.workload, err = newMixWorkload(config); err != nil {
+			return Result{}, err
+		}
+	}
+	if err := config.workload.Setup(context.Background(), b.db); err != nil {
+		return Result{}, fmt.Errorf("workload setup, %v", err)
+	}
+
+	result, err := runTest(sqlWorkers(b.db, b.db, false, false), config, b.locker)
+	if err != nil {
+		return Result{}, err
+	}
+	return result.export(), nil
+}
+
+// export copies what the caller of Run can see
+func (r testResult) export() Result {
+	res := Result{Duration: r.duration}
+	for _, op := range r.ops {
+		res.Ops = append(res.Ops, OpResult{
+			Name:      op.name,
+			Read:      op.read,
+			Ops:       op.ops,
+			Retries:   op.retries,
+			PerSecond: r.perSecond(op.ops),
+			Avg:       op.latency.avg,
+			P50:       op.latency.p50,
+			P99:       op.latency.p99,
+			Max:       op.latency.max,
+		})
+	}
+	return res
+}
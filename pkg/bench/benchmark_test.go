@@ -0,0 +1,74 @@
+package bench_test
+
+import (
+	"bytes"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mostlygeek/go-sqlite3-locking/pkg/bench"
+)
+
+func openTemp(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestBenchmarkRun(t *testing.T) {
+	var out bytes.Buffer
+	result, err := bench.New(openTemp(t),
+		bench.WithWriters(2),
+		bench.WithReaders(2),
+		bench.WithRows(5),
+		bench.WithUpdates(50),
+		bench.WithLocker(&sync.RWMutex{}),
+		bench.WithOutput(&out),
+	).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Duration <= 0 {
+		t.Errorf("Duration = %v, want > 0", result.Duration)
+	}
+
+	var updates int64
+	for _, op := range result.Ops {
+		if !op.Read {
+			updates += op.Ops
+		}
+	}
+	if updates != 50 {
+		t.Errorf("updates = %d, want 50", updates)
+	}
+	if n := strings.Count(out.String(), bench.WRITE_CODE); n < 50 {
+		t.Errorf("output has %d write codes, want at least 50", n)
+	}
+}
+
+func TestBenchmarkRunInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []bench.Option
+	}{
+		{"negative writers", []bench.Option{bench.WithWriters(-1)}},
+		{"negative readers", []bench.Option{bench.WithReaders(-1)}},
+		{"no rows", []bench.Option{bench.WithRows(0)}},
+		{"negative updates", []bench.Option{bench.WithUpdates(-1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := bench.New(openTemp(t), tt.opts...).Run(); err == nil {
+				t.Error("Run succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package bench
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sync/atomic"
+
+	"github.com/mostlygeek/go-sqlite3-locking/pkg/workloads"
+)
+
+// mixWorkload is the built in workloads.Workload: readers and writers pick ops
+// from their -workload or -mix and run them against the test schema
+type mixWorkload struct {
+	config testConfig
+	keys   *keySpace
+
+	// increments counts every successful increment, warm up included, since
+	// they all end up in the counters checked by Verify
+	increments int64
+}
+
+func newMixWorkload(config testConfig) (*mixWorkload, error) {
+	keys, err := newKeySpace(config.numRows, config.distribution)
+	if err != nil {
+		return nil, err
+	}
+	keys.hotRow = config.hotRow
+	return &mixWorkload{config: config, keys: keys}, nil
+}
+
+// Setup creates and fills the test tables, then the -workload-file ones
+func (m *mixWorkload) Setup(ctx context.Context, db *sql.DB) error {
+	if err := m.config.schema.create(db); err != nil {
+		return fmt.Errorf("failed to create database, %v", err)
+	}
+	if err := m.config.schema.fill(db, m.config.numRows); err != nil {
+		return fmt.Errorf("failed to fill database, %v", err)
+	}
+	if m.config.file != nil {
+		if err := m.config.file.create(db); err != nil {
+			return fmt.Errorf("failed to create -workload-file tables, %v", err)
+		}
+	}
+	return nil
+}
+
+func (m *mixWorkload) ReadOp() workloads.Op {
+	return m.op(m.config.readerMix.pick())
+}
+
+func (m *mixWorkload) WriteOp() workloads.Op {
+	return m.op(m.config.writerMix.pick())
+}
+
+// op wraps op with a random value to write, the same value is used for every
+// attempt
+func (m *mixWorkload) op(op opType) workloads.Op {
+	val := random.Intn(int(math.MaxUint32))
+	return workloads.Op{
+		Name: op.String(),
+		Read: op.isRead(),
+		Code: op.code(),
+		Run: func(ctx context.Context, c workloads.Conn) error {
+			err := m.config.runOp(ctx, asWorker(c), op, val, m.keys)
+			if err == nil && op == opIncrement {
+				atomic.AddInt64(&m.increments, int64(m.config.txSize))
+			}
+			return err
+		},
+	}
+}
+
+// Verify checks the rows hold the last values written with -verify, that no
+// -versions update was lost or went uncounted, and the counters add up when
+// the counter workload ran on its own
+func (m *mixWorkload) Verify(ctx context.Context, c workloads.Conn) error {
+	if m.config.versions != nil {
+		updates, err := m.config.versions.verify(ctx, asWorker(c))
+		if err != nil {
+			return err
+		}
+		fmt.Println()
+		fmt.Println()
+		fmt.Println("Version check passed, updates checked:", updates)
+	}
+
+	if m.config.state != nil {
+		if err := m.config.state.verify(ctx, asWorker(c)); err != nil {
+			return err
+		}
+		fmt.Println()
+		fmt.Println()
+		fmt.Println("Consistency check passed, rows checked:", m.config.state.len())
+	}
+
+	increments := atomic.LoadInt64(&m.increments)
+
+	// counters can only be checked when nothing else changes the values
+	if increments == 0 || !m.config.readerMix.only(opRead, opIncrement) || !m.config.writerMix.only(opRead, opIncrement) {
+		return nil
+	}
+	if err := verifyCounters(ctx, asWorker(c), m.config.schema, increments); err != nil {
+		return err
+	}
+	fmt.Println()
+	fmt.Println()
+	fmt.Println("Counter check passed, total:", increments)
+	return nil
+}
@@ -0,0 +1,136 @@
+package bench
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+// capacityMargin is how far short of its offered write rate a run may fall
+// and still count as keeping up
+const capacityMargin = 0.95
+
+// capacityStep is one run of a capacity search
+type capacityStep struct {
+	// rate is the offered write rate, 0 for the flat out run
+	rate int
+
+	writes float64
+	p99    time.Duration
+	ok     bool
+}
+
+// capacitySearch binary searches the offered write rate for the highest one
+// the writers keep up with while their p99, from when each write was due,
+// stays under target. The first run is flat out and bounds the search.
+type capacitySearch struct {
+	target time.Duration
+	steps  int
+
+	// lo is the highest rate that kept up and hi the lowest that did not
+	lo, hi int
+	rate   int
+	runs   []capacityStep
+}
+
+// next is the variants func of benchmark, returning the next rate to try
+// until the search narrowed down to 5% or ran out of steps
+func (s *capacitySearch) next(done []benchmarkResult) ([]variant, error) {
+	if done == nil {
+		if s.target <= 0 {
+			return nil, fmt.Errorf("-target-p99 must be more than 0")
+		}
+		return []variant{{name: "flat out", flags: []flagValue{{"write-rate", "0"}}}}, nil
+	}
+
+	// with -iterations the step is the mean of the runs
+	last := done[len(done)-1]
+	step := capacityStep{rate: s.rate, writes: last.mean(metricWrites)}
+	for _, r := range last.runs {
+		step.p99 += writeLatency(r) / time.Duration(len(last.runs))
+	}
+	step.ok = step.p99 <= s.target && step.writes >= capacityMargin*float64(s.rate)
+	s.runs = append(s.runs, step)
+
+	switch {
+	case s.rate == 0 && step.ok:
+		// even flat out the writers stay under the target
+		return nil, nil
+	case s.rate == 0:
+		s.hi = int(step.writes)
+	case step.ok:
+		s.lo = s.rate
+	default:
+		s.hi = s.rate
+	}
+	if len(s.runs) > s.steps || s.hi-s.lo <= s.hi/20 {
+		return nil, nil
+	}
+	s.rate = (s.lo + s.hi) / 2
+	if s.rate < 1 {
+		return nil, nil
+	}
+	// the bucket holds every token, so writes stay due on schedule
+	// however far behind the writers fall
+	return []variant{{
+		name:  fmt.Sprintf("%d writes/sec", s.rate),
+		flags: []flagValue{{"write-rate", fmt.Sprint(s.rate)}, {"write-burst", "0"}},
+	}}, nil
+}
+
+// writeLatency is the worst p99 of the write ops, from when they were due
+// when they were paced
+func writeLatency(r testResult) time.Duration {
+	var p99 time.Duration
+	for _, op := range r.ops {
+		if op.read {
+			continue
+		}
+		d := op.latency.p99
+		if op.intendedOps > 0 {
+			d = op.intended.p99
+		}
+		if d > p99 {
+			p99 = d
+		}
+	}
+	return p99
+}
+
+func (s *capacitySearch) print() {
+	fmt.Println()
+	fmt.Println()
+	fmt.Println("Capacity search, write p99 target", s.target)
+	fmt.Println("---------------------------")
+	var capacity *capacityStep
+	for i, step := range s.runs {
+		offered := "flat out"
+		if step.rate > 0 {
+			offered = fmt.Sprint(step.rate, "/sec")
+		}
+		verdict := "over"
+		if step.ok {
+			verdict = "kept up"
+			if capacity == nil || step.writes > capacity.writes {
+				capacity = &s.runs[i]
+			}
+		}
+		fmt.Printf("%-16s:  writes %.0f/sec, write p99 %s, %s\n", offered, step.writes, step.p99.Round(time.Microsecond), verdict)
+	}
+	if capacity == nil {
+		fmt.Println("Capacity: none, no write rate tried kept the write p99 under", s.target)
+		return
+	}
+	fmt.Printf("Capacity: %.0f writes/sec\n", capacity.writes)
+}
+
+func capacityCommand(fs *flag.FlagSet, args []string) bool {
+	search := &capacitySearch{}
+	fs.DurationVar(&search.target, "target-p99", 10*time.Millisecond, "Highest write p99, from when each write was due, a write rate may have")
+	fs.IntVar(&search.steps, "steps", 8, "Most paced runs after the flat out one")
+	if _, ok := benchmark(fs, args, search.next); !ok {
+		return false
+	}
+	search.print()
+	return true
+}
@@ -0,0 +1,130 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// checkpoint modes of -checkpoint-mode, see PRAGMA wal_checkpoint
+const (
+	checkpointPassive  = "passive"
+	checkpointFull     = "full"
+	checkpointRestart  = "restart"
+	checkpointTruncate = "truncate"
+)
+
+// checkpointer runs PRAGMA wal_checkpoint every interval for
+// -checkpoint-interval and measures every checkpoint, along with the reads
+// and writes that overlapped one
+type checkpointer struct {
+	interval time.Duration
+	mode     string
+
+	// seq goes up when a checkpoint starts and again when it ends, it is odd
+	// while one runs
+	seq int64
+
+	mu                sync.Mutex
+	checkpoints, busy int64
+	frames, copied    int64
+	latency           latencies
+	reads, writes     latencies
+}
+
+// begin is called when an op starts, overlapped tells from what it returns
+// whether a checkpoint ran during the op
+func (c *checkpointer) begin() int64 {
+	return atomic.LoadInt64(&c.seq)
+}
+
+// overlapped is true when a checkpoint ran at some point since begin
+// returned seq
+func (c *checkpointer) overlapped(seq int64) bool {
+	return seq%2 == 1 || atomic.LoadInt64(&c.seq) != seq
+}
+
+// add records the latency of an op that overlapped a checkpoint
+func (c *checkpointer) add(read bool, took time.Duration) {
+	if read {
+		c.reads.add(took)
+	} else {
+		c.writes.add(took)
+	}
+}
+
+// checkpoint runs a single checkpoint through w
+func (c *checkpointer) checkpoint(ctx context.Context, w worker) error {
+	atomic.AddInt64(&c.seq, 1)
+	defer atomic.AddInt64(&c.seq, 1)
+
+	start := time.Now()
+	var busy, frames, copied int64
+	query := fmt.Sprintf("PRAGMA wal_checkpoint(%s)", strings.ToUpper(c.mode))
+	err := w.query(ctx, statement{query: query}, func(row []interface{}) error {
+		busy, _ = row[0].(int64)
+		frames, _ = row[1].(int64)
+		copied, _ = row[2].(int64)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	c.latency.add(time.Since(start))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkpoints++
+	c.busy += busy
+	c.frames += frames
+	c.copied += copied
+	return nil
+}
+
+// reset forgets the checkpoints so far, like the ones during the warm up
+func (c *checkpointer) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkpoints, c.busy, c.frames, c.copied = 0, 0, 0, 0
+	c.latency.reset()
+	c.reads.reset()
+	c.writes.reset()
+}
+
+// checkpointResult is what the checkpoints of one run took and did to the
+// ops running alongside them
+type checkpointResult struct {
+	mode              string
+	checkpoints, busy int64
+	frames, copied    int64
+	latency           latencyStats
+	readOps, writeOps int
+	reads, writes     latencyStats
+}
+
+func (c *checkpointer) result() checkpointResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return checkpointResult{
+		mode:        c.mode,
+		checkpoints: c.checkpoints,
+		busy:        c.busy,
+		frames:      c.frames,
+		copied:      c.copied,
+		latency:     c.latency.stats(),
+		readOps:     c.reads.count(),
+		writeOps:    c.writes.count(),
+		reads:       c.reads.stats(),
+		writes:      c.writes.stats(),
+	}
+}
+
+func (r checkpointResult) print() {
+	fmt.Printf("Checkpoints (%s): %d, %s, %d blocked, %d of %d WAL frames copied\n",
+		r.mode, r.checkpoints, r.latency, r.busy, r.copied, r.frames)
+	fmt.Printf("  reads during checkpoints:  %d, %s\n", r.readOps, r.reads)
+	fmt.Printf("  writes during checkpoints: %d, %s\n", r.writeOps, r.writes)
+}
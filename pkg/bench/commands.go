@@ -0,0 +1,283 @@
+package bench
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// command is one subcommand of the command line, with its own flags
+type command struct {
+	name    string
+	summary string
+
+	// run parses args with fs and runs the command, false means it failed
+	// and said why
+	run func(fs *flag.FlagSet, args []string) bool
+}
+
+// commands are the subcommands, run is the default when the first argument
+// is a flag
+var commands = []command{
+	{"run", "Run the benchmark once, the default command", runCommand},
+	{"compare", "Run the same seeded benchmark under every -types locker in every -journal-modes and rank them", compareCommand},
+	{"sweep", "Run the benchmark for every one of -values of the -param flag", sweepCommand},
+	{"capacity", "Search for the highest write rate whose write p99 stays under -target-p99", capacityCommand},
+	{"report", "Summarise the ops of a -record file", reportCommand},
+	{"verify", "Check the integrity of databases kept with -keep", verifyCommand},
+}
+
+// journalWAL and journalRollback are the journal modes compare runs in,
+// -wal and without it
+const (
+	journalWAL      = "wal"
+	journalRollback = "rollback"
+)
+
+// sweepFixed are the flags read once for all runs, so sweep can not vary them
+var sweepFixed = []string{"plugin", "udf", "collation", "table-form", "stmt-cache", "record", "replay", "save-baseline", "check-baseline", "baseline-dir", "tolerance"}
+
+// variant is one set of flag values a run is made with, on top of the ones
+// given on the command line
+type variant struct {
+	name  string
+	flags []flagValue
+}
+
+type flagValue struct {
+	name, value string
+}
+
+// Main runs the command line benchmark. The first argument picks the command
+// and takes the remaining ones as its flags, without one it is run. It
+// returns the exit code: 0 when the command succeeded, 1 when it failed and 2
+// for an unknown command.
+func Main() int {
+	name, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	for _, c := range commands {
+		if c.name == name {
+			fs := flag.NewFlagSet(os.Args[0]+" "+c.name, flag.ExitOnError)
+			if !c.run(fs, args) {
+				return 1
+			}
+			return 0
+		}
+	}
+	fmt.Println("Unknown command:", name)
+	fmt.Println()
+	fmt.Println("Commands, -h after one lists its flags:")
+	for _, c := range commands {
+		fmt.Printf("  %-8s  %s\n", c.name, c.summary)
+	}
+	return 2
+}
+
+func runCommand(fs *flag.FlagSet, args []string) bool {
+	_, ok := benchmark(fs, args, nil)
+	return ok
+}
+
+func compareCommand(fs *flag.FlagSet, args []string) bool {
+	types := fs.String("types", "none,mutex,rwmutex,channel", "Comma separated -type lockers to run the benchmark under")
+	journalModes := fs.String("journal-modes", "wal,rollback", "Comma separated journal modes to run every -types locker in: [wal, rollback]")
+	alpha := fs.Float64("alpha", 0.05, "Significance level of the Mann-Whitney test of every run against the best, with -iterations")
+	results, ok := benchmark(fs, args, func(done []benchmarkResult) ([]variant, error) {
+		if done != nil {
+			return nil, nil
+		}
+		if *alpha <= 0 || *alpha >= 1 {
+			return nil, fmt.Errorf("-alpha must be between 0 and 1")
+		}
+
+		// the final states of the replays are checked for equivalence, which
+		// only holds when one writer applies the writes in recorded order
+		if fs.Lookup("replay").Value.String() != "" && fs.Lookup("writers").Value.String() != "1" {
+			return nil, fmt.Errorf("compare -replay needs -writers 1, more writers apply the replayed writes to a row in any order")
+		}
+
+		// every run gets the same seed, so they all run the same ops on
+		// the same rows
+		seed := fs.Lookup("seed").Value.String()
+		if seed == "0" {
+			seed = fmt.Sprint(time.Now().UnixNano())
+		}
+
+		var runs []variant
+		for _, t := range strings.Split(*types, ",") {
+			t = strings.TrimSpace(t)
+			for _, mode := range strings.Split(*journalModes, ",") {
+				mode = strings.TrimSpace(mode)
+				if mode != journalWAL && mode != journalRollback {
+					return nil, fmt.Errorf("invalid -journal-modes, %q is not one of [%s, %s]", mode, journalWAL, journalRollback)
+				}
+				runs = append(runs, variant{
+					name:  t + " " + mode,
+					flags: []flagValue{{"type", t}, {"wal", fmt.Sprint(mode == journalWAL)}, {"seed", seed}},
+				})
+			}
+		}
+		return runs, nil
+	})
+	if !ok {
+		return false
+	}
+	printRanking(results, *alpha)
+	return checkEquivalence(results)
+}
+
+func sweepCommand(fs *flag.FlagSet, args []string) bool {
+	param := fs.String("param", "writers", "Flag to vary, any benchmark flag but -"+strings.Join(sweepFixed, ", -"))
+	values := fs.String("values", "1,2,4,8", "Comma separated values of -param, one run each. lo..hi doubles from lo up to hi, ie: 1..32")
+	param2 := fs.String("param2", "", "Second flag to vary, every -values2 runs with every -values")
+	values2 := fs.String("values2", "", "Comma separated values of -param2, lo..hi doubles from lo up to hi")
+	csvFilename := fs.String("csv", "", "Write the -metric of every run to this file as a CSV matrix, -values down and -values2 across, - for stdout")
+	metric := fs.String("metric", metricOps, "What -csv holds: [ops, reads, writes] per second or [p99] write latency in microseconds")
+
+	var grid *sweepGrid
+	results, ok := benchmark(fs, args, func(done []benchmarkResult) ([]variant, error) {
+		if done != nil {
+			return nil, nil
+		}
+		switch *metric {
+		case metricOps, metricReads, metricWrites, metricP99:
+		default:
+			return nil, fmt.Errorf("invalid -metric %q", *metric)
+		}
+		var err error
+		grid, err = newSweepGrid(fs, *param, *values, *param2, *values2)
+		if err != nil {
+			return nil, err
+		}
+		return grid.variants(), nil
+	})
+	if !ok {
+		return false
+	}
+	printComparison("Sweep of -"+grid.name(), results)
+	if *csvFilename != "" {
+		if len(results) != len(grid.rows)*len(grid.columns) {
+			fmt.Println("-csv needs one run per cell, not -table-form both or several -stmt-cache sizes")
+			return false
+		}
+		if err := grid.writeCSV(*csvFilename, *metric, results); err != nil {
+			fmt.Println("Failed to write -csv file,", err)
+			return false
+		}
+	}
+	return true
+}
+
+func reportCommand(fs *flag.FlagSet, args []string) bool {
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of %s: FILE...\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return false
+	}
+	for i, path := range fs.Args() {
+		if i > 0 {
+			fmt.Println()
+		}
+		r, err := loadRecording(path)
+		if err != nil {
+			fmt.Println("Invalid -record file:", err)
+			return false
+		}
+		fmt.Println("Recording:", path)
+		r.report()
+	}
+	return true
+}
+
+func verifyCommand(fs *flag.FlagSet, args []string) bool {
+	digest := fs.Bool("digest", false, "Also print the digest of testData that -replay prints, to compare databases")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of %s: [flags] FILE...\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return false
+	}
+	ok := true
+	for i, path := range fs.Args() {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Println("Database:", path)
+		if err := verifyDatabase(path, *digest); err != nil {
+			fmt.Println(err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// meanP99 returns the mean worst write p99 of the runs of r
+func meanP99(r benchmarkResult) time.Duration {
+	return time.Duration(r.mean(metricP99) * float64(time.Microsecond)).Round(time.Microsecond)
+}
+
+// printRanking prints the results from the highest throughput, reads and
+// writes together, to the lowest, with how they compare to the best. With
+// -iterations they are the means of the runs, and a Mann-Whitney test of
+// their ops/sec against those of the best says whether the difference is
+// significant at alpha or could be noise.
+func printRanking(results []benchmarkResult, alpha float64) {
+	ranked := append([]benchmarkResult(nil), results...)
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].mean(metricOps) > ranked[j].mean(metricOps) })
+
+	fmt.Println()
+	fmt.Println()
+	fmt.Println("Ranking")
+	fmt.Println("---------------------------")
+	for i, r := range ranked {
+		best := 0.0
+		if top := ranked[0].mean(metricOps); top > 0 {
+			best = 100 * r.mean(metricOps) / top
+		}
+		fmt.Printf("%2d. %-24s:  %.0f ops/sec (%.0f%% of best), reads %.0f/sec, writes %.0f/sec, write p99 %s%s\n",
+			i+1, r.name, r.mean(metricOps), best, r.mean(metricReads), r.mean(metricWrites), meanP99(r), significance(ranked[0], r, alpha))
+	}
+	if n := len(ranked[0].runs); len(ranked) > 1 && n > 1 {
+		if least := exactU(n, n, 0); least >= alpha {
+			fmt.Printf("With %d -iterations p is at least %.3f, no difference can be significant at %g\n", n, least, alpha)
+		}
+	}
+}
+
+// significance returns how r compares to the best run, nothing for the best
+// itself or without -iterations
+func significance(best, r benchmarkResult, alpha float64) string {
+	if len(r.runs) < 2 || r.name == best.name {
+		return ""
+	}
+	p := mannWhitney(best.samples(metricOps), r.samples(metricOps))
+	if p < alpha {
+		return fmt.Sprintf(", p %.3f, significant", p)
+	}
+	return fmt.Sprintf(", p %.3f, not significant", p)
+}
+
+// printComparison prints the throughput and worst write p99 of every result
+// side by side
+func printComparison(title string, results []benchmarkResult) {
+	fmt.Println()
+	fmt.Println()
+	fmt.Println(title)
+	fmt.Println("---------------------------")
+	for _, r := range results {
+		fmt.Printf("%-24s:  reads %.0f/sec, writes %.0f/sec, write p99 %s\n",
+			r.name, r.mean(metricReads), r.mean(metricWrites), meanP99(r))
+	}
+}
@@ -0,0 +1,131 @@
+package bench
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// cpuWindow is the shortest time a CPU peak is measured over, shorter
+// windows mostly measure scheduler noise
+const cpuWindow = 500 * time.Millisecond
+
+// cpuSampler measures the CPU used by this process and the whole system
+// during a run, a configuration that is faster because it spins on retries
+// burns more CPU for it
+type cpuSampler struct {
+	mu sync.Mutex
+
+	// start and last are the counters at reset and at the last window
+	start, last cpuCounters
+
+	peakProcess, peakSystem float64
+}
+
+// cpuCounters are the CPU counters at one point in time
+type cpuCounters struct {
+	at                 time.Time
+	process            time.Duration
+	systemBusy, system time.Duration
+}
+
+func readCPU() (cpuCounters, error) {
+	c := cpuCounters{at: time.Now()}
+	var err error
+	if c.process, err = processCPU(); err != nil {
+		return c, err
+	}
+	c.systemBusy, c.system, err = systemCPU()
+	return c, err
+}
+
+// usage returns the CPU used from c to to, the process in percent of one CPU
+// and the system in percent of all of them
+func (c cpuCounters) usage(to cpuCounters) (process, system float64) {
+	if wall := to.at.Sub(c.at); wall > 0 {
+		process = 100 * float64(to.process-c.process) / float64(wall)
+	}
+	if total := to.system - c.system; total > 0 {
+		system = 100 * float64(to.systemBusy-c.systemBusy) / float64(total)
+	}
+	return process, system
+}
+
+// newCPUSampler returns an error when the counters can not be read here
+func newCPUSampler() (*cpuSampler, error) {
+	if _, err := readCPU(); err != nil {
+		return nil, err
+	}
+	c := &cpuSampler{}
+	c.reset()
+	return c, nil
+}
+
+// reset starts measuring from now, like after the warm up
+func (c *cpuSampler) reset() {
+	now, err := readCPU()
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.start, c.last = now, now
+	c.peakProcess, c.peakSystem = 0, 0
+}
+
+// sample ends a window when cpuWindow has passed since the last one, and
+// keeps its usage when it is the peak
+func (c *cpuSampler) sample() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.last.at) < cpuWindow {
+		return
+	}
+	now, err := readCPU()
+	if err != nil {
+		return
+	}
+	process, system := c.last.usage(now)
+	if process > c.peakProcess {
+		c.peakProcess = process
+	}
+	if system > c.peakSystem {
+		c.peakSystem = system
+	}
+	c.last = now
+}
+
+// cpuResult is the CPU used during the run, in percent
+type cpuResult struct {
+	cpus                 int
+	process, peakProcess float64
+	system, peakSystem   float64
+	processTime          time.Duration
+}
+
+func (c *cpuSampler) result() cpuResult {
+	c.sample()
+	now, err := readCPU()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := cpuResult{cpus: runtime.NumCPU(), peakProcess: c.peakProcess, peakSystem: c.peakSystem}
+	if err == nil {
+		r.process, r.system = c.start.usage(now)
+		r.processTime = now.process - c.start.process
+	}
+	// a run shorter than a window has no peak of its own
+	if r.process > r.peakProcess {
+		r.peakProcess = r.process
+	}
+	if r.system > r.peakSystem {
+		r.peakSystem = r.system
+	}
+	return r
+}
+
+func (r cpuResult) print() {
+	fmt.Printf("CPU: process %.0f%% avg, %.0f%% peak of one CPU (%s), system %.0f%% avg, %.0f%% peak of %d CPUs\n",
+		r.process, r.peakProcess, r.processTime.Round(time.Millisecond), r.system, r.peakSystem, r.cpus)
+}
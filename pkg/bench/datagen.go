@@ -0,0 +1,83 @@
+package bench
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// -data realistic fills testData with faker style rows: names and emails
+// with popular values repeating, text made of words and values with a long
+// tail, so indexes and pages look more like production data than random
+// letters and uniform integers do
+const (
+	dataRandom    = "random"
+	dataRealistic = "realistic"
+)
+
+var (
+	fakeFirstNames = []string{
+		"James", "Mary", "John", "Patricia", "Robert", "Jennifer", "Michael", "Linda",
+		"William", "Elizabeth", "David", "Barbara", "Richard", "Susan", "Joseph", "Jessica",
+		"Thomas", "Sarah", "Charles", "Karen", "Daniel", "Nancy", "Matthew", "Lisa",
+		"Anthony", "Betty", "Mark", "Margaret", "Donald", "Sandra", "Steven", "Ashley",
+		"Paul", "Kimberly", "Andrew", "Emily", "Joshua", "Donna", "Kenneth", "Michelle",
+	}
+	fakeLastNames = []string{
+		"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis",
+		"Rodriguez", "Martinez", "Hernandez", "Lopez", "Gonzalez", "Wilson", "Anderson", "Thomas",
+		"Taylor", "Moore", "Jackson", "Martin", "Lee", "Perez", "Thompson", "White",
+		"Harris", "Sanchez", "Clark", "Ramirez", "Lewis", "Robinson", "Walker", "Young",
+		"Allen", "King", "Wright", "Scott", "Torres", "Nguyen", "Hill", "Flores",
+	}
+	fakeDomains = []string{
+		"gmail.com", "yahoo.com", "hotmail.com", "outlook.com", "icloud.com", "aol.com",
+		"proton.me", "example.com", "example.org", "mail.com",
+	}
+	fakeWords = strings.Fields(`the of and to a in is it you that he was for on are with as
+		his they be at one have this from or had by hot word but what some we can out other
+		were all there when up use your how said an each she which do their time if will way
+		about many then them write would like so these her long make thing see him two has
+		look more day could go come did number sound no most people my over know water than
+		call first who may down side been now find any new work part take get place made live
+		where after back little only round man year came show every good me give our under`)
+)
+
+// skewed picks an index below n, low indexes more often than high ones. The
+// higher power is the stronger the skew, 1 is uniform.
+func skewed(n int, power float64) int {
+	return int(float64(n) * math.Pow(random.Float64(), power))
+}
+
+// fakeName returns a first and last name
+func fakeName() (first, last string) {
+	return fakeFirstNames[skewed(len(fakeFirstNames), 3)], fakeLastNames[skewed(len(fakeLastNames), 3)]
+}
+
+// fakeEmail returns an address for the name, some with a number to tell apart
+// the people sharing a name
+func fakeEmail(first, last string) string {
+	local := strings.ToLower(first + "." + last)
+	if random.Intn(2) == 0 {
+		local += fmt.Sprint(random.Intn(1000))
+	}
+	return local + "@" + fakeDomains[skewed(len(fakeDomains), 3)]
+}
+
+// fakeText returns n bytes of words
+func fakeText(n int) string {
+	var b strings.Builder
+	for b.Len() < n {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(fakeWords[skewed(len(fakeWords), 1.5)])
+	}
+	return b.String()[:n]
+}
+
+// fakeValue returns a log-normally distributed amount, like order totals in
+// cents: most around a thousand with a long tail into the millions
+func fakeValue() int {
+	return int(math.Exp(7 + 1.5*random.NormFloat64()))
+}
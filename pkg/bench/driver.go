@@ -0,0 +1,187 @@
+package bench
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// pragmaList collects repeated -pragma flags, ie: -pragma synchronous=OFF -pragma cache_size=-2000
+type pragmaList []string
+
+func (p *pragmaList) String() string {
+	return strings.Join(*p, ", ")
+}
+
+func (p *pragmaList) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("expecting name=value, got %q", value)
+	}
+	*p = append(*p, value)
+	return nil
+}
+
+// connectConfig is what the ConnectHook sets up on every new connection. It
+// is read as each connection opens so it can change between runs.
+type connectConfig struct {
+	pragmas []string
+
+	// attach when set is ATTACHed to every connection as the aux schema,
+	// pragmas are applied to it as well
+	attach string
+	// auxJournalMode is the journal mode set on the attached database, the
+	// main one gets its own from the DSN
+	auxJournalMode string
+
+	// udf registers go_abs on every connection, udfCalls counts the rows it
+	// was called for
+	udf      bool
+	udfCalls int64
+
+	// collation registers go_nocase on every connection, collationCalls
+	// counts the comparisons it made
+	collation      bool
+	collationCalls int64
+
+	// vtab when set is the store behind the go_values virtual table module
+	// registered on every connection
+	vtab *vtabStore
+}
+
+// udf names for -udf: go calls a Go function through cgo for every row,
+// native calls SQLite's own abs() as the baseline
+const (
+	udfGo     = "go"
+	udfNative = "native"
+)
+
+// collation names for -collation: go compares through a Go function,
+// native uses SQLite's own NOCASE as the baseline
+const (
+	collationGo     = "go"
+	collationNative = "native"
+)
+
+// collationFunc returns the collation of the tag column for collation
+func collationFunc(collation string) (string, error) {
+	switch collation {
+	case "":
+		return "", nil
+	case collationGo:
+		return "go_nocase", nil
+	case collationNative:
+		return "NOCASE", nil
+	}
+	return "", fmt.Errorf("invalid collation %q, expecting one of [%s, %s]", collation, collationGo, collationNative)
+}
+
+// noCase compares a and b the way SQLite's NOCASE does, folding only ASCII
+// letters, without allocating
+func noCase(a, b string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		ca, cb := a[i], b[i]
+		if 'A' <= ca && ca <= 'Z' {
+			ca += 'a' - 'A'
+		}
+		if 'A' <= cb && cb <= 'Z' {
+			cb += 'a' - 'A'
+		}
+		if ca != cb {
+			return int(ca) - int(cb)
+		}
+	}
+	return len(a) - len(b)
+}
+
+// udfFunc returns the SQL function reads wrap the value column in for udf
+func udfFunc(udf string) (string, error) {
+	switch udf {
+	case "":
+		return "", nil
+	case udfGo:
+		return "go_abs", nil
+	case udfNative:
+		return "abs", nil
+	}
+	return "", fmt.Errorf("invalid udf %q, expecting one of [%s, %s]", udf, udfGo, udfNative)
+}
+
+// registerDriver registers a sqlite3 driver under name that runs the pragmas
+// of c on every new connection. A single db.Exec("PRAGMA ...") only reaches
+// whichever pooled connection happened to run it, the ConnectHook reaches all
+// of them. The driver is returned for opening raw connections outside of
+// database/sql.
+func registerDriver(name string, c *connectConfig) *sqlite3.SQLiteDriver {
+	d := &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if c.udf {
+				goAbs := func(v int64) int64 {
+					atomic.AddInt64(&c.udfCalls, 1)
+					if v < 0 {
+						return -v
+					}
+					return v
+				}
+				if err := conn.RegisterFunc("go_abs", goAbs, true); err != nil {
+					return fmt.Errorf("register go_abs: %v", err)
+				}
+			}
+			if c.collation {
+				goNoCase := func(a, b string) int {
+					atomic.AddInt64(&c.collationCalls, 1)
+					return noCase(a, b)
+				}
+				if err := conn.RegisterCollation("go_nocase", goNoCase); err != nil {
+					return fmt.Errorf("register go_nocase: %v", err)
+				}
+			}
+			if c.vtab != nil {
+				if err := registerVTab(conn, c.vtab); err != nil {
+					return err
+				}
+			}
+			for _, pragma := range c.pragmas {
+				if _, err := conn.Exec("PRAGMA "+pragma+";", nil); err != nil {
+					return fmt.Errorf("PRAGMA %s: %w", pragma, err)
+				}
+			}
+			if c.attach == "" {
+				return nil
+			}
+
+			if _, err := conn.Exec("ATTACH DATABASE ? AS aux;", []driver.Value{c.attach}); err != nil {
+				return fmt.Errorf("ATTACH %s: %w", c.attach, err)
+			}
+			pragmas := c.pragmas
+			if c.auxJournalMode != "" {
+				pragmas = append(pragmas[:len(pragmas):len(pragmas)], "journal_mode="+c.auxJournalMode)
+			}
+			for _, pragma := range pragmas {
+				if _, err := conn.Exec("PRAGMA aux."+pragma+";", nil); err != nil {
+					return fmt.Errorf("PRAGMA aux.%s: %w", pragma, err)
+				}
+			}
+			return nil
+		},
+	}
+	sql.Register(name, d)
+	return d
+}
+
+// poolConfig holds the database/sql connection pool settings
+type poolConfig struct {
+	maxOpen     int
+	maxIdle     int
+	maxLifetime time.Duration
+}
+
+func (p poolConfig) apply(db *sql.DB) {
+	db.SetMaxOpenConns(p.maxOpen)
+	db.SetMaxIdleConns(p.maxIdle)
+	db.SetConnMaxLifetime(p.maxLifetime)
+}
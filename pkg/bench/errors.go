@@ -0,0 +1,160 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// errorClass is the kind of error a failed attempt ran into. They point at
+// different problems: SQLITE_BUSY is another connection holding a lock on the
+// database file, SQLITE_LOCKED a conflict between connections sharing a cache
+// or statements on the same connection.
+type errorClass int
+
+const (
+	errBusy errorClass = iota
+	errLocked
+	errOther
+
+	numErrorClasses
+)
+
+var errorClassNames = [numErrorClasses]string{"busy", "locked", "other"}
+
+func (c errorClass) String() string {
+	return errorClassNames[c]
+}
+
+// classify returns the class of err
+func classify(err error) errorClass {
+	var serr sqlite3.Error
+	if !errors.As(err, &serr) {
+		return errOther
+	}
+	switch serr.Code {
+	case sqlite3.ErrBusy:
+		return errBusy
+	case sqlite3.ErrLocked:
+		return errLocked
+	}
+	return errOther
+}
+
+// retry policies for -retry
+const (
+	retryBusy = "busy"
+	retryAll  = "all"
+)
+
+// retryable is true when policy retries err. With retryBusy only busy and
+// locked errors are retried, anything else like a constraint violation or a
+// syntax error would fail the same way every time.
+func retryable(policy string, err error) bool {
+	if errors.As(err, new(fatalError)) {
+		return false
+	}
+	return policy == retryAll || classify(err) != errOther
+}
+
+// fatalError fails the test under any -retry policy, it is a broken
+// workload rather than an attempt that lost a race
+type fatalError struct {
+	err error
+}
+
+func (e fatalError) Error() string {
+	return e.err.Error()
+}
+
+func (e fatalError) Unwrap() error {
+	return e.err
+}
+
+// errorCounts counts failed attempts by errorClass
+type errorCounts [numErrorClasses]int64
+
+func (c *errorCounts) add(other errorCounts) {
+	for i, n := range other {
+		c[i] += n
+	}
+}
+
+// String lists the classes that were seen, ie: busy 12, locked 3
+func (c errorCounts) String() string {
+	var parts []string
+	for i, n := range c {
+		if n > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", errorClass(i), n))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// errorLog collects every distinct error a run ran into, so a rare failure is
+// still in the report after scrolling past as a single retry symbol
+type errorLog struct {
+	begin time.Time
+
+	mu        sync.Mutex
+	byMessage map[string]*errorEntry
+}
+
+// errorEntry is one distinct error message, first and last are how long
+// into the run it was seen
+type errorEntry struct {
+	message     string
+	class       errorClass
+	count       int64
+	first, last time.Duration
+}
+
+func newErrorLog() *errorLog {
+	return &errorLog{begin: time.Now(), byMessage: make(map[string]*errorEntry)}
+}
+
+func (l *errorLog) add(err error) {
+	at := time.Since(l.begin)
+	message := err.Error()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.byMessage[message]
+	if !ok {
+		e = &errorEntry{message: message, class: classify(err), first: at}
+		l.byMessage[message] = e
+	}
+	e.count++
+	e.last = at
+}
+
+// entries returns the errors seen, the most frequent first
+func (l *errorLog) entries() []errorEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var entries []errorEntry
+	for _, e := range l.byMessage {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].count != entries[j].count {
+			return entries[i].count > entries[j].count
+		}
+		return entries[i].first < entries[j].first
+	})
+	return entries
+}
+
+func printErrors(entries []errorEntry) {
+	round := func(d time.Duration) time.Duration { return d.Round(time.Millisecond) }
+	fmt.Println("Errors seen: ", len(entries))
+	for _, e := range entries {
+		fmt.Printf("  %d %s: %s, first at %s, last at %s\n", e.count, e.class, e.message, round(e.first), round(e.last))
+	}
+}
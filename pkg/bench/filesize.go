@@ -0,0 +1,73 @@
+package bench
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// fileSize samples the size of a file during a run. Files like the WAL are
+// sampled rather than checked at the end, closing the connections
+// checkpoints and resets them.
+type fileSize struct {
+	path string
+
+	mu                 sync.Mutex
+	start, peak, final int64
+}
+
+func newFileSize(path string) *fileSize {
+	f := &fileSize{path: path}
+	f.reset()
+	return f
+}
+
+// size returns the size of the file, 0 while it does not exist
+func (f *fileSize) size() int64 {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// reset starts measuring from now, like after the warm up
+func (f *fileSize) reset() {
+	size := f.size()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.start, f.peak, f.final = size, size, size
+}
+
+func (f *fileSize) sample() {
+	size := f.size()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if size > f.peak {
+		f.peak = size
+	}
+	f.final = size
+}
+
+// fileSizeResult is how large a file was at the start of the measured part
+// of the run, at its largest and at the end, before the connections closed
+type fileSizeResult struct {
+	start, peak, final int64
+}
+
+// result samples the file a last time
+func (f *fileSize) result() fileSizeResult {
+	f.sample()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return fileSizeResult{start: f.start, peak: f.peak, final: f.final}
+}
+
+// growth is how much the file grew from the start, negative when it shrank
+func (r fileSizeResult) growth() int64 {
+	return r.final - r.start
+}
+
+func (r fileSizeResult) String() string {
+	return fmt.Sprintf("peak %d, final %d", r.peak, r.final)
+}
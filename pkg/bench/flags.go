@@ -0,0 +1,241 @@
+package bench
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// benchFlags are the flags of the commands that run the benchmark. Commands
+// like compare and sweep set some of them again between runs, the runs only
+// read them.
+type benchFlags struct {
+	walMode            bool
+	testType           string
+	configFile         string
+	scenarioName       string
+	pluginPath         string
+	writerCount        int
+	readerCount        int
+	snapshotHold       time.Duration
+	stallHold          time.Duration
+	stallInterval      time.Duration
+	stuckAfter         time.Duration
+	stuckCancel        bool
+	countSyncs         bool
+	measureWriteAmp    bool
+	rusage             bool
+	ioStats            bool
+	cpuStats           bool
+	leakCheck          time.Duration
+	runtimeStats       bool
+	poolStats          bool
+	measureStmts       bool
+	slowThreshold      time.Duration
+	starvationWindow   time.Duration
+	retryPolicy        string
+	checkpointInterval time.Duration
+	checkpointMode     string
+	quickCheck         time.Duration
+	createIndexAt      time.Duration
+	vacuumAt           time.Duration
+	migration          string
+	migrationAt        time.Duration
+	pollerCount        int
+	pollInterval       time.Duration
+	iterations         int
+	saveBaseline       string
+	checkBaseline      string
+	baselineDir        string
+	tolerance          float64
+	seed               int64
+	numRows            int
+	numUpdates         int
+	duration           time.Duration
+	workloadType       string
+	workloadFilename   string
+	scriptFilename     string
+	recordFilename     string
+	replayFilename     string
+	replaySpeed        float64
+	writeRate          int
+	writeBurst         int
+	readRate           int
+	readThink          time.Duration
+	appendRate         int
+	window             time.Duration
+	rollbackRate       float64
+	batch              int
+	mixSpec            string
+	distribution       string
+	hotRow             bool
+	schemaKind         string
+	readPattern        string
+	udf                string
+	collation          string
+	rangeSize          int
+	tableForm          string
+	auditTriggers      int
+	strict             bool
+	partialIndex       bool
+	valueIndex         bool
+	txSize             int
+	valueSize          int
+	data               string
+	blob               bool
+	warmup             time.Duration
+	readOnly           bool
+	immutable          bool
+	dbDir              string
+	sharedCache        bool
+	splitPools         bool
+	connPerWorker      bool
+	prepared           bool
+	raw                bool
+	stmtCache          string
+	sqlVariants        int
+	txLock             string
+	openMutex          string
+	versions           bool
+	measureStaleness   bool
+	checkSnapshots     bool
+	checkReads         bool
+	verify             bool
+	keep               bool
+	pool               poolConfig
+	pragmas            pragmaList
+}
+
+// registerFlags registers the benchmark flags on fs
+func registerFlags(fs *flag.FlagSet) *benchFlags {
+	f := &benchFlags{}
+	fs.BoolVar(&f.walMode, "wal", false, "Use WAL mode for database")
+	fs.StringVar(&f.testType, "type", "none", "Locking type: [none, mutex, rwmutex, channel] or one registered by -plugin")
+	fs.StringVar(&f.configFile, "config", "", "YAML or TOML scenario file giving values to any of these flags, the command line overrides it, see README")
+	fs.StringVar(&f.scenarioName, "scenario", "", "Built in scenario giving values to these flags, -config and the command line override it: ["+strings.Join(presetNames(), ", ")+"], see README")
+	fs.StringVar(&f.pluginPath, "plugin", "", "Go plugin (.so) registering more -workload and -type implementations, see README")
+	fs.IntVar(&f.writerCount, "writers", 2, "Number of parallel writers")
+	fs.IntVar(&f.readerCount, "readers", 2, "Number of parallel readers ")
+	fs.DurationVar(&f.snapshotHold, "snapshot-hold", 0, "Hold a read transaction open for this long, then release it for as long, repeated for the whole run")
+	fs.DurationVar(&f.stallHold, "stall-hold", 0, "Every -stall-interval a chaos writer holds a write transaction open this long")
+	fs.DurationVar(&f.stallInterval, "stall-interval", time.Second, "Time between chaos writer stalls")
+	fs.DurationVar(&f.stuckAfter, "stuck-after", 0, "Report every op in flight for longer than this with its statement and stack, 0 never")
+	fs.BoolVar(&f.stuckCancel, "stuck-cancel", false, "Cancel the ops -stuck-after reports instead of letting them run on")
+	fs.BoolVar(&f.countSyncs, "count-syncs", false, "Count the xSync calls sqlite makes through a counting VFS, needs a build with -tags syncvfs")
+	fs.BoolVar(&f.measureWriteAmp, "write-amp", false, "Report the bytes written to the files against the bytes of the values written")
+	fs.BoolVar(&f.rusage, "rusage", false, "Report the peak RSS, open files and context switches of the process, Linux only")
+	fs.BoolVar(&f.ioStats, "io-stats", false, "Report the bytes and calls read and written by the process, Linux only")
+	fs.BoolVar(&f.cpuStats, "cpu-stats", false, "Report the average and peak CPU used by the process and the system, Linux only")
+	fs.DurationVar(&f.leakCheck, "leak-check", 0, "Check the live heap and goroutines this often and warn when they keep growing, for long runs")
+	fs.BoolVar(&f.runtimeStats, "runtime-stats", false, "Report Go garbage collection, allocations, heap and goroutines")
+	fs.BoolVar(&f.poolStats, "pool-stats", false, "Report database/sql connection pool waits and usage, not available with -raw")
+	fs.BoolVar(&f.measureStmts, "stmt-stats", false, "Report the latency and errors of every statement by its SQL, literals left out")
+	fs.DurationVar(&f.slowThreshold, "slow-threshold", 0, "Print every statement that takes longer than this, with its arguments and how many retries came before it, 0 never")
+	fs.DurationVar(&f.starvationWindow, "starvation-window", 0, "Warn whenever a reader or writer completes no ops for this long, 0 never")
+	fs.StringVar(&f.retryPolicy, "retry", retryBusy, "Which errors are retried: [busy, all], busy retries SQLITE_BUSY and SQLITE_LOCKED and fails the run on anything else")
+	fs.DurationVar(&f.checkpointInterval, "checkpoint-interval", 0, "Run PRAGMA wal_checkpoint from its own connection this often and measure it and the ops it overlapped, needs -wal")
+	fs.StringVar(&f.checkpointMode, "checkpoint-mode", checkpointPassive, "Mode of -checkpoint-interval: [passive, full, restart, truncate]")
+	fs.DurationVar(&f.quickCheck, "quick-check", 0, "Run PRAGMA quick_check from its own connection this often during the run, failing it on any problem")
+	fs.DurationVar(&f.createIndexAt, "create-index-at", 0, "Build a new index on value this long into the run, while readers and writers continue")
+	fs.DurationVar(&f.vacuumAt, "vacuum-at", 0, "Run VACUUM this long into the run, while readers and writers continue")
+	fs.StringVar(&f.migration, "migration", "", "Online schema migration run at -migration-at: [add-column, table-copy, index-swap]")
+	fs.DurationVar(&f.migrationAt, "migration-at", time.Second, "How long into the run -migration starts")
+	fs.IntVar(&f.pollerCount, "pollers", 0, "Number of extra readers polling SELECT COUNT(*), reported separately as poll")
+	fs.DurationVar(&f.pollInterval, "poll-interval", 10*time.Millisecond, "Time between each poller's queries, 0 is as fast as possible")
+	fs.IntVar(&f.iterations, "iterations", 1, "Run every configuration this many times and print the mean, stddev, min and max of their throughput and write p99")
+	fs.StringVar(&f.saveBaseline, "save-baseline", "", "Save the mean results under this name in -baseline-dir for -check-baseline")
+	fs.StringVar(&f.checkBaseline, "check-baseline", "", "Compare the results to the ones saved under this name and fail if ops/sec dropped or write p99 rose beyond -tolerance")
+	fs.StringVar(&f.baselineDir, "baseline-dir", "baselines", "Directory -save-baseline and -check-baseline keep baselines in")
+	fs.Float64Var(&f.tolerance, "tolerance", 10, "Percent -check-baseline lets ops/sec drop or write p99 rise by")
+	fs.Int64Var(&f.seed, "seed", 0, "Seed of the random values, row ids and ops, 0 picks one from the clock. Workers still interleave differently every run")
+	fs.IntVar(&f.numRows, "rows", 10, "Number of total DB rows, lower number = more contention")
+	fs.IntVar(&f.numUpdates, "updates", 500, "How many UPDATE dml operations to perform over numRows")
+	fs.DurationVar(&f.duration, "duration", 0, "Run readers and writers for this long instead of a fixed number of -updates")
+	fs.StringVar(&f.workloadType, "workload", workloadUpdate, "Workload to run, see README: [update, insert, upsert, retention, rmw, counter, queue, timeseries, returning, spatial, flip, savepoint, attach, vtab] or one registered by -plugin")
+	fs.StringVar(&f.workloadFilename, "workload-file", "", "SQL file of statements readers and writers cycle through instead of -workload, see README")
+	fs.StringVar(&f.scriptFilename, "script", "", "Starlark script describing the workload instead of -workload, see README")
+	fs.StringVar(&f.recordFilename, "record", "", "Write every successful op with its statements and start time to this file for -replay")
+	fs.StringVar(&f.replayFilename, "replay", "", "Run the ops of a -record file instead of generating them, the table flags must match the recording")
+	fs.Float64Var(&f.replaySpeed, "replay-speed", 1, "Multiplier for the recorded timing of -replay, 2 is twice as fast, 0 is as fast as possible")
+	fs.IntVar(&f.writeRate, "write-rate", 0, "Writes handed to the writers per second, paced by a token bucket, 0 is as fast as possible")
+	fs.IntVar(&f.writeBurst, "write-burst", 0, "Tokens the -write-rate bucket holds, 0 holds all and every write stays due on schedule. N drops the writes due before the last N once the writers fell behind, hiding their backlog")
+	fs.IntVar(&f.readRate, "read-rate", 0, "Reads per second across all readers, paced by a token bucket, 0 is as fast as possible")
+	fs.DurationVar(&f.readThink, "read-think", 0, "Pause every reader this long after each read, like a user reading the answer")
+	fs.IntVar(&f.appendRate, "append-rate", 0, "Events per second appended by the timeseries workload, 0 is as fast as possible")
+	fs.DurationVar(&f.window, "window", 5*time.Second, "How far back the timeseries workload readers look")
+	fs.Float64Var(&f.rollbackRate, "rollback-rate", 0.2, "Chance each savepoint workload update is rolled back to its savepoint, 0 to 1")
+	fs.IntVar(&f.batch, "batch", 1, "Rows per INSERT, more than 1 uses a multi row VALUES statement")
+	fs.StringVar(&f.mixSpec, "mix", "", "Weighted operation mix run by every reader and writer, ie: read=80,update=15,insert=4,delete=1")
+	fs.StringVar(&f.distribution, "distribution", distUniform, "How row ids are picked: [uniform, zipfian, latest]")
+	fs.BoolVar(&f.hotRow, "hot-row", false, "Every write targets the same row, the worst case for lock contention, reads keep to -distribution")
+	fs.StringVar(&f.schemaKind, "schema", schemaSimple, "Table layout: [simple, relational, generated], see README")
+	fs.StringVar(&f.readPattern, "read-pattern", readScan, "How readers select rows: [point, range, scan, aggregate, offset, keyset, tag], tag needs -collation")
+	fs.StringVar(&f.udf, "udf", "", "Reads also return a function of every row's value: [go, native], go is a Go function called through cgo, native is SQLite's abs()")
+	fs.StringVar(&f.collation, "collation", "", "Add an indexed tag column compared with: [go, native], go is a Go collation called through cgo, native is SQLite's NOCASE")
+	fs.IntVar(&f.rangeSize, "range-size", 10, "Number of ids covered by each -read-pattern range read, or rows per offset/keyset page")
+	fs.StringVar(&f.tableForm, "table-form", formWithoutRowID, "testData table form: [without-rowid, rowid, both], both runs the test once for each")
+	fs.IntVar(&f.auditTriggers, "audit-triggers", 0, "Install this many AFTER UPDATE triggers on testData, each writing a row to an audit table")
+	fs.BoolVar(&f.strict, "strict", false, "Create STRICT tables, needs sqlite "+strictVersion+" or newer")
+	fs.BoolVar(&f.partialIndex, "partial-index", false, "Create an index on value covering only rows WHERE value > 0")
+	fs.BoolVar(&f.valueIndex, "index", false, "Create an index on the value column that every update has to maintain")
+	fs.IntVar(&f.txSize, "tx-size", 1, "Number of write statements wrapped in each transaction")
+	fs.IntVar(&f.valueSize, "value-size", 0, "Add a data column with this many bytes to every row, 0 keeps only the integer value")
+	fs.StringVar(&f.data, "data", dataRandom, "Row contents: [random, realistic], realistic adds names and emails and skews values, see README")
+	fs.BoolVar(&f.blob, "blob", false, "Store the -value-size data as random bytes in a BLOB column instead of text")
+	fs.DurationVar(&f.warmup, "warmup", 0, "Run readers and writers for this long before measuring starts")
+	fs.BoolVar(&f.readOnly, "readonly-readers", false, "Open a separate mode=ro database handle for readers")
+	fs.BoolVar(&f.immutable, "immutable", false, "Also open reader handle with immutable=1, requires -readonly-readers")
+	fs.StringVar(&f.dbDir, "db-dir", ".", "Directory to create the test database in, ie: a tmpfs or NFS mount")
+	fs.BoolVar(&f.sharedCache, "shared-cache", false, "Open the database with cache=shared, connections share one page cache and take table locks on it")
+	fs.BoolVar(&f.splitPools, "split-pools", false, "Use a single connection writer handle and a read only handle with one connection per reader")
+	fs.BoolVar(&f.connPerWorker, "conn-per-worker", false, "Pin one *sql.Conn to each reader and writer for the whole run")
+	fs.BoolVar(&f.prepared, "prepared", false, "Prepare each statement once per worker and reuse it instead of passing the SQL to every call")
+	fs.BoolVar(&f.raw, "raw", false, "Bypass database/sql, each worker uses its own driver connection and prepared statements")
+	fs.StringVar(&f.stmtCache, "stmt-cache", "0", "With -raw, prepared statements each worker keeps, least recently used are closed first, 0 keeps all. A comma separated list runs the test once per size")
+	fs.IntVar(&f.sqlVariants, "sql-variants", 0, "Prefix every statement with one of this many comments, giving each query that many distinct SQL texts")
+	fs.StringVar(&f.txLock, "txlock", "", "BEGIN behaviour for transactions: [deferred, immediate, exclusive] (driver default deferred)")
+	fs.StringVar(&f.openMutex, "open-mutex", "", "SQLite threading mode open flag: [no, full], no is multi-thread, full is serialized (driver default)")
+	fs.BoolVar(&f.versions, "versions", false, "Give every row a version each update reads and writes back one higher, and fail on lost or uncounted updates")
+	fs.BoolVar(&f.measureStaleness, "staleness", false, "Have every write bump a sequence and every read check how many committed writes it is behind")
+	fs.BoolVar(&f.checkSnapshots, "check-snapshots", false, "Readers run the same statements twice in one read transaction and count every answer that changed")
+	fs.BoolVar(&f.checkReads, "check-reads", false, "Check every read for NULLs, and while no op adds or removes rows, for missing ids and rows")
+	fs.BoolVar(&f.verify, "verify", false, "Track the last value committed to every updated row and fail if the database differs after the run")
+	fs.BoolVar(&f.keep, "keep", false, "Keep the database file after the run for inspection")
+	// from go-sqlite readme: max open conns of 1 helps get rid of database is locked issue
+	// from testing this option, [-wal, -type none] resulted in the fastest runs
+	fs.IntVar(&f.pool.maxOpen, "max-open-conns", 1, "Max open connections per database handle, <= 0 is unlimited")
+	fs.IntVar(&f.pool.maxIdle, "max-idle-conns", 2, "Max idle connections per database handle, <= 0 keeps none")
+	fs.DurationVar(&f.pool.maxLifetime, "conn-max-lifetime", 0, "Max time a connection is reused, 0 is forever")
+	fs.Var(&f.pragmas, "pragma", "PRAGMA name=value applied to every connection, may be repeated")
+	return f
+}
+
+// parse parses args with fs, then gives the flags not set on the command line
+// the values of the -config file, and those still not set the ones of the
+// -scenario preset. False means one of them was invalid and said why.
+func (f *benchFlags) parse(fs *flag.FlagSet, args []string) bool {
+	fs.Parse(args)
+	if f.configFile != "" {
+		s, err := loadScenario(f.configFile)
+		if err == nil {
+			err = s.apply(fs)
+		}
+		if err != nil {
+			fmt.Println("Invalid -config:", err)
+			return false
+		}
+	}
+	if f.scenarioName != "" {
+		preset, ok := presets[f.scenarioName]
+		if !ok {
+			fmt.Println("Invalid -scenario:", f.scenarioName)
+			return false
+		}
+		if err := preset.apply(fs); err != nil {
+			fmt.Println("Invalid -scenario:", err)
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package bench
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// buildInfo describes the sqlite library the driver was built with
+type buildInfo struct {
+	version        string
+	sourceID       string
+	compileOptions []string
+}
+
+// sqliteBuildInfo asks the linked sqlite library about itself
+func sqliteBuildInfo(db *sql.DB) (buildInfo, error) {
+	var info buildInfo
+	err := db.QueryRow("SELECT sqlite_version(), sqlite_source_id()").Scan(&info.version, &info.sourceID)
+	if err != nil {
+		return info, err
+	}
+
+	rows, err := db.Query("PRAGMA compile_options")
+	if err != nil {
+		return info, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var option string
+		if err := rows.Scan(&option); err != nil {
+			return info, err
+		}
+		info.compileOptions = append(info.compileOptions, option)
+	}
+	return info, rows.Err()
+}
+
+// option returns the value of a compile option like THREADSAFE=1, or "" if
+// it was not set
+func (b buildInfo) option(name string) string {
+	for _, option := range b.compileOptions {
+		if option == name {
+			return "on"
+		}
+		if strings.HasPrefix(option, name+"=") {
+			return option[len(name)+1:]
+		}
+	}
+	return ""
+}
+
+// atLeast is true when the linked sqlite is version or newer, ie: "3.37.0"
+func (b buildInfo) atLeast(version string) bool {
+	have, want := strings.Split(b.version, "."), strings.Split(version, ".")
+	for i := range want {
+		var h int
+		if i < len(have) {
+			h, _ = strconv.Atoi(have[i])
+		}
+		w, _ := strconv.Atoi(want[i])
+		if h != w {
+			return h > w
+		}
+	}
+	return true
+}
+
+func (b buildInfo) print() {
+	fmt.Println("SQLite")
+	fmt.Println("---------------------------")
+	fmt.Println("Version     : ", b.version)
+	fmt.Println("Source ID   : ", b.sourceID)
+	fmt.Println("Thread safe : ", b.option("THREADSAFE"))
+	fmt.Println("Options     : ", strings.Join(b.compileOptions, " "))
+	fmt.Println()
+}
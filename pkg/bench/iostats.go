@@ -0,0 +1,77 @@
+package bench
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ioCounters are a process's I/O counters. The chars and calls count every
+// read and write made, the bytes only what reached the storage layer, page
+// cache hits and writes not yet flushed are left out.
+type ioCounters struct {
+	readChars, writeChars int64
+	readCalls, writeCalls int64
+	readBytes, writeBytes int64
+
+	// cancelledBytes were counted in writeBytes but never written, like
+	// the pages of a file truncated before they were flushed
+	cancelledBytes int64
+}
+
+func (c ioCounters) sub(o ioCounters) ioCounters {
+	return ioCounters{
+		readChars:      c.readChars - o.readChars,
+		writeChars:     c.writeChars - o.writeChars,
+		readCalls:      c.readCalls - o.readCalls,
+		writeCalls:     c.writeCalls - o.writeCalls,
+		readBytes:      c.readBytes - o.readBytes,
+		writeBytes:     c.writeBytes - o.writeBytes,
+		cancelledBytes: c.cancelledBytes - o.cancelledBytes,
+	}
+}
+
+// ioSampler measures the I/O done during the measured part of a run
+type ioSampler struct {
+	mu    sync.Mutex
+	start ioCounters
+}
+
+// newIOSampler returns an error when the counters can not be read here
+func newIOSampler() (*ioSampler, error) {
+	start, err := processIO()
+	if err != nil {
+		return nil, err
+	}
+	return &ioSampler{start: start}, nil
+}
+
+// reset starts counting from now, like after the warm up
+func (s *ioSampler) reset() {
+	if now, err := processIO(); err == nil {
+		s.mu.Lock()
+		s.start = now
+		s.mu.Unlock()
+	}
+}
+
+// result returns the I/O done since reset
+func (s *ioSampler) result() ioCounters {
+	now, _ := processIO()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return now.sub(s.start)
+}
+
+// print shows the I/O per read and write op as well
+func (r ioCounters) print(reads, writes int64) {
+	perOp := func(n, ops int64) float64 {
+		if ops == 0 {
+			return 0
+		}
+		return float64(n) / float64(ops)
+	}
+	fmt.Printf("I/O: read %d bytes in %d calls (%.1f calls/read op), %d bytes from storage\n",
+		r.readChars, r.readCalls, perOp(r.readCalls, reads), r.readBytes)
+	fmt.Printf("  wrote %d bytes in %d calls (%.1f calls/write op), %d bytes to storage (%.0f/write op), %d cancelled\n",
+		r.writeChars, r.writeCalls, perOp(r.writeCalls, writes), r.writeBytes, perOp(r.writeBytes, writes), r.cancelledBytes)
+}
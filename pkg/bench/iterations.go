@@ -0,0 +1,91 @@
+package bench
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// variation is how one number varied over the -iterations runs of a
+// configuration, stddev is the sample standard deviation
+type variation struct {
+	runs                   int
+	mean, stddev, min, max float64
+}
+
+func variationOf(samples []float64) variation {
+	if len(samples) == 0 {
+		return variation{}
+	}
+	v := variation{runs: len(samples), min: samples[0], max: samples[0]}
+	var total float64
+	for _, x := range samples {
+		total += x
+		v.min = math.Min(v.min, x)
+		v.max = math.Max(v.max, x)
+	}
+	v.mean = total / float64(len(samples))
+
+	if len(samples) > 1 {
+		var squares float64
+		for _, x := range samples {
+			squares += (x - v.mean) * (x - v.mean)
+		}
+		v.stddev = math.Sqrt(squares / float64(len(samples)-1))
+	}
+	return v
+}
+
+func (v variation) String() string {
+	var cv float64
+	if v.mean > 0 {
+		cv = 100 * v.stddev / v.mean
+	}
+	return fmt.Sprintf("mean %.0f, stddev %.1f (%.1f%% of mean), min %.0f, max %.0f", v.mean, v.stddev, cv, v.min, v.max)
+}
+
+// metricOf returns the -metric of one run: ops, reads or writes per second,
+// or the worst write p99 in microseconds
+func metricOf(r testResult, metric string) float64 {
+	reads, writes, p99 := r.totals()
+	switch metric {
+	case metricReads:
+		return r.perSecond(reads)
+	case metricWrites:
+		return r.perSecond(writes)
+	case metricP99:
+		return float64(p99) / float64(time.Microsecond)
+	}
+	return r.perSecond(reads + writes)
+}
+
+// samples returns the metric of every run
+func (b benchmarkResult) samples(metric string) []float64 {
+	samples := make([]float64, len(b.runs))
+	for i, r := range b.runs {
+		samples[i] = metricOf(r, metric)
+	}
+	return samples
+}
+
+// variation returns how the metric varied over the runs
+func (b benchmarkResult) variation(metric string) variation {
+	return variationOf(b.samples(metric))
+}
+
+// mean returns the mean of the metric over the runs
+func (b benchmarkResult) mean(metric string) float64 {
+	return b.variation(metric).mean
+}
+
+// printIterations prints how the throughput and write p99 varied over the
+// runs of one configuration
+func (b benchmarkResult) printIterations() {
+	fmt.Println()
+	fmt.Println()
+	fmt.Println("Iterations:", len(b.runs))
+	fmt.Println("---------------------------")
+	fmt.Println("Reads/sec     : ", b.variation(metricReads))
+	fmt.Println("Writes/sec    : ", b.variation(metricWrites))
+	fmt.Println("Write p99 (µs): ", b.variation(metricP99))
+}
@@ -0,0 +1,51 @@
+package bench
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestVariationOf(t *testing.T) {
+	tests := []struct {
+		samples []float64
+		want    variation
+	}{
+		{nil, variation{}},
+		{[]float64{3}, variation{runs: 1, mean: 3, min: 3, max: 3}},
+		{[]float64{2, 4}, variation{runs: 2, mean: 3, stddev: math.Sqrt2, min: 2, max: 4}},
+		{[]float64{2, 4, 4, 4, 5, 5, 7, 9}, variation{runs: 8, mean: 5, stddev: math.Sqrt(32.0 / 7), min: 2, max: 9}},
+	}
+	for _, tt := range tests {
+		got := variationOf(tt.samples)
+		if got.runs != tt.want.runs || got.mean != tt.want.mean || got.min != tt.want.min || got.max != tt.want.max ||
+			math.Abs(got.stddev-tt.want.stddev) > 1e-9 {
+			t.Errorf("variationOf(%v) = %+v, want %+v", tt.samples, got, tt.want)
+		}
+	}
+}
+
+func TestMetricOf(t *testing.T) {
+	r := testResult{
+		duration: 2 * time.Second,
+		ops: []opResult{
+			{name: "read", read: true, ops: 600},
+			{name: "update", ops: 200, latency: latencyStats{p99: 3 * time.Millisecond}},
+			{name: "insert", ops: 100, latency: latencyStats{p99: 5 * time.Millisecond}},
+		},
+	}
+	tests := []struct {
+		metric string
+		want   float64
+	}{
+		{metricOps, 450},
+		{metricReads, 300},
+		{metricWrites, 150},
+		{metricP99, 5000},
+	}
+	for _, tt := range tests {
+		if got := metricOf(r, tt.metric); got != tt.want {
+			t.Errorf("metricOf(%s) = %g, want %g", tt.metric, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package bench
+
+import (
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	distUniform = "uniform"
+	distZipfian = "zipfian"
+	distLatest  = "latest"
+
+	// zipfSkew is the s parameter of the zipfian distribution, the larger it
+	// is the more the lowest ids dominate
+	zipfSkew = 1.1
+)
+
+// keySpace hands out the row ids workers operate on
+type keySpace struct {
+	numRows int
+
+	// last is the highest id handed out for an insert
+	last int64
+
+	// dist decides which of the ids gets picked: uniform, zipfian or latest
+	dist string
+
+	// hotRow sends every write to row 1, the worst case for contention.
+	// Reads stay on the distribution.
+	hotRow bool
+
+	// zipfs are bounded zipf generators by the bit length of their range,
+	// they and r are not safe for concurrent use
+	mu    sync.Mutex
+	r     *rand.Rand
+	zipfs map[int]*rand.Zipf
+}
+
+func newKeySpace(numRows int, dist string) (*keySpace, error) {
+	switch dist {
+	case distUniform, distZipfian, distLatest:
+	default:
+		return nil, fmt.Errorf("invalid distribution %q, expecting one of [%s, %s, %s]",
+			dist, distUniform, distZipfian, distLatest)
+	}
+
+	return &keySpace{
+		numRows: numRows,
+		last:    int64(numRows),
+		dist:    dist,
+		r:       rand.New(rand.NewSource(random.Int63())),
+		zipfs:   make(map[int]*rand.Zipf),
+	}, nil
+}
+
+// existing returns the id of one of the rows filled before the test for a
+// write to change. With the latest distribution it favours the most recently
+// inserted rows instead.
+func (k *keySpace) existing() int {
+	if k.hotRow {
+		return 1
+	}
+	return k.read()
+}
+
+// read returns the id of one of the rows filled before the test for a read.
+// It ignores -hot-row, reads keep to the distribution and only hit row 1
+// as often as it picks it.
+func (k *keySpace) read() int {
+	hi := k.numRows
+	if k.dist == distLatest {
+		hi = int(atomic.LoadInt64(&k.last))
+	}
+	return k.pick(1, hi)
+}
+
+// next returns n new ids for inserts
+func (k *keySpace) next(n int) []int {
+	last := int(atomic.AddInt64(&k.last, int64(n)))
+	ids := make([]int, n)
+	for i := range ids {
+		ids[i] = last - n + 1 + i
+	}
+	return ids
+}
+
+// expired returns the id that falls out of a rolling window of numRows+1 rows
+// once id is inserted
+func (k *keySpace) expired(id int) int {
+	return id - k.numRows - 1
+}
+
+// upsert returns an id for an upsert. Ids go up to twice numRows so early on
+// about half of them insert and the rest update.
+func (k *keySpace) upsert() int {
+	if k.hotRow {
+		return 1
+	}
+	return k.pick(1, 2*k.numRows)
+}
+
+// any returns an id from every id handed out so far, it may already be deleted
+func (k *keySpace) any() int {
+	return k.pick(0, int(atomic.LoadInt64(&k.last)))
+}
+
+// pick returns an id in [lo, hi]. zipfian favours lo, latest favours hi.
+func (k *keySpace) pick(lo, hi int) int {
+	n := hi - lo + 1
+	switch k.dist {
+	case distZipfian:
+		return lo + k.zipfOffset(n)
+	case distLatest:
+		return hi - k.zipfOffset(n)
+	default:
+		return lo + random.Intn(n)
+	}
+}
+
+// zipfOffset returns a zipf distributed number in [0, n). It draws from a
+// zipf bounded by the next power of two and rejects the draws of n or more,
+// which keeps the skew of the distribution, where wrapping them around would
+// spread them evenly. The power of two keeps the generators few while latest
+// keeps growing n.
+func (k *keySpace) zipfOffset(n int) int {
+	if n <= 1 {
+		return 0
+	}
+	size := bits.Len(uint(n - 1))
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	z, ok := k.zipfs[size]
+	if !ok {
+		z = rand.NewZipf(k.r, zipfSkew, 1, 1<<uint(size)-1)
+		k.zipfs[size] = z
+	}
+	for {
+		if v := z.Uint64(); v < uint64(n) {
+			return int(v)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package bench
+
+import "testing"
+
+// drawCounts returns how often draw returned each id in n draws
+func drawCounts(n int, draw func() int) map[int]int {
+	counts := make(map[int]int)
+	for i := 0; i < n; i++ {
+		counts[draw()]++
+	}
+	return counts
+}
+
+func TestKeySpaceRange(t *testing.T) {
+	for _, dist := range []string{distUniform, distZipfian, distLatest} {
+		k, err := newKeySpace(10, dist)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for id := range drawCounts(10000, k.read) {
+			if id < 1 || id > 10 {
+				t.Errorf("%s read returned %d, want an id in [1, 10]", dist, id)
+			}
+		}
+		for id := range drawCounts(10000, k.upsert) {
+			if id < 1 || id > 20 {
+				t.Errorf("%s upsert returned %d, want an id in [1, 20]", dist, id)
+			}
+		}
+	}
+}
+
+func TestKeySpaceSkew(t *testing.T) {
+	tests := []struct {
+		dist string
+
+		// hot is the id the distribution favours, cold the one it
+		// favours least
+		hot, cold int
+	}{
+		{distZipfian, 1, 10},
+		{distLatest, 10, 1},
+	}
+	for _, tt := range tests {
+		k, err := newKeySpace(10, tt.dist)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts := drawCounts(10000, k.read)
+		if counts[tt.hot] < 5*counts[tt.cold] {
+			t.Errorf("%s: id %d drawn %d times, id %d %d times, want a skew of at least 5", tt.dist, tt.hot, counts[tt.hot], tt.cold, counts[tt.cold])
+		}
+	}
+
+	// uniform has no favourite, every id gets about a tenth of the draws
+	k, err := newKeySpace(10, distUniform)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, n := range drawCounts(10000, k.read) {
+		if n < 700 || n > 1300 {
+			t.Errorf("uniform: id %d drawn %d times, want about 1000", id, n)
+		}
+	}
+}
+
+func TestKeySpaceLatestFollowsInserts(t *testing.T) {
+	k, err := newKeySpace(10, distLatest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := k.next(3); ids[0] != 11 || ids[2] != 13 {
+		t.Fatalf("next(3) = %v, want [11 12 13]", ids)
+	}
+	counts := drawCounts(10000, k.read)
+	if counts[13] == 0 {
+		t.Error("latest never read the newest row 13")
+	}
+	if got := k.expired(13); got != 2 {
+		t.Errorf("expired(13) = %d, want 2", got)
+	}
+}
+
+func TestKeySpaceHotRow(t *testing.T) {
+	k, err := newKeySpace(10, distUniform)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.hotRow = true
+	if counts := drawCounts(1000, k.existing); counts[1] != 1000 {
+		t.Errorf("hot row writes went to %v, want only row 1", counts)
+	}
+	if counts := drawCounts(1000, k.upsert); counts[1] != 1000 {
+		t.Errorf("hot row upserts went to %v, want only row 1", counts)
+	}
+	if counts := drawCounts(1000, k.read); len(counts) < 2 {
+		t.Errorf("hot row reads went to %v, want them to keep to the distribution", counts)
+	}
+}
+
+func TestKeySpaceInvalid(t *testing.T) {
+	if _, err := newKeySpace(10, "gaussian"); err == nil {
+		t.Error("newKeySpace accepted distribution gaussian")
+	}
+}
+
+func TestZipfOffset(t *testing.T) {
+	k, err := newKeySpace(1, distZipfian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{1, 2, 3, 7, 8, 9, 100} {
+		for i := 0; i < 1000; i++ {
+			if v := k.zipfOffset(n); v < 0 || v >= n {
+				t.Fatalf("zipfOffset(%d) = %d, want one in [0, %d)", n, v, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package bench
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencies records how long every measured op of one kind took, from asking
+// for the lock until it succeeded, retries included
+type latencies struct {
+	mu      sync.Mutex
+	samples []time.Duration
+}
+
+func (l *latencies) add(d time.Duration) {
+	l.mu.Lock()
+	l.samples = append(l.samples, d)
+	l.mu.Unlock()
+}
+
+func (l *latencies) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.samples)
+}
+
+func (l *latencies) reset() {
+	l.mu.Lock()
+	l.samples = nil
+	l.mu.Unlock()
+}
+
+// latencyStats summarises the samples of one op
+type latencyStats struct {
+	avg, p50, p99, max time.Duration
+}
+
+// stats sorts the samples and summarises them
+func (l *latencies) stats() latencyStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	samples := l.samples
+	if len(samples) == 0 {
+		return latencyStats{}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	var total time.Duration
+	for _, d := range samples {
+		total += d
+	}
+	return latencyStats{
+		avg: total / time.Duration(len(samples)),
+		p50: percentile(samples, 50),
+		p99: percentile(samples, 99),
+		max: samples[len(samples)-1],
+	}
+}
+
+// percentile returns the p-th percentile of the sorted samples
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+func (s latencyStats) String() string {
+	round := func(d time.Duration) time.Duration { return d.Round(time.Microsecond) }
+	return "avg " + round(s.avg).String() +
+		", p50 " + round(s.p50).String() +
+		", p99 " + round(s.p99).String() +
+		", max " + round(s.max).String()
+}
+
+// opCounter is what a run measured for one op. maxRetries is the most times
+// a single op had to be retried and retryTime the nanoseconds spent on the
+// attempts that failed, errors counts their errors by class. intended is
+// the latency from when a paced op was due rather than when it started, it
+// has no samples without a rate.
+type opCounter struct {
+	read                                bool
+	ops, retries, maxRetries, retryTime int64
+	errors                              errorCounts
+	latency, intended                   latencies
+}
+
+// opCounters holds the counter of every op name a run has seen, a workload can
+// bring ops the runner has never heard of
+type opCounters struct {
+	mu     sync.Mutex
+	byName map[string]*opCounter
+}
+
+func (c *opCounters) get(name string, read bool) *opCounter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.byName == nil {
+		c.byName = make(map[string]*opCounter)
+	}
+	counter, ok := c.byName[name]
+	if !ok {
+		counter = &opCounter{read: read}
+		c.byName[name] = counter
+	}
+	return counter
+}
+
+// total is the number of successful ops so far
+func (c *opCounters) total() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var total int64
+	for _, counter := range c.byName {
+		total += atomic.LoadInt64(&counter.ops)
+	}
+	return total
+}
+
+// opResult is the measurements of one op after the run
+type opResult struct {
+	name                     string
+	read                     bool
+	ops, retries, maxRetries int64
+	retryTime                time.Duration
+	errors                   errorCounts
+	latency                  latencyStats
+
+	// intended counts the ops that were due at a set time and their latency
+	// from then
+	intendedOps int
+	intended    latencyStats
+}
+
+// retriesPerOp is how many times each op had to be retried on average
+func (r opResult) retriesPerOp() float64 {
+	if r.ops == 0 {
+		return 0
+	}
+	return float64(r.retries) / float64(r.ops)
+}
+
+// results returns every op, the built in ones first in their usual order and
+// then the rest by name
+func (c *opCounters) results() []opResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var results []opResult
+	for name, counter := range c.byName {
+		var errors errorCounts
+		for i := range errors {
+			errors[i] = atomic.LoadInt64(&counter.errors[i])
+		}
+		results = append(results, opResult{
+			name:       name,
+			read:       counter.read,
+			ops:        atomic.LoadInt64(&counter.ops),
+			retries:    atomic.LoadInt64(&counter.retries),
+			maxRetries: atomic.LoadInt64(&counter.maxRetries),
+			retryTime:  time.Duration(atomic.LoadInt64(&counter.retryTime)),
+			errors:     errors,
+			latency:    counter.latency.stats(),
+
+			intendedOps: counter.intended.count(),
+			intended:    counter.intended.stats(),
+		})
+	}
+
+	order := func(name string) int {
+		if op, ok := parseOp(name); ok {
+			return int(op)
+		}
+		return int(numOpTypes)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		oi, oj := order(results[i].name), order(results[j].name)
+		if oi != oj {
+			return oi < oj
+		}
+		return results[i].name < results[j].name
+	})
+	return results
+}
+
+// staleness measures how far behind the latest commit the readers are for
+// -staleness. Every write transaction bumps the sequence in writeSeq and
+// publishes it once committed, every read returns the sequence its snapshot
+// sees as an extra column to check against the latest one published.
+type staleness struct {
+	committed int64
+
+	mu      sync.Mutex
+	samples []int64
+}
+
+// commit publishes seq once the transaction that wrote it has committed
+func (s *staleness) commit(seq int64) {
+	storeMax(&s.committed, seq)
+}
+
+// latest returns the newest sequence known to be committed
+func (s *staleness) latest() int64 {
+	return atomic.LoadInt64(&s.committed)
+}
+
+// add records a read that saw sequence seen while latest was committed
+func (s *staleness) add(seen, latest int64) {
+	behind := latest - seen
+	if behind < 0 {
+		// the write was visible before its writer got to publish it
+		behind = 0
+	}
+	s.mu.Lock()
+	s.samples = append(s.samples, behind)
+	s.mu.Unlock()
+}
+
+// staleRead follows the sequences seen by the rows of one read
+type staleRead struct {
+	s    *staleness
+	seen int64
+	rows bool
+}
+
+func (s *staleness) read() *staleRead {
+	return &staleRead{s: s}
+}
+
+// row takes the sequence from the last column of row
+func (r *staleRead) row(row []interface{}) error {
+	seq, ok := row[len(row)-1].(int64)
+	if !ok {
+		return fmt.Errorf("staleness: expected an integer sequence, got %T", row[len(row)-1])
+	}
+	if !r.rows || seq < r.seen {
+		r.seen = seq
+	}
+	r.rows = true
+	return nil
+}
+
+// done records the read once its query succeeded, a read that found no rows
+// saw no sequence
+func (r *staleRead) done() {
+	if r.rows {
+		r.s.add(r.seen, r.s.latest())
+	}
+}
+
+// reset drops the samples taken during the warmup
+func (s *staleness) reset() {
+	s.mu.Lock()
+	s.samples = nil
+	s.mu.Unlock()
+}
+
+// stalenessStats summarises how many writes behind the reads were
+type stalenessStats struct {
+	reads, stale  int
+	avg           float64
+	p50, p99, max int64
+}
+
+func (s *staleness) stats() stalenessStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	samples := s.samples
+	if len(samples) == 0 {
+		return stalenessStats{}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	stats := stalenessStats{reads: len(samples), max: samples[len(samples)-1]}
+	var total int64
+	for _, behind := range samples {
+		total += behind
+		if behind > 0 {
+			stats.stale++
+		}
+	}
+	at := func(p int) int64 {
+		i := (len(samples)*p+99)/100 - 1
+		if i < 0 {
+			i = 0
+		}
+		return samples[i]
+	}
+	stats.avg = float64(total) / float64(len(samples))
+	stats.p50, stats.p99 = at(50), at(99)
+	return stats
+}
+
+func (s stalenessStats) print() {
+	var stale float64
+	if s.reads > 0 {
+		stale = 100 * float64(s.stale) / float64(s.reads)
+	}
+	fmt.Printf("Staleness: %d reads, %.1f%% stale, writes behind avg %.2f, p50 %d, p99 %d, max %d\n",
+		s.reads, stale, s.avg, s.p50, s.p99, s.max)
+}
+
+// spread is how evenly ops were shared out between the goroutines of one
+// kind, a locker or pool that starves some of them shows a wide spread
+type spread struct {
+	workers  int
+	min, max int64
+	mean     float64
+	stddev   float64
+}
+
+func spreadOf(ops []int64) spread {
+	if len(ops) == 0 {
+		return spread{}
+	}
+	s := spread{workers: len(ops), min: ops[0], max: ops[0]}
+	var total int64
+	for _, n := range ops {
+		total += n
+		if n < s.min {
+			s.min = n
+		}
+		if n > s.max {
+			s.max = n
+		}
+	}
+	s.mean = float64(total) / float64(len(ops))
+
+	var squares float64
+	for _, n := range ops {
+		d := float64(n) - s.mean
+		squares += d * d
+	}
+	s.stddev = math.Sqrt(squares / float64(len(ops)))
+	return s
+}
+
+func (s spread) String() string {
+	var cv float64
+	if s.mean > 0 {
+		cv = 100 * s.stddev / s.mean
+	}
+	return fmt.Sprintf("min %d, max %d, stddev %.1f (%.1f%% of mean)", s.min, s.max, s.stddev, cv)
+}
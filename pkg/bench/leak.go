@@ -0,0 +1,105 @@
+package bench
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// leakWindows is how many checks in a row the heap or the goroutines have to
+// keep growing for before -leak-check warns
+const leakWindows = 5
+
+// leakBytesPerOp is the live heap every measured op is allowed to add. The
+// run keeps a latency sample of every op, in slices that grow by doubling,
+// so a heap that only grows by that much is not leaking.
+const leakBytesPerOp = 16
+
+// leakDetector checks the live heap and the goroutines every interval on soak
+// runs. A locker or workload that leaks, a rows iterator that is never
+// closed say, keeps growing them for as long as the run goes.
+type leakDetector struct {
+	interval time.Duration
+
+	mu sync.Mutex
+
+	// heap is the live heap less the allowance for the ops completed by
+	// then, goroutines the number running
+	heap, goroutines []int64
+	warnings         int
+
+	// firstHeap and lastHeap are the live heap at the first and last check
+	firstHeap, lastHeap int64
+
+	// heapWarned and goroutinesWarned are the checks that last warned, a
+	// streak of growth warns once every leakWindows checks
+	heapWarned, goroutinesWarned int
+}
+
+// check collects garbage first, so the heap is what is still in use. ops is
+// how many ops were measured so far.
+func (l *leakDetector) check(ops int64) {
+	runtime.GC()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	goroutines := runtime.NumGoroutine()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.heap) == 0 {
+		l.firstHeap = int64(mem.HeapAlloc)
+	}
+	l.lastHeap = int64(mem.HeapAlloc)
+	l.heap = append(l.heap, int64(mem.HeapAlloc)-ops*leakBytesPerOp)
+	l.goroutines = append(l.goroutines, int64(goroutines))
+
+	n := len(l.heap)
+	if n > leakWindows && n-l.heapWarned > leakWindows && growing(l.heap[n-leakWindows-1:]) {
+		l.warnings++
+		l.heapWarned = n
+		fmt.Printf("\nPossible leak: live heap grew by %d bytes more than the ops account for over the last %d checks\n",
+			l.heap[n-1]-l.heap[n-leakWindows-1], leakWindows)
+	}
+	if n > leakWindows && n-l.goroutinesWarned > leakWindows && growing(l.goroutines[n-leakWindows-1:]) {
+		l.warnings++
+		l.goroutinesWarned = n
+		fmt.Printf("\nPossible leak: goroutines kept growing over the last %d checks, from %d to %d\n",
+			leakWindows, l.goroutines[n-leakWindows-1], l.goroutines[n-1])
+	}
+}
+
+// growing is true when no sample is smaller than the one before it and the
+// last is larger than the first
+func growing(samples []int64) bool {
+	for i := 1; i < len(samples); i++ {
+		if samples[i] < samples[i-1] {
+			return false
+		}
+	}
+	return samples[len(samples)-1] > samples[0]
+}
+
+// leakResult is what the checks of one run saw
+type leakResult struct {
+	checks                      int
+	firstHeap, lastHeap         int64
+	firstRoutines, lastRoutines int64
+	warnings                    int
+}
+
+func (l *leakDetector) result() leakResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r := leakResult{checks: len(l.heap), warnings: l.warnings}
+	if r.checks > 0 {
+		r.firstHeap, r.lastHeap = l.firstHeap, l.lastHeap
+		r.firstRoutines, r.lastRoutines = l.goroutines[0], l.goroutines[r.checks-1]
+	}
+	return r
+}
+
+func (r leakResult) print() {
+	fmt.Printf("Leak checks: %d, live heap %d to %d bytes, goroutines %d to %d, %d warnings\n",
+		r.checks, r.firstHeap, r.lastHeap, r.firstRoutines, r.lastRoutines, r.warnings)
+}
@@ -0,0 +1,56 @@
+package bench
+
+import (
+	"fmt"
+	"time"
+)
+
+// maintenance is a one off job run partway through the test while readers
+// and writers carry on, like building an index
+type maintenance struct {
+	name string
+
+	// at is how long after measuring starts the job runs
+	at time.Duration
+
+	// stmts are run by a writer holding the write lock, more than one are
+	// wrapped in a transaction
+	stmts []statement
+}
+
+// maintenanceResult is how a maintenance job went and what it did to the
+// rest of the workload while it ran
+type maintenanceResult struct {
+	name string
+
+	// ran is false when the test finished before the job was due
+	ran bool
+
+	took    time.Duration
+	retries int
+
+	// opsDuring counts the reads and writes that completed while the job was
+	// running, retriesDuring their failed attempts
+	opsDuring     int64
+	retriesDuring int64
+
+	// longestGap is the longest time no read or write completed while the
+	// job was running, the downtime it caused
+	longestGap time.Duration
+}
+
+func (m maintenanceResult) print(overall float64) {
+	if !m.ran {
+		fmt.Printf("%s: not run, the test finished first\n", m.name)
+		return
+	}
+
+	during := 0.0
+	if m.took > 0 {
+		during = float64(m.opsDuring) / m.took.Seconds()
+	}
+	fmt.Printf("%s: took %v, retries %d, %d ops completed meanwhile (%.0f/sec, %.0f/sec overall)\n",
+		m.name, m.took.Round(time.Microsecond), m.retries, m.opsDuring, during, overall)
+	fmt.Printf("%s: %d worker retries meanwhile, longest gap without a completed op %v\n",
+		m.name, m.retriesDuring, m.longestGap.Round(time.Microsecond))
+}
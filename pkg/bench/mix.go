@@ -0,0 +1,195 @@
+package bench
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// opType is a kind of statement a worker runs
+type opType int
+
+const (
+	opRead opType = iota
+	opUpdate
+	opInsert
+	opDelete
+	opUpsert
+	opRetain
+	opRMW
+	opIncrement
+	opEnqueue
+	opClaim
+	opAppend
+	opRecent
+	opPoll
+	opReturning
+	opBox
+	opBBox
+	opFlip
+	opSavepoint
+	opCross
+	opFileRead
+	opFileWrite
+	opVRead
+	opVUpdate
+	opSnapshot
+
+	numOpTypes
+)
+
+var opNames = [numOpTypes]string{"read", "update", "insert", "delete", "upsert", "retain", "rmw", "increment", "enqueue", "claim", "append", "recent", "poll", "returning", "box", "bbox", "flip", "savepoint", "cross", "fileread", "filewrite", "vread", "vupdate", "snapshot"}
+
+func (op opType) String() string {
+	return opNames[op]
+}
+
+// code is the ASCII art printed after op succeeds
+func (op opType) code() string {
+	switch op {
+	case opRead, opRecent, opBBox, opFileRead, opVRead, opSnapshot:
+		return SELECT_CODE
+	case opInsert:
+		return INSERT_CODE
+	case opDelete:
+		return DELETE_CODE
+	case opUpsert:
+		return UPSERT_CODE
+	case opRetain:
+		return RETAIN_CODE
+	case opRMW:
+		return RMW_CODE
+	case opIncrement:
+		return INCREMENT_CODE
+	case opEnqueue:
+		return ENQUEUE_CODE
+	case opClaim:
+		return CLAIM_CODE
+	case opAppend:
+		return APPEND_CODE
+	case opPoll:
+		return POLL_CODE
+	case opReturning:
+		return RETURNING_CODE
+	case opBox:
+		return BOX_CODE
+	case opFlip:
+		return FLIP_CODE
+	case opSavepoint:
+		return SAVEPOINT_CODE
+	case opCross:
+		return CROSS_CODE
+	default:
+		return WRITE_CODE
+	}
+}
+
+// retryCode is the ASCII art printed when op has to be retried
+func (op opType) retryCode() string {
+	if op.isRead() {
+		return SELECT_RETRY_CODE
+	}
+	return WRITE_RETRY_CODE
+}
+
+// isRead is true for ops that only read and take the read lock
+func (op opType) isRead() bool {
+	return op == opRead || op == opRecent || op == opPoll || op == opBBox || op == opFileRead || op == opVRead || op == opSnapshot
+}
+
+// mix is a weighted choice of operations, ie: read=80,update=15,insert=4,delete=1
+type mix struct {
+	weights [numOpTypes]int
+	total   int
+}
+
+// singleOp returns a mix that always picks op
+func singleOp(op opType) mix {
+	var m mix
+	m.weights[op] = 1
+	m.total = 1
+	return m
+}
+
+// parseOp returns the op called name
+func parseOp(name string) (opType, bool) {
+	for i, n := range opNames {
+		if n == name {
+			return opType(i), true
+		}
+	}
+	return 0, false
+}
+
+// parseMix parses a comma separated list of op=weight
+func parseMix(spec string) (mix, error) {
+	var m mix
+	for _, part := range strings.Split(spec, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return m, fmt.Errorf("invalid mix entry %q, expecting op=weight", part)
+		}
+
+		op, ok := parseOp(kv[0])
+		if !ok {
+			return m, fmt.Errorf("unknown mix op %q, expecting one of [%s]", kv[0], strings.Join(opNames[:], ", "))
+		}
+
+		weight, err := strconv.Atoi(kv[1])
+		if err != nil || weight < 0 {
+			return m, fmt.Errorf("invalid weight for %s: %q", kv[0], kv[1])
+		}
+		m.weights[op] += weight
+		m.total += weight
+	}
+
+	if m.total == 0 {
+		return m, fmt.Errorf("mix %q has no weight", spec)
+	}
+	return m, nil
+}
+
+// has is true when op has a weight in the mix
+func (m mix) has(op opType) bool {
+	return m.weights[op] > 0
+}
+
+// only returns true if every op with a weight is one of ops
+func (m mix) only(ops ...opType) bool {
+	for op, weight := range m.weights {
+		if weight == 0 {
+			continue
+		}
+
+		found := false
+		for _, o := range ops {
+			found = found || o == opType(op)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// pick chooses an op according to the weights
+func (m mix) pick() opType {
+	n := random.Intn(m.total)
+	for op, weight := range m.weights {
+		if n < weight {
+			return opType(op)
+		}
+		n -= weight
+	}
+	return opRead // not reached, weights add up to total
+}
+
+func (m mix) String() string {
+	var parts []string
+	for op, weight := range m.weights {
+		if weight > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", opType(op), weight))
+		}
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,62 @@
+package bench
+
+import "testing"
+
+func TestParseMix(t *testing.T) {
+	tests := []struct {
+		spec  string
+		want  string
+		total int
+	}{
+		{"read=1", "read=1", 1},
+		{"read=3,update=1", "read=3,update=1", 4},
+		{" update=1 , read=3 ", "read=3,update=1", 4},
+		{"read=1,read=2", "read=3", 3},
+		{"read=0,insert=5", "insert=5", 5},
+		{"fileread=1,filewrite=1,snapshot=2", "fileread=1,filewrite=1,snapshot=2", 4},
+	}
+	for _, tt := range tests {
+		m, err := parseMix(tt.spec)
+		if err != nil {
+			t.Errorf("parseMix(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := m.String(); got != tt.want {
+			t.Errorf("parseMix(%q) = %s, want %s", tt.spec, got, tt.want)
+		}
+		if m.total != tt.total {
+			t.Errorf("parseMix(%q) total = %d, want %d", tt.spec, m.total, tt.total)
+		}
+	}
+}
+
+func TestParseMixInvalid(t *testing.T) {
+	for _, spec := range []string{"", "read", "read=", "read=x", "read=-1", "bogus=1", "read=0", "read=1,"} {
+		if m, err := parseMix(spec); err == nil {
+			t.Errorf("parseMix(%q) = %s, want an error", spec, m)
+		}
+	}
+}
+
+func TestMixPick(t *testing.T) {
+	m, err := parseMix("read=1,delete=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[opType]int)
+	for i := 0; i < 1000; i++ {
+		counts[m.pick()]++
+	}
+	if counts[opRead]+counts[opDelete] != 1000 {
+		t.Errorf("picked ops outside the mix: %v", counts)
+	}
+	if counts[opRead] == 0 || counts[opDelete] == 0 {
+		t.Errorf("never picked one of the ops: %v", counts)
+	}
+	if !m.has(opDelete) || m.has(opUpdate) {
+		t.Errorf("has disagrees with the mix %s", m)
+	}
+	if !m.only(opRead, opDelete, opInsert) || m.only(opRead) {
+		t.Errorf("only disagrees with the mix %s", m)
+	}
+}
@@ -0,0 +1,52 @@
+package bench
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket says when each unit of work handed to the writers, or each
+// read paced by -read-rate, is due, rate of them a second. It holds up to
+// burst tokens: after the workers fell behind, at most burst units are due at
+// once and the ones that would have been due before them are dropped. A
+// burst of 0 holds every token, so every unit stays due on its schedule
+// however far behind the workers are.
+type tokenBucket struct {
+	interval time.Duration
+	burst    int
+
+	// now is the clock, time.Now outside of tests
+	now func() time.Time
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newTokenBucket(rate, burst int) *tokenBucket {
+	b := &tokenBucket{interval: time.Second / time.Duration(rate), burst: burst, now: time.Now}
+	b.reset()
+	return b
+}
+
+// reset empties the bucket, the next unit is due now
+func (b *tokenBucket) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.next = b.now()
+}
+
+// take returns when the next unit is due, it is up to the caller to wait
+// until then
+func (b *tokenBucket) take() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.burst > 0 {
+		earliest := b.now().Add(-time.Duration(b.burst-1) * b.interval)
+		if b.next.Before(earliest) {
+			b.next = earliest
+		}
+	}
+	due := b.next
+	b.next = b.next.Add(b.interval)
+	return due
+}
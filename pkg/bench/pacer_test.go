@@ -0,0 +1,69 @@
+package bench
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when told to
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+// newFakeBucket returns a bucket of rate and burst on a fake clock
+func newFakeBucket(rate, burst int) (*tokenBucket, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	b := newTokenBucket(rate, burst)
+	b.now = clock.now
+	b.reset()
+	return b, clock
+}
+
+func TestTokenBucketSchedule(t *testing.T) {
+	b, clock := newFakeBucket(100, 0)
+	start := clock.t
+	for i := 0; i <= 5; i++ {
+		if due, want := b.take(), start.Add(time.Duration(i)*10*time.Millisecond); !due.Equal(want) {
+			t.Errorf("take %d due %v after the start, want %v", i, due.Sub(start), want.Sub(start))
+		}
+	}
+}
+
+func TestTokenBucketBehind(t *testing.T) {
+	tests := []struct {
+		burst int
+
+		// want is how far before now the first unit is due, after the
+		// workers fell a second behind
+		want time.Duration
+	}{
+		{0, time.Second},
+		{1, 0},
+		{3, 20 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		b, clock := newFakeBucket(100, tt.burst)
+		clock.t = clock.t.Add(time.Second)
+
+		if behind := clock.t.Sub(b.take()); behind != tt.want {
+			t.Errorf("burst %d: first unit due %v ago, want %v", tt.burst, behind, tt.want)
+		}
+		// the units after it follow on the schedule again
+		if behind := clock.t.Sub(b.take()); behind != tt.want-10*time.Millisecond {
+			t.Errorf("burst %d: second unit due %v ago, want %v", tt.burst, behind, tt.want-10*time.Millisecond)
+		}
+	}
+}
+
+func TestTokenBucketReset(t *testing.T) {
+	b, clock := newFakeBucket(10, 0)
+	clock.t = clock.t.Add(time.Hour)
+	b.reset()
+	if due := b.take(); !due.Equal(clock.t) {
+		t.Errorf("first unit after reset due %v ago, want now", clock.t.Sub(due))
+	}
+}
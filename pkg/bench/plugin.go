@@ -0,0 +1,26 @@
+package bench
+
+import (
+	"fmt"
+	"plugin"
+	"strings"
+
+	"github.com/mostlygeek/go-sqlite3-locking/pkg/lockers"
+	"github.com/mostlygeek/go-sqlite3-locking/pkg/workloads"
+)
+
+// loadPlugin opens a Go plugin built with -buildmode=plugin. Its init
+// functions register workloads and lockers with the workloads and lockers
+// packages, which makes them available to -workload and -type.
+func loadPlugin(path string) error {
+	beforeWorkloads, beforeLockers := workloads.Names(), lockers.Names()
+	if _, err := plugin.Open(path); err != nil {
+		return err
+	}
+	workloadNames, lockerNames := workloads.Names(), lockers.Names()
+	if len(workloadNames) == len(beforeWorkloads) && len(lockerNames) == len(beforeLockers) {
+		return fmt.Errorf("%s did not register any workloads or lockers", path)
+	}
+	fmt.Printf("Loaded plugin %s, workloads: [%s], lockers: [%s]\n", path, strings.Join(workloadNames, ", "), strings.Join(lockerNames, ", "))
+	return nil
+}
@@ -0,0 +1,101 @@
+package bench
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// poolSampler watches the database/sql connection pools during a run. Time
+// spent waiting for a pooled connection shows up as op latency just like
+// waiting on sqlite's locks, so it is reported separately.
+type poolSampler struct {
+	names []string
+	dbs   []*sql.DB
+
+	mu      sync.Mutex
+	start   []sql.DBStats
+	peakUse []int
+}
+
+// newPoolSampler samples db, and readDB when it is a handle of its own
+func newPoolSampler(db, readDB *sql.DB) *poolSampler {
+	p := &poolSampler{names: []string{"pool"}, dbs: []*sql.DB{db}}
+	if readDB != db {
+		p.names = append(p.names, "read pool")
+		p.dbs = append(p.dbs, readDB)
+	}
+	p.reset()
+	return p
+}
+
+// reset starts counting waits from now, like after the warm up
+func (p *poolSampler) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.start = make([]sql.DBStats, len(p.dbs))
+	p.peakUse = make([]int, len(p.dbs))
+	for i, db := range p.dbs {
+		p.start[i] = db.Stats()
+	}
+}
+
+// sample records how many connections are in use right now
+func (p *poolSampler) sample() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, db := range p.dbs {
+		if inUse := db.Stats().InUse; inUse > p.peakUse[i] {
+			p.peakUse[i] = inUse
+		}
+	}
+}
+
+// poolResult is what one pool's stats changed by during the run
+type poolResult struct {
+	name           string
+	maxOpen        int
+	open, idle     int
+	peakUse        int
+	waits          int64
+	waited         time.Duration
+	closedIdle     int64
+	closedLifetime int64
+}
+
+func (p *poolSampler) results() []poolResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	results := make([]poolResult, len(p.dbs))
+	for i, db := range p.dbs {
+		stats := db.Stats()
+		results[i] = poolResult{
+			name:           p.names[i],
+			maxOpen:        stats.MaxOpenConnections,
+			open:           stats.OpenConnections,
+			idle:           stats.Idle,
+			peakUse:        p.peakUse[i],
+			waits:          stats.WaitCount - p.start[i].WaitCount,
+			waited:         stats.WaitDuration - p.start[i].WaitDuration,
+			closedIdle:     stats.MaxIdleClosed - p.start[i].MaxIdleClosed,
+			closedLifetime: stats.MaxLifetimeClosed - p.start[i].MaxLifetimeClosed,
+		}
+	}
+	return results
+}
+
+func (r poolResult) print() {
+	limit := "unlimited"
+	if r.maxOpen > 0 {
+		limit = fmt.Sprint(r.maxOpen)
+	}
+	var avg time.Duration
+	if r.waits > 0 {
+		avg = r.waited / time.Duration(r.waits)
+	}
+	fmt.Printf("Connection %s: max open %s, peak in use %d, %d open and %d idle at the end\n", r.name, limit, r.peakUse, r.open, r.idle)
+	fmt.Printf("  %d waits for a connection, %s waiting (avg %s), closed %d idle and %d past their lifetime\n",
+		r.waits, r.waited.Round(time.Microsecond), avg.Round(time.Microsecond), r.closedIdle, r.closedLifetime)
+}
@@ -0,0 +1,106 @@
+//go:build linux
+// +build linux
+
+package bench
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// clockTick is the USER_HZ unit of /proc/stat, 100 on every Linux port
+const clockTick = time.Second / 100
+
+// processCPU returns the user and system CPU time used by this process so far
+func processCPU() (time.Duration, error) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, err
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), nil
+}
+
+// systemCPU returns the time all CPUs spent busy and in total since boot, from
+// the cpu line of /proc/stat. Waiting on I/O counts as idle.
+func systemCPU() (busy, total time.Duration, err error) {
+	data, err := ioutil.ReadFile("/proc/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	line := strings.SplitN(string(data), "\n", 2)[0]
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, fmt.Errorf("unexpected /proc/stat line %q", line)
+	}
+	// guest and guest_nice after steal are already part of user and nice
+	for i, field := range fields[1:] {
+		if i == 8 {
+			break
+		}
+		ticks, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("unexpected /proc/stat line %q", line)
+		}
+		total += time.Duration(ticks) * clockTick
+		// idle and iowait
+		if i != 3 && i != 4 {
+			busy += time.Duration(ticks) * clockTick
+		}
+	}
+	return busy, total, nil
+}
+
+// processIO returns the I/O counters of this process so far, from
+// /proc/self/io
+func processIO() (ioCounters, error) {
+	var c ioCounters
+	data, err := ioutil.ReadFile("/proc/self/io")
+	if err != nil {
+		return c, err
+	}
+	fields := map[string]*int64{
+		"rchar":                 &c.readChars,
+		"wchar":                 &c.writeChars,
+		"syscr":                 &c.readCalls,
+		"syscw":                 &c.writeCalls,
+		"read_bytes":            &c.readBytes,
+		"write_bytes":           &c.writeBytes,
+		"cancelled_write_bytes": &c.cancelledBytes,
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if field, ok := fields[parts[0]]; ok {
+			if *field, err = strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64); err != nil {
+				return c, fmt.Errorf("unexpected /proc/self/io line %q", line)
+			}
+		}
+	}
+	return c, nil
+}
+
+// processUsage returns the resource usage of this process so far, and the
+// file descriptors it has open right now
+func processUsage() (resourceUsage, error) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return resourceUsage{}, err
+	}
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return resourceUsage{}, err
+	}
+	return resourceUsage{
+		// ru_maxrss is in kilobytes on Linux
+		maxRSS:      usage.Maxrss * 1024,
+		voluntary:   usage.Nvcsw,
+		involuntary: usage.Nivcsw,
+		fds:         len(fds),
+	}, nil
+}
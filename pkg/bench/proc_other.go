@@ -0,0 +1,29 @@
+//go:build !linux
+// +build !linux
+
+package bench
+
+import (
+	"errors"
+	"time"
+)
+
+// errProcStats is what reading the process and system counters returns
+// outside of Linux
+var errProcStats = errors.New("only supported on Linux")
+
+func processCPU() (time.Duration, error) {
+	return 0, errProcStats
+}
+
+func systemCPU() (busy, total time.Duration, err error) {
+	return 0, 0, errProcStats
+}
+
+func processIO() (ioCounters, error) {
+	return ioCounters{}, errProcStats
+}
+
+func processUsage() (resourceUsage, error) {
+	return resourceUsage{}, errProcStats
+}
@@ -0,0 +1,330 @@
+package bench
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mostlygeek/go-sqlite3-locking/pkg/workloads"
+)
+
+// recordedArg is one statement argument, exactly one of the values is set
+// unless the argument was NULL
+type recordedArg struct {
+	Name  string   `json:"name,omitempty"`
+	Int   *int64   `json:"int,omitempty"`
+	Float *float64 `json:"float,omitempty"`
+	Text  *string  `json:"text,omitempty"`
+	Blob  []byte   `json:"blob,omitempty"`
+}
+
+func recordArg(v interface{}) recordedArg {
+	var arg recordedArg
+	if named, ok := v.(sql.NamedArg); ok {
+		arg.Name, v = named.Name, named.Value
+	}
+
+	switch v := v.(type) {
+	case int:
+		n := int64(v)
+		arg.Int = &n
+	case int64:
+		arg.Int = &v
+	case float64:
+		arg.Float = &v
+	case string:
+		arg.Text = &v
+	case []byte:
+		arg.Blob = v
+	}
+	return arg
+}
+
+func (a recordedArg) value() interface{} {
+	var v interface{}
+	switch {
+	case a.Int != nil:
+		v = *a.Int
+	case a.Float != nil:
+		v = *a.Float
+	case a.Text != nil:
+		v = *a.Text
+	case a.Blob != nil:
+		v = a.Blob
+	}
+	if a.Name != "" {
+		return sql.Named(a.Name, v)
+	}
+	return v
+}
+
+// recordedStatement is a statement a worker ran, read is set when it was run
+// as a query
+type recordedStatement struct {
+	Query string        `json:"query"`
+	Args  []recordedArg `json:"args,omitempty"`
+	Read  bool          `json:"read,omitempty"`
+}
+
+func recordStatement(s statement, read bool) recordedStatement {
+	r := recordedStatement{Query: s.query, Read: read}
+	for _, arg := range s.args {
+		r.Args = append(r.Args, recordArg(arg))
+	}
+	return r
+}
+
+func (r recordedStatement) statement() statement {
+	s := statement{query: r.Query}
+	for _, arg := range r.Args {
+		s.args = append(s.args, arg.value())
+	}
+	return s
+}
+
+// recordedCall is one call to a worker. Tx is set when the statements ran in
+// worker.tx, otherwise they were a single query or an exec.
+type recordedCall struct {
+	Tx    bool                `json:"tx,omitempty"`
+	Stmts []recordedStatement `json:"stmts"`
+}
+
+// recordedOp is a successful op, At is when it started relative to the start
+// of the run
+type recordedOp struct {
+	At    time.Duration  `json:"at"`
+	Op    string         `json:"op"`
+	Read  bool           `json:"read,omitempty"`
+	Calls []recordedCall `json:"calls"`
+
+	// due is when dispatch meant the op to start
+	due time.Time
+}
+
+// op returns an op running the recorded calls again
+func (r recordedOp) op() workloads.Op {
+	op := workloads.Op{
+		Name: r.Op,
+		Read: r.Read,
+		Run: func(ctx context.Context, c workloads.Conn) error {
+			for _, call := range r.Calls {
+				if err := replayCall(ctx, asWorker(c), call); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	if builtin, ok := parseOp(r.Op); ok {
+		op.Code = builtin.code()
+	}
+	return op
+}
+
+func replayCall(ctx context.Context, w worker, call recordedCall) error {
+	if call.Tx {
+		return w.tx(ctx, func(tx txConn) error {
+			for _, s := range call.Stmts {
+				var err error
+				if s.Read {
+					_, _, err = tx.queryInt(ctx, s.statement())
+				} else {
+					_, err = tx.exec(ctx, s.statement())
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	if len(call.Stmts) == 1 && call.Stmts[0].Read {
+		return w.query(ctx, call.Stmts[0].statement(), nil)
+	}
+	stmts := make([]statement, len(call.Stmts))
+	for i, s := range call.Stmts {
+		stmts[i] = s.statement()
+	}
+	_, err := w.exec(ctx, stmts...)
+	return err
+}
+
+// recordingWorker passes every call through to worker and remembers it
+type recordingWorker struct {
+	worker
+	calls []recordedCall
+}
+
+func (w *recordingWorker) query(ctx context.Context, s statement, fn rowFunc) error {
+	w.calls = append(w.calls, recordedCall{Stmts: []recordedStatement{recordStatement(s, true)}})
+	return w.worker.query(ctx, s, fn)
+}
+
+func (w *recordingWorker) exec(ctx context.Context, stmts ...statement) (int64, error) {
+	call := recordedCall{}
+	for _, s := range stmts {
+		call.Stmts = append(call.Stmts, recordStatement(s, false))
+	}
+	w.calls = append(w.calls, call)
+	return w.worker.exec(ctx, stmts...)
+}
+
+func (w *recordingWorker) tx(ctx context.Context, fn func(txConn) error) error {
+	w.calls = append(w.calls, recordedCall{Tx: true})
+	call := &w.calls[len(w.calls)-1]
+	return w.worker.tx(ctx, func(tx txConn) error {
+		return fn(recordingTx{tx, call})
+	})
+}
+
+// recordingTx remembers the statements run inside a recordingWorker's tx
+type recordingTx struct {
+	txConn
+	call *recordedCall
+}
+
+func (t recordingTx) queryInt(ctx context.Context, s statement) (int64, bool, error) {
+	t.call.Stmts = append(t.call.Stmts, recordStatement(s, true))
+	return t.txConn.queryInt(ctx, s)
+}
+
+func (t recordingTx) exec(ctx context.Context, s statement) (int64, error) {
+	t.call.Stmts = append(t.call.Stmts, recordStatement(s, false))
+	return t.txConn.exec(ctx, s)
+}
+
+// recorder collects the successful ops of a run for -record
+type recorder struct {
+	begin time.Time
+
+	mu  sync.Mutex
+	ops []recordedOp
+}
+
+// start marks the beginning of the run, op times are relative to it
+func (r *recorder) start() {
+	r.begin = time.Now()
+}
+
+func (r *recorder) add(start time.Time, op workloads.Op, calls []recordedCall) {
+	r.mu.Lock()
+	r.ops = append(r.ops, recordedOp{At: start.Sub(r.begin), Op: op.Name, Read: op.Read, Calls: calls})
+	r.mu.Unlock()
+}
+
+// save writes the ops in the order they started, one JSON object per line
+func (r *recorder) save(path string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sort.SliceStable(r.ops, func(i, j int) bool { return r.ops[i].At < r.ops[j].At })
+
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, op := range r.ops {
+		if err := enc.Encode(op); err != nil {
+			f.Close()
+			return 0, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return 0, err
+	}
+	return len(r.ops), f.Close()
+}
+
+// recording is a -record file loaded for -replay
+type recording struct {
+	ops []recordedOp
+}
+
+func loadRecording(path string) (*recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := &recording{}
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for dec.More() {
+		var op recordedOp
+		if err := dec.Decode(&op); err != nil {
+			return nil, fmt.Errorf("%s: op %d: %v", path, len(r.ops)+1, err)
+		}
+		if op.Op == "" {
+			return nil, fmt.Errorf("%s: op %d has no name", path, len(r.ops)+1)
+		}
+		r.ops = append(r.ops, op)
+	}
+	if len(r.ops) == 0 {
+		return nil, fmt.Errorf("%s has no ops", path)
+	}
+	return r, nil
+}
+
+// report prints how many ops the recording holds over how long, and the
+// calls and statements of every kind of op
+func (r *recording) report() {
+	type opTotals struct {
+		ops, calls, stmts int
+	}
+	totals := make(map[string]*opTotals)
+	var names []string
+	for _, op := range r.ops {
+		t, ok := totals[op.Op]
+		if !ok {
+			t = &opTotals{}
+			totals[op.Op] = t
+			names = append(names, op.Op)
+		}
+		t.ops++
+		t.calls += len(op.Calls)
+		for _, call := range op.Calls {
+			t.stmts += len(call.Stmts)
+		}
+	}
+	sort.Strings(names)
+
+	span := r.ops[len(r.ops)-1].At
+	rate := 0.0
+	if span > 0 {
+		rate = float64(len(r.ops)) / span.Seconds()
+	}
+	fmt.Printf("Ops: %d over %s (%.0f/sec)\n", len(r.ops), span.Round(time.Millisecond), rate)
+	for _, name := range names {
+		t := totals[name]
+		fmt.Printf("%-9s:  %d ops, %d calls, %d statements\n", name, t.ops, t.calls, t.stmts)
+	}
+}
+
+// dispatch hands out the ops, reads to readers and everything else to
+// writers, at their recorded times divided by speed. A speed of 0 sends them
+// as fast as they are taken. Both channels are closed at the end.
+func (r *recording) dispatch(speed float64, reads, writes chan<- recordedOp) {
+	begin := time.Now()
+	for _, op := range r.ops {
+		if speed > 0 {
+			op.due = begin.Add(time.Duration(float64(op.At) / speed))
+			time.Sleep(time.Until(op.due))
+		}
+		if op.Read {
+			reads <- op
+		} else {
+			writes <- op
+		}
+	}
+	close(reads)
+	close(writes)
+}
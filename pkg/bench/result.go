@@ -0,0 +1,257 @@
+package bench
+
+import (
+	"fmt"
+	"time"
+)
+
+// testResult is what runTest measured
+type testResult struct {
+	duration time.Duration
+
+	// ops are the counts and latencies of each op
+	ops []opResult
+
+	// skipped counts ops that found nothing to do, like job queue claims
+	// with no new jobs
+	skipped int64
+
+	// zeroRows counts the updates that succeeded without matching a row
+	zeroRows int64
+
+	// readChecks is what -check-reads found, nil without it
+	readChecks *readCheckResult
+
+	// staleness is how many writes behind the reads were, nil without
+	// -staleness
+	staleness *stalenessStats
+
+	// snapshotChecks is what the snapshot ops found, nil without any
+	snapshotChecks *snapshotCheckResult
+
+	// snapshots counts the read snapshots held open by -snapshot-hold,
+	// snapshotWAL is the most the WAL grew while one was held
+	snapshots, snapshotWAL int64
+
+	// dbSize is how the database file grew while measuring
+	dbSize fileSizeResult
+
+	// wal and shm are the sizes of the WAL and its index, all 0 outside of
+	// WAL mode
+	wal, shm fileSizeResult
+
+	// stalls counts the write transactions held open by -stall-hold
+	stalls int64
+
+	// peakWaiting is the most workers waiting on the Go level lock at once
+	peakWaiting int64
+
+	// readers and writers are how evenly the ops were spread across the
+	// reader and writer goroutines
+	readers, writers spread
+
+	// slowStatements counts the statements over -slow-threshold
+	slowStatements int64
+
+	// statements are the -stmt-stats results
+	statements []stmtResult
+
+	// pools are the -pool-stats results
+	pools []poolResult
+
+	// runtime is what -runtime-stats measured, nil without it
+	runtime *runtimeResult
+
+	// cpu is what -cpu-stats measured, nil without it
+	cpu *cpuResult
+
+	// io is what -io-stats measured, nil without it
+	io *ioCounters
+
+	// usage is what -rusage measured, nil without it
+	usage *resourceUsage
+
+	// writeAmp is what -write-amp measured, nil without it
+	writeAmp *writeAmpResult
+
+	// syncs are the syncs -count-syncs counted, nil without it
+	syncs *syncCounts
+
+	// stuck counts the ops -stuck-after reported, cancelled the ones of
+	// them -stuck-cancel gave up on
+	stuck, cancelled int64
+
+	// starvedReaders and starvedWriters count the -starvation-window
+	// windows in which a reader or writer completed nothing
+	starvedReaders, starvedWriters int64
+
+	// errors are the distinct errors seen during the whole run, warm up
+	// and background jobs included
+	errors []errorEntry
+
+	// quickChecks is what -quick-check took and found, nil without it
+	quickChecks *quickCheckResult
+
+	// checkpoints is what -checkpoint-interval measured, nil without it
+	checkpoints *checkpointResult
+
+	// leaks is what -leak-check found, nil without it
+	leaks *leakResult
+
+	// digest is the stateDigest of testData after a -replay, empty without
+	// one, digestRows the rows it covers
+	digest     string
+	digestRows int
+
+	maintenance []maintenanceResult
+}
+
+// perSecond returns how many of n happened each second of the run
+func (r testResult) perSecond(n int64) float64 {
+	if r.duration <= 0 {
+		return 0
+	}
+	return float64(n) / r.duration.Seconds()
+}
+
+// totals returns the read and write ops and the worst p99 latency of the
+// write ops
+func (r testResult) totals() (reads, writes int64, writeP99 time.Duration) {
+	for _, op := range r.ops {
+		if op.read {
+			reads += op.ops
+			continue
+		}
+		writes += op.ops
+		if op.latency.p99 > writeP99 {
+			writeP99 = op.latency.p99
+		}
+	}
+	return reads, writes, writeP99
+}
+
+func (r testResult) print() {
+	fmt.Println("Duration: ", r.duration)
+	var reads, writes opResult
+	for _, op := range r.ops {
+		if op.ops == 0 {
+			continue
+		}
+		retries := fmt.Sprint("retries ", op.retries)
+		if op.retries > 0 {
+			retries += fmt.Sprintf(" (%.2f/op, max %d in a row, %s retrying, %s)", op.retriesPerOp(), op.maxRetries, op.retryTime.Round(time.Microsecond), op.errors)
+		}
+		fmt.Printf("%-9s:  %d (%.0f/sec) %s, %s\n", op.name, op.ops, r.perSecond(op.ops), retries, op.latency)
+		if op.intendedOps > 0 {
+			fmt.Printf("%-9s   from when due: %s\n", "", op.intended)
+		}
+
+		total := &writes
+		if op.read {
+			total = &reads
+		}
+		total.ops += op.ops
+		total.retries += op.retries
+		total.errors.add(op.errors)
+	}
+	if reads.retries+writes.retries > 0 {
+		fmt.Printf("Retries: reads %d (%.2f/op), writes %d (%.2f/op)\n", reads.retries, reads.retriesPerOp(), writes.retries, writes.retriesPerOp())
+		if reads.retries > 0 {
+			fmt.Println("Read errors: ", reads.errors)
+		}
+		if writes.retries > 0 {
+			fmt.Println("Write errors: ", writes.errors)
+		}
+	}
+	if len(r.errors) > 0 {
+		printErrors(r.errors)
+	}
+	if r.readers.workers > 1 {
+		fmt.Println("Ops per reader: ", r.readers)
+	}
+	if r.writers.workers > 1 {
+		fmt.Println("Ops per writer: ", r.writers)
+	}
+	if len(r.statements) > 0 {
+		printStmtResults(r.statements)
+	}
+	if r.slowStatements > 0 {
+		fmt.Println("Slow statements: ", r.slowStatements)
+	}
+	if r.stuck > 0 {
+		fmt.Printf("Stuck ops: %d, %d cancelled\n", r.stuck, r.cancelled)
+	}
+	if r.starvedReaders+r.starvedWriters > 0 {
+		fmt.Printf("Starved windows: readers %d, writers %d\n", r.starvedReaders, r.starvedWriters)
+	}
+	if r.skipped > 0 {
+		fmt.Println("Skipped ops: ", r.skipped)
+	}
+	if r.zeroRows > 0 {
+		fmt.Println("Zero row updates: ", r.zeroRows)
+	}
+	if r.readChecks != nil {
+		r.readChecks.print()
+	}
+	if r.staleness != nil {
+		r.staleness.print()
+	}
+	if r.snapshotChecks != nil {
+		r.snapshotChecks.print()
+	}
+	if r.snapshots > 0 {
+		fmt.Println("Snapshots held: ", r.snapshots)
+		if r.wal.peak > 0 {
+			fmt.Println("WAL growth per snapshot: ", r.snapshotWAL)
+		}
+	}
+	fmt.Printf("Database size:  start %d, %s, grew %d (%.0f/sec)\n", r.dbSize.start, r.dbSize, r.dbSize.growth(), r.perSecond(r.dbSize.growth()))
+	if r.wal.peak > 0 {
+		fmt.Println("WAL size: ", r.wal)
+	}
+	if r.shm.peak > 0 {
+		fmt.Println("WAL index size: ", r.shm)
+	}
+	if r.stalls > 0 {
+		fmt.Println("Write stalls: ", r.stalls)
+	}
+	for _, pool := range r.pools {
+		pool.print()
+	}
+	if r.runtime != nil {
+		r.runtime.print(reads.ops + writes.ops)
+	}
+	if r.leaks != nil {
+		r.leaks.print()
+	}
+	if r.cpu != nil {
+		r.cpu.print()
+	}
+	if r.io != nil {
+		r.io.print(reads.ops, writes.ops)
+	}
+	if r.usage != nil {
+		r.usage.print(reads.ops + writes.ops)
+	}
+	if r.writeAmp != nil {
+		r.writeAmp.print()
+	}
+	if r.syncs != nil {
+		r.syncs.print(writes.ops)
+	}
+	if r.checkpoints != nil {
+		r.checkpoints.print()
+	}
+	if r.quickChecks != nil {
+		r.quickChecks.print()
+	}
+	fmt.Println("Peak lock queue: ", r.peakWaiting)
+
+	var total int64
+	for _, op := range r.ops {
+		total += op.ops
+	}
+	for _, m := range r.maintenance {
+		m.print(r.perSecond(total))
+	}
+}
@@ -0,0 +1,896 @@
+package bench
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/mostlygeek/go-sqlite3-locking/pkg/dsn"
+	"github.com/mostlygeek/go-sqlite3-locking/pkg/lockers"
+	"github.com/mostlygeek/go-sqlite3-locking/pkg/workloads"
+)
+
+// runner runs the test once for every table form, statement cache size and
+// iteration of a benchmark, each time against a fresh database
+type runner struct {
+	f *benchFlags
+
+	// udfName and collationName are the SQL names of -udf and -collation
+	udfName, collationName string
+
+	connect *connectConfig
+	driver  *sqlite3.SQLiteDriver
+
+	// replay is the -replay recording, nil when not replaying
+	replay *recording
+
+	// cacheSweep keeps the throughput and statement cache hit rate of each
+	// -stmt-cache size, in the order they ran
+	cacheSweep []cacheSweepResult
+
+	// corrupt is set when a run's database fails its integrity checks, the
+	// database is kept and the benchmark fails
+	corrupt bool
+}
+
+// cacheSweepResult is the outcome of a -raw run with one -stmt-cache size
+type cacheSweepResult struct {
+	form      string
+	cacheSize int
+	perSecond float64
+	hitRate   float64
+}
+
+// database is the file a single run works on and the handles its readers and
+// writers use
+type database struct {
+	filename string
+
+	// attach is the attach workload's second database, empty without it
+	attach string
+
+	// db is the read/write handle, readers share it unless readOnly gives
+	// them their own readDB
+	db, readDB         *sql.DB
+	source, readSource string
+	readOnly           bool
+	readPool           poolConfig
+}
+
+// newRunner checks the flags that stay the same for every run and registers
+// the driver the runs open their databases with
+func newRunner(f *benchFlags) (*runner, bool) {
+	r := &runner{f: f}
+	var err error
+	if r.udfName, err = udfFunc(f.udf); err != nil {
+		fmt.Println("Invalid -udf:", err)
+		return nil, false
+	}
+	if r.collationName, err = collationFunc(f.collation); err != nil {
+		fmt.Println("Invalid -collation:", err)
+		return nil, false
+	}
+	if f.readPattern == readTag && r.collationName == "" {
+		fmt.Println("-read-pattern tag requires -collation")
+		return nil, false
+	}
+	r.connect = &connectConfig{udf: f.udf == udfGo, collation: f.collation == collationGo}
+	r.driver = registerDriver(driverName, r.connect)
+
+	if f.replayFilename != "" {
+		if r.replay, err = loadRecording(f.replayFilename); err != nil {
+			fmt.Println("Invalid -replay:", err)
+			return nil, false
+		}
+		if f.readerCount < 1 || f.writerCount < 1 {
+			fmt.Println("-replay needs at least one reader and one writer")
+			return nil, false
+		}
+		if f.replaySpeed < 0 {
+			fmt.Println("-replay-speed can not be negative")
+			return nil, false
+		}
+	}
+	return r, true
+}
+
+// run creates a fresh database with tables in the given form and runs the
+// test against it with raw workers caching cacheSize statements, false
+// means it could not be set up
+func (r *runner) run(form string, cacheSize int) (testResult, bool) {
+	d, ok := r.open()
+	if !ok {
+		return testResult{}, false
+	}
+	defer r.close(d)
+
+	info, err := sqliteBuildInfo(d.db)
+	if err != nil {
+		fmt.Println("Failed to read sqlite build info, ", err)
+		return testResult{}, false
+	}
+	info.print()
+	fmt.Println("Seed:", seedRandom(r.f.seed))
+
+	tableSchema, ok := r.schema(form, info)
+	if !ok {
+		return testResult{}, false
+	}
+
+	var file *workloadFile
+	if r.f.workloadFilename != "" {
+		if file, err = loadWorkloadFile(r.f.workloadFilename); err != nil {
+			fmt.Println("Invalid -workload-file:", err)
+			return testResult{}, false
+		}
+	}
+
+	readerMix, writerMix, ok := r.mixes(d, file, info)
+	if !ok {
+		return testResult{}, false
+	}
+	config, script, ok := r.newTestConfig(d, tableSchema, file, readerMix, writerMix)
+	if !ok || !r.setup(&config, d.db, script) {
+		return testResult{}, false
+	}
+
+	stmtStats := &stmtCacheStats{}
+	newWorker := sqlWorkers(d.db, d.readDB, r.f.connPerWorker, r.f.prepared)
+	if r.f.raw {
+		newWorker = rawWorkers(r.driver, d.source, d.readSource, cacheSize, stmtStats)
+	}
+	if r.f.sqlVariants > 1 {
+		newWorker = variantWorkers(newWorker, r.f.sqlVariants)
+	}
+
+	r.describe(d, config, file, script, cacheSize)
+
+	// only count the calls made by the test, not by the setup
+	atomic.StoreInt64(&r.connect.udfCalls, 0)
+	atomic.StoreInt64(&r.connect.collationCalls, 0)
+
+	locker, ok := r.newLocker()
+	if !ok {
+		return testResult{}, false
+	}
+	result, err := runTest(newWorker, config, locker)
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		return testResult{}, false
+	}
+	fmt.Println()
+	fmt.Println()
+	result.print()
+	if r.connect.udf {
+		calls := atomic.LoadInt64(&r.connect.udfCalls)
+		fmt.Printf("UDF calls: %d (%.0f/sec)\n", calls, result.perSecond(calls))
+	}
+	if err := checkIntegrity(d.db); err != nil {
+		fmt.Println(err)
+		r.corrupt = true
+		return testResult{}, false
+	}
+	if r.replay != nil {
+		digest, rows, err := stateDigest(d.db)
+		if err != nil {
+			fmt.Println("Failed to digest testData:", err)
+			return testResult{}, false
+		}
+		fmt.Printf("State digest: %s (%d rows)\n", digest, rows)
+		result.digest, result.digestRows = digest, rows
+	}
+	if r.connect.collation {
+		calls := atomic.LoadInt64(&r.connect.collationCalls)
+		fmt.Printf("Collation calls: %d (%.0f/sec)\n", calls, result.perSecond(calls))
+	}
+	if r.f.raw {
+		fmt.Printf("Statement cache: %.1f%% hits, %d prepares\n", stmtStats.hitRate(), atomic.LoadInt64(&stmtStats.misses))
+
+		var total int64
+		for _, op := range result.ops {
+			total += op.ops
+		}
+		r.cacheSweep = append(r.cacheSweep, cacheSweepResult{form, cacheSize, result.perSecond(total), stmtStats.hitRate()})
+	}
+
+	if config.recorder != nil {
+		n, err := config.recorder.save(r.f.recordFilename)
+		if err != nil {
+			fmt.Println("Failed to write -record file, ", err)
+			return testResult{}, false
+		}
+		fmt.Println("Recorded", n, "ops to", r.f.recordFilename)
+	}
+	return result, true
+}
+
+// open creates the database file of a run and opens the handles its readers
+// and writers use, close removes it again
+func (r *runner) open() (*database, bool) {
+	connect := r.connect
+	connect.pragmas = r.f.pragmas
+	// -wal is read here rather than once, compare runs with and without.
+	// It goes in the DSN, go-sqlite3 sets the journal mode before the
+	// ConnectHook runs and would take a WAL database back to DELETE.
+	var journalMode string
+	if r.f.walMode {
+		journalMode = dsn.JournalWAL
+	}
+	connect.auxJournalMode = journalMode
+
+	var filename string
+	if r.f.walMode {
+		filename = fmt.Sprintf("db-wal-%d.db", time.Now().UnixNano())
+	} else {
+		filename = fmt.Sprintf("db-%d.db", time.Now().UnixNano())
+	}
+
+	if info, err := os.Stat(r.f.dbDir); err != nil {
+		fmt.Println("Invalid -db-dir:", err)
+		return nil, false
+	} else if !info.IsDir() {
+		fmt.Println("Invalid -db-dir:", r.f.dbDir, "is not a directory")
+		return nil, false
+	}
+	filename = filepath.Join(r.f.dbDir, filename)
+
+	// the attach workload's second database sits next to the first
+	connect.attach = ""
+	if r.f.workloadType == workloadAttach {
+		connect.attach = strings.TrimSuffix(filename, ".db") + "-aux.db"
+	}
+
+	// the vtab workload's rows live in Go, fresh for every run
+	connect.vtab = nil
+	if r.f.workloadType == workloadVTab {
+		if !vtabSupported {
+			fmt.Println("-workload vtab needs a build with -tags vtable")
+			return nil, false
+		}
+		connect.vtab = newVTabStore(r.f.numRows)
+	}
+
+	dbConfig := dsn.Config{
+		Filename:    filename,
+		Mutex:       r.f.openMutex,
+		TxLock:      r.f.txLock,
+		JournalMode: journalMode,
+	}
+	if r.f.sharedCache {
+		dbConfig.Cache = dsn.CacheShared
+	}
+	if r.f.countSyncs {
+		if err := registerSyncVFS(); err != nil {
+			fmt.Println("-count-syncs:", err)
+			return nil, false
+		}
+		dbConfig.VFS = syncVFSName
+	}
+	dataSource, err := dsn.BuildDSN(dbConfig)
+	if err != nil {
+		fmt.Println(err)
+		return nil, false
+	}
+
+	if r.f.immutable && !r.f.readOnly && !r.f.splitPools {
+		fmt.Println("-immutable requires -readonly-readers")
+		return nil, false
+	}
+
+	d := &database{filename: filename, attach: connect.attach, readOnly: r.f.readOnly}
+
+	// split pools is the common production setup: every write goes through
+	// one connection so writers never fight over the sqlite write lock, and
+	// readers get a read only connection each
+	pool := r.f.pool
+	readPool := pool
+	if r.f.connPerWorker {
+		if r.f.splitPools {
+			fmt.Println("-conn-per-worker can not be combined with -split-pools")
+			return nil, false
+		}
+		// every worker holds a connection for the whole run, so the pool
+		// must be able to hand them all out or the workers deadlock
+		pool.maxOpen = r.f.writerCount + r.f.readerCount + r.f.pollerCount
+		pool.maxIdle = pool.maxOpen
+		readPool = pool
+	}
+	if r.f.splitPools {
+		d.readOnly = true
+		pool.maxOpen = 1
+		readPool.maxOpen = r.f.readerCount + r.f.pollerCount
+		readPool.maxIdle = readPool.maxOpen
+	}
+
+	db, _ := sql.Open(driverName, dataSource)
+	pool.apply(db)
+
+	// readers share the read/write handle unless asked for their own
+	// read only one
+	readDB := db
+	readSource := dataSource
+	if d.readOnly {
+		readConfig := dbConfig
+		readConfig.Mode = dsn.ModeReadOnly
+		readConfig.Immutable = r.f.immutable
+		readSource, err = dsn.BuildDSN(readConfig)
+		if err != nil {
+			db.Close()
+			fmt.Println(err)
+			return nil, false
+		}
+		readDB, _ = sql.Open(driverName, readSource)
+		readPool.apply(readDB)
+	}
+
+	d.readPool = readPool
+	d.db, d.readDB = db, readDB
+	d.source, d.readSource = dataSource, readSource
+	return d, true
+}
+
+// close closes the handles of d and removes its files, unless -keep or a
+// failed integrity check keeps them
+func (r *runner) close(d *database) {
+	if d.readDB != d.db {
+		d.readDB.Close()
+	}
+	d.db.Close()
+	if r.f.keep || r.corrupt {
+		fmt.Println("Kept database: ", d.filename)
+		if d.attach != "" {
+			fmt.Println("Kept attached database: ", d.attach)
+		}
+	} else {
+		os.Remove(d.filename)
+		if d.attach != "" {
+			os.Remove(d.attach)
+		}
+	}
+}
+
+// schema returns the schema of the test tables in the given form, checked
+// against what the linked sqlite supports
+func (r *runner) schema(form string, info buildInfo) (schema, bool) {
+	tableSchema, err := newSchema(r.f.schemaKind, r.f.valueSize, r.f.blob)
+	if err != nil {
+		fmt.Println(err)
+		return schema{}, false
+	}
+	if err := tableSchema.setReadPattern(r.f.readPattern, r.f.rangeSize); err != nil {
+		fmt.Println(err)
+		return schema{}, false
+	}
+	switch r.f.data {
+	case dataRandom:
+	case dataRealistic:
+		tableSchema.realistic = true
+	default:
+		fmt.Println("Invalid -data:", r.f.data)
+		return schema{}, false
+	}
+	tableSchema.udf = r.udfName
+	tableSchema.versioned = r.f.versions
+	tableSchema.sequenced = r.f.measureStaleness
+	tableSchema.collation = r.collationName
+	tableSchema.valueIndex = r.f.valueIndex
+	tableSchema.partialIndex = r.f.partialIndex
+	tableSchema.auditTriggers = r.f.auditTriggers
+	tableSchema.rowid = form == formRowID
+	if tableSchema.generated && !info.atLeast(generatedVersion) {
+		fmt.Println("-schema generated needs sqlite", generatedVersion, "or newer, linked sqlite is", info.version)
+		return schema{}, false
+	}
+	if r.f.strict {
+		if !info.atLeast(strictVersion) {
+			fmt.Println("-strict needs sqlite", strictVersion, "or newer, linked sqlite is", info.version)
+			return schema{}, false
+		}
+		tableSchema.strict = true
+	}
+	tableSchema.jobQueue = r.f.workloadType == workloadQueue
+	tableSchema.timeSeries = r.f.workloadType == workloadTimeSeries
+	tableSchema.window = r.f.window
+	tableSchema.spatial = r.f.workloadType == workloadSpatial
+	tableSchema.attached = r.f.workloadType == workloadAttach
+	tableSchema.virtual = r.f.workloadType == workloadVTab
+	if tableSchema.spatial && info.option("ENABLE_RTREE") == "" {
+		fmt.Println("-workload spatial needs sqlite built with ENABLE_RTREE")
+		return schema{}, false
+	}
+	return tableSchema, true
+}
+
+// mixes returns the operations readers and writers pick from, given by
+// -workload, -workload-file, -check-snapshots and -mix in that order
+func (r *runner) mixes(d *database, file *workloadFile, info buildInfo) (readerMix, writerMix mix, ok bool) {
+	readerMix, writerMix = singleOp(opRead), singleOp(opUpdate)
+	switch r.f.workloadType {
+	case workloadUpdate:
+	case workloadInsert:
+		writerMix = singleOp(opInsert)
+	case workloadUpsert:
+		writerMix = singleOp(opUpsert)
+	case workloadRetention:
+		writerMix = singleOp(opRetain)
+	case workloadRMW:
+		writerMix = singleOp(opRMW)
+	case workloadCounter:
+		writerMix = singleOp(opIncrement)
+	case workloadQueue:
+		if d.readOnly {
+			fmt.Println("-workload queue needs readers that can write to claim jobs")
+			return readerMix, writerMix, false
+		}
+		readerMix, writerMix = singleOp(opClaim), singleOp(opEnqueue)
+	case workloadTimeSeries:
+		readerMix, writerMix = singleOp(opRecent), singleOp(opAppend)
+	case workloadReturning:
+		writerMix = singleOp(opReturning)
+	case workloadSpatial:
+		readerMix, writerMix = singleOp(opBBox), singleOp(opBox)
+	case workloadFlip:
+		writerMix = singleOp(opFlip)
+	case workloadSavepoint:
+		writerMix = singleOp(opSavepoint)
+	case workloadAttach:
+		writerMix = singleOp(opCross)
+	case workloadVTab:
+		readerMix, writerMix = singleOp(opVRead), singleOp(opVUpdate)
+	default:
+		if _, ok := workloads.Lookup(r.f.workloadType); !ok {
+			fmt.Println("Invalid -workload:", r.f.workloadType)
+			return readerMix, writerMix, false
+		}
+	}
+	if file != nil {
+		if len(file.reads) > 0 {
+			readerMix = singleOp(opFileRead)
+		}
+		if len(file.writes) > 0 {
+			writerMix = singleOp(opFileWrite)
+		}
+	}
+	if r.f.checkSnapshots {
+		readerMix = singleOp(opSnapshot)
+	}
+	if r.f.batch < 1 {
+		fmt.Println("-batch must be at least 1")
+		return readerMix, writerMix, false
+	}
+
+	if r.f.mixSpec != "" {
+		m, err := parseMix(r.f.mixSpec)
+		if err != nil {
+			fmt.Println("Invalid -mix:", err)
+			return readerMix, writerMix, false
+		}
+		readerMix, writerMix = m, m
+		fmt.Println("Operation mix:", m)
+	}
+	for _, op := range []opType{opFileRead, opFileWrite} {
+		if (readerMix.has(op) || writerMix.has(op)) && (file == nil || op == opFileRead && len(file.reads) == 0 || op == opFileWrite && len(file.writes) == 0) {
+			fmt.Println("-mix", op, "needs a -workload-file with statements for it")
+			return readerMix, writerMix, false
+		}
+	}
+	if (readerMix.has(opReturning) || writerMix.has(opReturning)) && !info.atLeast(returningVersion) {
+		fmt.Println("RETURNING needs sqlite", returningVersion, "or newer, linked sqlite is", info.version)
+		return readerMix, writerMix, false
+	}
+	return readerMix, writerMix, true
+}
+
+// newTestConfig returns the config of a run on d, with the script of
+// -script when one is given
+func (r *runner) newTestConfig(d *database, tableSchema schema, file *workloadFile, readerMix, writerMix mix) (testConfig, *scriptWorkload, bool) {
+	var err error
+	filename := d.filename
+	config := testConfig{
+		writerCount: r.f.writerCount,
+		readerCount: r.f.readerCount,
+		numRows:     r.f.numRows,
+		numUpdates:  r.f.numUpdates,
+		duration:    r.f.duration,
+		out:         os.Stdout,
+		warmup:      r.f.warmup,
+		readerMix:   readerMix,
+		writerMix:   writerMix,
+
+		pollerCount:  r.f.pollerCount,
+		pollInterval: r.f.pollInterval,
+		snapshotHold: r.f.snapshotHold,
+		dbFile:       filename,
+		walFile:      filename + "-wal",
+		shmFile:      filename + "-shm",
+
+		stallHold:     r.f.stallHold,
+		stallInterval: r.f.stallInterval,
+
+		distribution: r.f.distribution,
+		hotRow:       r.f.hotRow,
+		schema:       tableSchema,
+		txSize:       r.f.txSize,
+		batch:        r.f.batch,
+		zeroRows:     new(int64),
+	}
+	if r.f.snapshotHold > 0 {
+		config.newHolder = rawWorkers(r.driver, d.source, d.readSource, 1, &stmtCacheStats{})
+	}
+	if r.f.quickCheck > 0 {
+		config.quickCheck = &quickChecker{interval: r.f.quickCheck}
+	}
+	if r.f.checkpointInterval > 0 {
+		if !r.f.walMode {
+			fmt.Println("-checkpoint-interval needs -wal")
+			return testConfig{}, nil, false
+		}
+		switch r.f.checkpointMode {
+		case checkpointPassive, checkpointFull, checkpointRestart, checkpointTruncate:
+		default:
+			fmt.Println("Invalid -checkpoint-mode:", r.f.checkpointMode)
+			return testConfig{}, nil, false
+		}
+		config.checkpoints = &checkpointer{interval: r.f.checkpointInterval, mode: r.f.checkpointMode}
+	}
+	config.starvationWindow = r.f.starvationWindow
+	if r.f.slowThreshold > 0 {
+		config.slow = &slowLog{threshold: r.f.slowThreshold}
+	}
+	if r.f.measureStmts {
+		config.stmtStats = newStmtStats()
+	}
+	if r.f.poolStats {
+		if r.f.raw {
+			fmt.Println("-pool-stats can not be combined with -raw, raw workers have no pool")
+			return testConfig{}, nil, false
+		}
+		config.pools = newPoolSampler(d.db, d.readDB)
+	}
+	if r.f.leakCheck > 0 {
+		config.leaks = &leakDetector{interval: r.f.leakCheck}
+	}
+	if r.f.runtimeStats {
+		config.runtime = newRuntimeSampler()
+	}
+	if r.f.cpuStats {
+		if config.cpu, err = newCPUSampler(); err != nil {
+			fmt.Println("-cpu-stats:", err)
+			return testConfig{}, nil, false
+		}
+	}
+	if r.f.countSyncs {
+		config.syncs = &syncCounter{}
+	}
+	if r.f.measureWriteAmp {
+		config.writeAmp = newWriteAmp()
+	}
+	if r.f.rusage {
+		if config.usage, err = newUsageSampler(); err != nil {
+			fmt.Println("-rusage:", err)
+			return testConfig{}, nil, false
+		}
+	}
+	if r.f.ioStats {
+		if config.io, err = newIOSampler(); err != nil {
+			fmt.Println("-io-stats:", err)
+			return testConfig{}, nil, false
+		}
+	}
+	if r.f.stuckAfter > 0 {
+		config.watchdog = newWatchdog(r.f.stuckAfter, r.f.stuckCancel)
+	} else if r.f.stuckCancel {
+		fmt.Println("-stuck-cancel needs -stuck-after")
+		return testConfig{}, nil, false
+	}
+	switch r.f.retryPolicy {
+	case retryBusy, retryAll:
+		config.retryPolicy = r.f.retryPolicy
+	default:
+		fmt.Println("Invalid -retry:", r.f.retryPolicy)
+		return testConfig{}, nil, false
+	}
+	if r.f.workloadType == workloadTimeSeries {
+		config.writeRate = r.f.appendRate
+	}
+	var script *scriptWorkload
+	if r.f.scriptFilename != "" {
+		if script, err = loadScript(r.f.scriptFilename, r.f.numRows, r.f.distribution); err != nil {
+			fmt.Println("Invalid -script:", err)
+			return testConfig{}, nil, false
+		}
+		config.writeRate = script.rate
+	}
+	if r.f.writeRate > 0 {
+		config.writeRate, config.writeBurst = r.f.writeRate, r.f.writeBurst
+	} else if r.f.writeRate < 0 || r.f.writeBurst < 0 {
+		fmt.Println("-write-rate and -write-burst can not be negative")
+		return testConfig{}, nil, false
+	}
+	if r.f.readRate < 0 || r.f.readThink < 0 {
+		fmt.Println("-read-rate and -read-think can not be negative")
+		return testConfig{}, nil, false
+	}
+	config.readRate, config.readThink = r.f.readRate, r.f.readThink
+	if r.f.rollbackRate < 0 || r.f.rollbackRate > 1 {
+		fmt.Println("-rollback-rate must be between 0 and 1")
+		return testConfig{}, nil, false
+	}
+	config.rollbackRate = r.f.rollbackRate
+	config.file = file
+	if r.f.recordFilename != "" {
+		config.recorder = &recorder{}
+	}
+	config.replay, config.replaySpeed = r.replay, r.f.replaySpeed
+	if r.f.verify || r.f.versions {
+		if _, plugin := workloads.Lookup(r.f.workloadType); plugin || script != nil || r.replay != nil {
+			fmt.Println("-verify and -versions only check the built in workloads, not -plugin, -script or -replay")
+			return testConfig{}, nil, false
+		}
+	}
+	if readerMix.has(opSnapshot) || writerMix.has(opSnapshot) {
+		fmt.Println("Snapshot ops check their read transactions see one snapshot")
+		config.snapshotChecks = &snapshotChecker{}
+	}
+	if r.f.measureStaleness {
+		if _, plugin := workloads.Lookup(r.f.workloadType); plugin || script != nil || r.replay != nil {
+			fmt.Println("-staleness only measures the built in workloads, not -plugin, -script or -replay")
+			return testConfig{}, nil, false
+		}
+		config.staleness = &staleness{}
+	}
+	if r.f.versions {
+		for _, op := range []opType{opDelete, opRetain} {
+			if readerMix.has(op) || writerMix.has(op) {
+				fmt.Println("-versions can not follow", op, "ops, rows have to stay to be checked")
+				return testConfig{}, nil, false
+			}
+		}
+		config.versions = newVersionTracker()
+	}
+	if r.f.checkReads {
+		if r.f.migration == migrationAddColumn {
+			fmt.Println("-check-reads can not be combined with -migration add-column, the new column is NULL")
+			return testConfig{}, nil, false
+		}
+		config.reads = &readChecker{numRows: r.f.numRows, fixedRows: true}
+		for _, op := range []opType{opInsert, opDelete, opUpsert, opRetain} {
+			if readerMix.has(op) || writerMix.has(op) {
+				config.reads.fixedRows = false
+			}
+		}
+	}
+	if r.f.verify {
+		for _, op := range untrackedWrites {
+			if readerMix.has(op) || writerMix.has(op) {
+				fmt.Println("-verify can not follow", op, "ops, they change values it does not track")
+				return testConfig{}, nil, false
+			}
+		}
+		config.state = newStateTracker()
+	}
+	return config, script, true
+}
+
+// setup creates the tables and rows of the workload in db and schedules the
+// maintenance of the run
+func (r *runner) setup(config *testConfig, db *sql.DB, script *scriptWorkload) bool {
+	tableSchema := config.schema
+	builtin, err := newMixWorkload(*config)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	config.workload = builtin
+	if err := config.workload.Setup(context.Background(), db); err != nil {
+		fmt.Println("Workload setup:", err)
+		return false
+	}
+
+	// script and plugin workloads get the test tables too, so -pollers,
+	// -stall-hold and the other extras still have something to work on
+	if script != nil {
+		config.workload = script
+		if err := config.workload.Setup(context.Background(), db); err != nil {
+			fmt.Println("Workload setup:", err)
+			return false
+		}
+	} else if factory, ok := workloads.Lookup(r.f.workloadType); ok {
+		if config.workload, err = factory(); err != nil {
+			fmt.Println("Failed to create -workload", r.f.workloadType+",", err)
+			return false
+		}
+		if err := config.workload.Setup(context.Background(), db); err != nil {
+			fmt.Println("Workload setup:", err)
+			return false
+		}
+	}
+	if r.f.createIndexAt > 0 {
+		config.maintenance = append(config.maintenance, maintenance{
+			name:  "create-index",
+			at:    r.f.createIndexAt,
+			stmts: []statement{tableSchema.createValueIndex("testData_value_online")},
+		})
+	}
+	if r.f.vacuumAt > 0 {
+		config.maintenance = append(config.maintenance, maintenance{
+			name:  "vacuum",
+			at:    r.f.vacuumAt,
+			stmts: []statement{{query: "VACUUM"}},
+		})
+	}
+	if r.f.migration != "" {
+		stmts, err := tableSchema.migration(r.f.migration)
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+		config.maintenance = append(config.maintenance, maintenance{
+			name:  "migration " + r.f.migration,
+			at:    r.f.migrationAt,
+			stmts: stmts,
+		})
+	}
+	sort.Slice(config.maintenance, func(i, j int) bool {
+		return config.maintenance[i].at < config.maintenance[j].at
+	})
+	if config.txSize < 1 {
+		fmt.Println("-tx-size must be at least 1")
+		return false
+	}
+	if config.batch > tableSchema.maxBatch() {
+		fmt.Println("-batch can be at most", tableSchema.maxBatch(), "for this schema")
+		return false
+	}
+	return true
+}
+
+// describe prints how the run on d is set up
+func (r *runner) describe(d *database, config testConfig, file *workloadFile, script *scriptWorkload, cacheSize int) {
+	tableSchema := config.schema
+	if r.f.splitPools {
+		fmt.Println("Split pools, readers using", d.readPool.maxOpen, "read only connections")
+	} else if r.f.readOnly {
+		fmt.Println("Readers using read only connections, immutable:", r.f.immutable)
+	}
+	if r.f.sharedCache {
+		fmt.Println("Connections share a cache=shared page cache")
+	}
+	if r.f.txLock != "" {
+		fmt.Println("Transactions begin with _txlock=" + r.f.txLock)
+	}
+	if r.f.openMutex != "" {
+		fmt.Println("Threading mode open flag: _mutex=" + r.f.openMutex)
+	}
+	if script != nil {
+		fmt.Println("Workload script:", r.f.scriptFilename, "with", len(script.reads.names), "reads and", len(script.writes.names), "writes")
+	} else if r.replay != nil {
+		fmt.Println("Replaying", len(r.replay.ops), "ops from", r.f.replayFilename, "at speed", r.f.replaySpeed)
+	} else if file != nil {
+		fmt.Println("Workload file:", r.f.workloadFilename, "with", len(file.reads), "reads and", len(file.writes), "writes")
+	} else if r.f.workloadType != workloadUpdate {
+		fmt.Println("Workload:", r.f.workloadType)
+	}
+	if r.f.batch > 1 {
+		fmt.Println("Inserts add", r.f.batch, "rows per statement")
+	}
+	if r.f.txSize > 1 {
+		fmt.Println("Each write is a transaction of", r.f.txSize, "statements")
+	}
+	if r.f.readPattern != readScan {
+		fmt.Println("Read pattern:", r.f.readPattern)
+	}
+	if tableSchema.relational {
+		fmt.Println("Relational schema, each row has", childrenPerParent, "children")
+	}
+	if tableSchema.generated {
+		fmt.Println("Generated schema, updates recompute a stored and a virtual column")
+	}
+	if r.f.strict {
+		fmt.Println("Tables are STRICT")
+	}
+	if r.f.valueIndex {
+		fmt.Println("Updates maintain an index on value")
+	}
+	if r.f.partialIndex {
+		fmt.Println("Updates maintain a partial index on value > 0")
+	}
+	if r.f.auditTriggers > 0 {
+		fmt.Println("Every update fires", r.f.auditTriggers, "audit triggers")
+	}
+	if tableSchema.realistic {
+		fmt.Println("Rows carry realistic names, emails and skewed values")
+	}
+	if r.f.valueSize > 0 {
+		fmt.Println("Rows carry", r.f.valueSize, "bytes of data, blob:", r.f.blob)
+	}
+	if r.f.hotRow {
+		fmt.Println("All writes target a single hot row")
+	}
+	if r.f.snapshotHold > 0 {
+		fmt.Println("Holding a read snapshot open for", r.f.snapshotHold, "at a time")
+	}
+	if r.f.quickCheck > 0 {
+		fmt.Println("Running quick_check every", r.f.quickCheck)
+	}
+	if r.f.stallHold > 0 {
+		fmt.Println("Stalling a write transaction for", r.f.stallHold, "every", r.f.stallInterval)
+	}
+	if r.f.createIndexAt > 0 {
+		fmt.Println("Building an index on value", r.f.createIndexAt, "into the run")
+	}
+	if r.f.vacuumAt > 0 {
+		fmt.Println("Running VACUUM", r.f.vacuumAt, "into the run")
+	}
+	if r.f.migration != "" {
+		fmt.Println("Running the", r.f.migration, "migration", r.f.migrationAt, "into the run")
+	}
+	if r.f.pollerCount > 0 {
+		fmt.Println(r.f.pollerCount, "pollers running SELECT COUNT(*) every", r.f.pollInterval)
+	}
+	if r.f.readRate > 0 {
+		fmt.Println("Readers paced to", r.f.readRate, "reads/sec")
+	}
+	if r.f.readThink > 0 {
+		fmt.Println("Readers pause", r.f.readThink, "after every read")
+	}
+	if r.f.prepared && !r.f.raw {
+		fmt.Println("Statements are prepared once and reused")
+	}
+	if tableSchema.udf != "" {
+		fmt.Println("Reads call " + tableSchema.udf + "(value) on every row")
+	}
+	if tableSchema.versioned {
+		fmt.Println("Updates read and bump a per row version")
+	}
+	if tableSchema.sequenced {
+		fmt.Println("Writes bump a sequence that reads check their staleness against")
+	}
+	if tableSchema.collation != "" {
+		fmt.Println("Rows carry a tag indexed with COLLATE " + tableSchema.collation)
+	}
+	if r.f.sqlVariants > 1 {
+		fmt.Println("Every query has", r.f.sqlVariants, "distinct SQL texts")
+	}
+	if r.f.raw {
+		fmt.Println("Each worker using its own raw driver connection")
+		if cacheSize > 0 {
+			fmt.Println("Each worker caching", cacheSize, "prepared statements")
+		}
+	} else if r.f.connPerWorker {
+		fmt.Println("Each worker pinned to its own connection")
+	}
+}
+
+// newLocker returns the locker of -type and says which test is running
+func (r *runner) newLocker() (lockers.Locker, bool) {
+	switch r.f.testType {
+	case "none":
+		fmt.Println("Running no-mutex test")
+		return lockers.None{}, true
+	case "mutex":
+		fmt.Println("Running sync.Mutex test")
+		return &lockers.Mutex{}, true
+	case "rwmutex":
+		fmt.Println("Running sync.RWMutex test")
+		return &sync.RWMutex{}, true
+	case "channel":
+		fmt.Println("Running channel test")
+		return lockers.NewChannel(), true
+	}
+	newLocker, ok := lockers.Lookup(r.f.testType)
+	if !ok {
+		fmt.Println("Invalid test type:", r.f.testType)
+		return nil, false
+	}
+	fmt.Println("Running", r.f.testType, "test")
+	return newLocker(), true
+}
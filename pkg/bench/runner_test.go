@@ -0,0 +1,159 @@
+package bench
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	// testDriver is registered once for every test runner, database/sql
+	// panics when a driver name is registered twice
+	testDriverOnce sync.Once
+	testConnect    *connectConfig
+	testDriver     *sqlite3.SQLiteDriver
+)
+
+// newTestRunner returns a runner for args that creates its databases in a
+// temporary directory
+func newTestRunner(t *testing.T, args ...string) *runner {
+	t.Helper()
+	f, ok := parseFlags(t, "", "", append([]string{"-db-dir", t.TempDir()}, args...)...)
+	if !ok {
+		t.Fatal("parse failed")
+	}
+	testDriverOnce.Do(func() {
+		testConnect = &connectConfig{}
+		testDriver = registerDriver(driverName, testConnect)
+	})
+	return &runner{f: f, connect: testConnect, driver: testDriver}
+}
+
+// journalMode returns the journal mode of the database db opens
+func journalMode(t *testing.T, db *sql.DB) string {
+	t.Helper()
+	var mode string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	return mode
+}
+
+func TestWALReadOnlyReader(t *testing.T) {
+	r := newTestRunner(t, "-wal", "-readonly-readers")
+	d, ok := r.open()
+	if !ok {
+		t.Fatal("open failed")
+	}
+	defer r.close(d)
+
+	if _, err := d.db.Exec("CREATE TABLE t (v INTEGER); INSERT INTO t VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	// a write transaction left open must not keep the reader out
+	tx, err := d.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE t SET v = 2"); err != nil {
+		t.Fatal(err)
+	}
+
+	var v int
+	if err := d.readDB.QueryRow("SELECT v FROM t").Scan(&v); err != nil {
+		t.Fatalf("read only reader failed to read, %v", err)
+	}
+	if v != 1 {
+		t.Errorf("reader read %d, want the committed 1", v)
+	}
+	if mode := journalMode(t, d.readDB); mode != "wal" {
+		t.Errorf("reader journal mode = %q, want wal", mode)
+	}
+}
+
+func TestWALRun(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"readonly readers", []string{"-readonly-readers"}},
+		{"split pools", []string{"-split-pools", "-readers", "4"}},
+		{"conn per worker", []string{"-conn-per-worker", "-writers", "4", "-readers", "4"}},
+		{"raw", []string{"-raw"}},
+		{"raw readonly readers", []string{"-raw", "-readonly-readers"}},
+		{"max open conns", []string{"-max-open-conns", "4", "-writers", "4", "-readers", "4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRunner(t, append([]string{"-wal", "-updates", "100"}, tt.args...)...)
+			result, ok := r.run(r.f.tableForm, 0)
+			if !ok {
+				t.Fatal("run failed")
+			}
+			var reads, writes int64
+			for _, op := range result.ops {
+				if errs := op.errors.String(); errs != "" {
+					t.Errorf("%s: errors %s", op.name, errs)
+				}
+				// new connections used to take the database out of WAL
+				// mode, which showed up as busy retries
+				if op.retries > 0 {
+					t.Errorf("%s: %d retries, want none", op.name, op.retries)
+				}
+				if op.read {
+					reads += op.ops
+				} else {
+					writes += op.ops
+				}
+			}
+			if reads == 0 || writes != 100 {
+				t.Errorf("ran %d reads and %d writes, want some reads and 100 writes", reads, writes)
+			}
+		})
+	}
+}
+
+func TestWALStaleness(t *testing.T) {
+	// a read holds one connection while a writer commits on the other
+	r := newTestRunner(t, "-wal", "-staleness", "-max-open-conns", "2")
+	d, ok := r.open()
+	if !ok {
+		t.Fatal("open failed")
+	}
+	defer r.close(d)
+
+	if _, err := d.db.Exec("CREATE TABLE writeSeq(seq integer not null); INSERT INTO writeSeq(seq) VALUES (0)"); err != nil {
+		t.Fatal(err)
+	}
+	s := &staleness{}
+	tx, err := d.readDB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	readSeq := func() int64 {
+		var seq int64
+		if err := tx.QueryRow("SELECT seq FROM writeSeq").Scan(&seq); err != nil {
+			t.Fatal(err)
+		}
+		return seq
+	}
+	read := s.read()
+	read.row([]interface{}{readSeq()})
+	for seq := int64(1); seq <= 3; seq++ {
+		if _, err := d.db.Exec("UPDATE writeSeq SET seq = ?", seq); err != nil {
+			t.Fatalf("write alongside the read failed, %v", err)
+		}
+		s.commit(seq)
+	}
+	read.row([]interface{}{readSeq()})
+	read.done()
+
+	if stats := s.stats(); stats.stale != 1 || stats.max != 3 {
+		t.Errorf("got %d stale reads %d writes behind, want 1 read 3 writes behind", stats.stale, stats.max)
+	}
+}
@@ -0,0 +1,976 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mostlygeek/go-sqlite3-locking/pkg/lockers"
+	"github.com/mostlygeek/go-sqlite3-locking/pkg/workloads"
+)
+
+// runTests creates writerCount, readerCount goroutines to write/read to the
+// database respectively.  It will do numUpdates (or run for duration) to the
+// numRows filled by schema.fill while constantly reading from the database
+// as fast as possible.
+// newWorker opens each goroutine's handle on the database.
+// locker is the sync.Locker that will be used to lock the database at the go layer
+func runTest(newWorker workerFactory, config testConfig, locker lockers.Locker) (testResult, error) {
+	ctx := context.Background()
+	writerCount, readerCount := config.writerCount, config.readerCount
+	numUpdates := config.numUpdates
+	errs := newErrorLog()
+	var err error
+
+	// readers and writers print their progress codes at once
+	config.out = &lockedWriter{w: config.out}
+
+	// aborted is closed by abort when an op fails with an error that is not
+	// retried, the run stops and returns abortErr
+	aborted := make(chan struct{})
+	var abortOnce sync.Once
+	var abortErr error
+	abort := func(name string, err error) {
+		abortOnce.Do(func() {
+			if errors.As(err, new(fatalError)) {
+				abortErr = fmt.Errorf("%s failed, %v", name, err)
+			} else {
+				abortErr = fmt.Errorf("%s failed with an error -retry %s does not retry, %v", name, config.retryPolicy, err)
+			}
+			close(aborted)
+		})
+	}
+
+	// workers are opened before any of them start so a failure can be
+	// reported without leaving goroutines behind
+	var workers []worker
+	defer func() {
+		for _, w := range workers {
+			w.close()
+		}
+	}()
+
+	readers := make([]worker, readerCount)
+	for r := range readers {
+		w, err := newWorker(ctx, true)
+		if err != nil {
+			return testResult{}, err
+		}
+		readers[r], workers = w, append(workers, w)
+	}
+
+	pollers := make([]worker, config.pollerCount)
+	for p := range pollers {
+		w, err := newWorker(ctx, true)
+		if err != nil {
+			return testResult{}, err
+		}
+		pollers[p], workers = w, append(workers, w)
+	}
+
+	var holder worker
+	if config.snapshotHold > 0 {
+		holder, err = config.newHolder(ctx, true)
+		if err != nil {
+			return testResult{}, err
+		}
+		workers = append(workers, holder)
+	}
+
+	var staller worker
+	if config.stallHold > 0 {
+		staller, err = newWorker(ctx, false)
+		if err != nil {
+			return testResult{}, err
+		}
+		workers = append(workers, staller)
+	}
+
+	var checker worker
+	if config.quickCheck != nil {
+		checker, err = newWorker(ctx, true)
+		if err != nil {
+			return testResult{}, err
+		}
+		workers = append(workers, checker)
+	}
+
+	var checkpointWorker worker
+	if config.checkpoints != nil {
+		checkpointWorker, err = newWorker(ctx, false)
+		if err != nil {
+			return testResult{}, err
+		}
+		workers = append(workers, checkpointWorker)
+	}
+
+	var maintainer worker
+	if len(config.maintenance) > 0 {
+		maintainer, err = newWorker(ctx, false)
+		if err != nil {
+			return testResult{}, err
+		}
+		workers = append(workers, maintainer)
+	}
+
+	writers := make([]worker, writerCount)
+	for i := range writers {
+		w, err := newWorker(ctx, false)
+		if err != nil {
+			return testResult{}, err
+		}
+		writers[i], workers = w, append(workers, w)
+	}
+
+	var counters opCounters
+
+	var skipped int64
+	var snapshots, stalls int64
+	// snapshotWALGrowth is the most the WAL grew during one held snapshot,
+	// only the holder sets it
+	var snapshotWALGrowth int64
+
+	// waiting is how many workers are queued on locker right now
+	var waiting, peakWaiting int64
+
+	// while a maintenance job runs, maintRetries counts failed attempts and
+	// maintGap tracks the longest time between two completed ops. lastDone
+	// is when the last op completed in UnixNano.
+	var maintRunning int32
+	var maintRetries, maintGap, lastDone int64
+
+	// measuring is set once the warm up is over, operations before that are
+	// not counted
+	var measuring int32
+
+	// do runs op until it succeeds. Reads take the read lock, everything
+	// else the write lock. due is when a paced op should have started, zero
+	// for the ones run flat out. It returns true when the op succeeded and
+	// was counted.
+	do := func(w worker, op workloads.Op, due time.Time) bool {
+		start := time.Now()
+		counter := counters.get(op.Name, op.Read)
+		code, retryCode := op.Code, WRITE_RETRY_CODE
+		if op.Read {
+			retryCode = SELECT_RETRY_CODE
+			if code == "" {
+				code = SELECT_CODE
+			}
+		} else if code == "" {
+			code = WRITE_CODE
+		}
+
+		var checkpointSeq int64
+		if config.checkpoints != nil {
+			checkpointSeq = config.checkpoints.begin()
+		}
+
+		opCtx := ctx
+		var flight *inflightOp
+		if config.watchdog != nil {
+			opCtx, flight = config.watchdog.start(ctx, op.Name)
+			defer config.watchdog.done(flight)
+		}
+
+		storeMax(&peakWaiting, atomic.AddInt64(&waiting, 1))
+		if op.Read {
+			locker.RLock()
+			defer locker.RUnlock()
+		} else {
+			locker.Lock()
+			defer locker.Unlock()
+		}
+		atomic.AddInt64(&waiting, -1)
+
+		var streak int64
+		for {
+			attemptStart := time.Now()
+			attempt := w
+			var written int64
+			if config.writeAmp != nil && !op.Read {
+				attempt = sizingWorker{worker: attempt, bytes: &written}
+			}
+			var rec *recordingWorker
+			if config.recorder != nil {
+				rec = &recordingWorker{worker: attempt}
+				attempt = rec
+			}
+			if config.slow != nil || config.stmtStats != nil {
+				attempt = timedWorker{worker: attempt, slow: config.slow, stats: config.stmtStats, retries: streak}
+			}
+			if flight != nil {
+				attempt = watchedWorker{worker: attempt, op: flight}
+			}
+
+			err := op.Run(opCtx, workloadConn{attempt})
+			if err == workloads.ErrSkip {
+				if atomic.LoadInt32(&measuring) == 1 {
+					atomic.AddInt64(&skipped, 1)
+				}
+				return false
+			}
+			if err != nil {
+				fmt.Fprint(config.out, retryCode)
+				errs.add(err)
+				if opCtx.Err() != nil {
+					// cancelled by the watchdog, the op is given up
+					return false
+				}
+				if !retryable(config.retryPolicy, err) {
+					abort(op.Name, err)
+					return false
+				}
+				streak++
+				if atomic.LoadInt32(&measuring) == 1 {
+					atomic.AddInt64(&counter.retries, 1)
+					atomic.AddInt64(&counter.retryTime, int64(time.Since(attemptStart)))
+					atomic.AddInt64(&counter.errors[classify(err)], 1)
+					storeMax(&counter.maxRetries, streak)
+				}
+				if atomic.LoadInt32(&maintRunning) == 1 {
+					atomic.AddInt64(&maintRetries, 1)
+				}
+				continue
+			}
+
+			fmt.Fprint(config.out, code)
+			if rec != nil {
+				config.recorder.add(start, op, rec.calls)
+			}
+			now := time.Now().UnixNano()
+			if prev := atomic.SwapInt64(&lastDone, now); atomic.LoadInt32(&maintRunning) == 1 {
+				storeMax(&maintGap, now-prev)
+			}
+			if atomic.LoadInt32(&measuring) == 0 {
+				return false
+			}
+			atomic.AddInt64(&counter.ops, 1)
+			counter.latency.add(time.Since(start))
+			if !due.IsZero() {
+				counter.intended.add(time.Since(due))
+			}
+			if config.checkpoints != nil && config.checkpoints.overlapped(checkpointSeq) {
+				config.checkpoints.add(op.Read, time.Since(start))
+			}
+			if config.writeAmp != nil {
+				config.writeAmp.add(written)
+			}
+			return true
+		}
+	}
+
+	// with -replay readers and writers run the recorded ops handed to them
+	// instead of generating their own
+	var replayReads, replayWrites chan recordedOp
+	if config.replay != nil {
+		replayReads = make(chan recordedOp, readerCount)
+		replayWrites = make(chan recordedOp, writerCount)
+	}
+
+	var readerWG sync.WaitGroup
+	stopReaders := make(chan bool)
+
+	// readerOps and writerOps count the ops each reader and writer completed
+	readerOps := make([]int64, readerCount)
+	writerOps := make([]int64, writerCount)
+
+	// readBucket is shared by the readers when -read-rate paces them, it
+	// holds a single token so readers that fell behind do not catch up
+	var readBucket *tokenBucket
+	if config.readRate > 0 {
+		readBucket = newTokenBucket(config.readRate, 1)
+	}
+
+	// read from the database as much/fast as possible, unless paced or
+	// thinking between reads
+	for r := 0; r < readerCount; r++ {
+		readerWG.Add(1)
+		go func(id int, w worker) {
+			defer readerWG.Done()
+			if replayReads != nil {
+				for e := range replayReads {
+					if do(w, e.op(), e.due) {
+						atomic.AddInt64(&readerOps[id], 1)
+					}
+				}
+				return
+			}
+			for {
+				select {
+				case <-stopReaders:
+					return
+				default:
+					var due time.Time
+					if readBucket != nil {
+						due = readBucket.take()
+						select {
+						case <-stopReaders:
+							return
+						case <-time.After(time.Until(due)):
+						}
+					}
+					if do(w, config.workload.ReadOp(), due) {
+						atomic.AddInt64(&readerOps[id], 1)
+					}
+					if config.readThink > 0 {
+						select {
+						case <-stopReaders:
+							return
+						case <-time.After(config.readThink):
+						}
+					}
+				}
+			}
+		}(r, readers[r])
+	}
+
+	// pollers are light readers checking in at a fixed interval, like a
+	// health check or dashboard would
+	poll := workloads.Op{
+		Name: opPoll.String(),
+		Read: true,
+		Code: opPoll.code(),
+		Run: func(ctx context.Context, c workloads.Conn) error {
+			return asWorker(c).query(ctx, config.schema.count(), nil)
+		},
+	}
+	for p := range pollers {
+		readerWG.Add(1)
+		go func(w worker) {
+			defer readerWG.Done()
+
+			var tick <-chan time.Time
+			if config.pollInterval > 0 {
+				ticker := time.NewTicker(config.pollInterval)
+				defer ticker.Stop()
+				tick = ticker.C
+			}
+
+			for {
+				if tick != nil {
+					select {
+					case <-stopReaders:
+						return
+					case <-tick:
+					}
+				} else {
+					select {
+					case <-stopReaders:
+						return
+					default:
+					}
+				}
+				do(w, poll, time.Time{})
+			}
+		}(pollers[p])
+	}
+
+	// the database and WAL files are sampled for their peak size. The
+	// pools, the Go runtime and the CPU are sampled along with them.
+	dbSize := newFileSize(config.dbFile)
+	walSize := newFileSize(config.walFile)
+	shmSize := newFileSize(config.shmFile)
+	readerWG.Add(1)
+	go func() {
+		defer readerWG.Done()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			dbSize.sample()
+			walSize.sample()
+			shmSize.sample()
+			if config.pools != nil {
+				config.pools.sample()
+			}
+			if config.runtime != nil {
+				config.runtime.sample()
+			}
+			if config.cpu != nil {
+				config.cpu.sample()
+			}
+			select {
+			case <-stopReaders:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	// the snapshot holder plays a misbehaving reader, it ignores locker so
+	// only sqlite's own locking stands between it and the writers
+	if holder != nil {
+		readerWG.Add(1)
+		go func() {
+			defer readerWG.Done()
+			for {
+				err := holder.tx(ctx, func(tx txConn) error {
+					if _, _, err := tx.queryInt(ctx, config.schema.count()); err != nil {
+						return err
+					}
+					fmt.Fprint(config.out, SNAPSHOT_START_CODE)
+					atomic.AddInt64(&snapshots, 1)
+					walStart := walSize.size()
+					select {
+					case <-stopReaders:
+					case <-time.After(config.snapshotHold):
+					}
+					if growth := walSize.size() - walStart; growth > snapshotWALGrowth {
+						snapshotWALGrowth = growth
+					}
+					fmt.Fprint(config.out, SNAPSHOT_END_CODE)
+					return nil
+				})
+				if err != nil {
+					fmt.Fprint(config.out, SELECT_RETRY_CODE)
+					errs.add(err)
+				}
+
+				select {
+				case <-stopReaders:
+					return
+				case <-time.After(config.snapshotHold):
+				}
+			}
+		}()
+	}
+
+	// the quick checker is an operator's health check from outside the
+	// application, like the snapshot holder it ignores locker
+	if checker != nil {
+		readerWG.Add(1)
+		go func() {
+			defer readerWG.Done()
+			ticker := time.NewTicker(config.quickCheck.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stopReaders:
+					return
+				case <-ticker.C:
+				}
+				if err := config.quickCheck.check(ctx, checker); err != nil {
+					fmt.Fprint(config.out, SELECT_RETRY_CODE)
+					errs.add(err)
+				}
+			}
+		}()
+	}
+
+	if config.leaks != nil {
+		readerWG.Add(1)
+		go func() {
+			defer readerWG.Done()
+			ticker := time.NewTicker(config.leaks.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stopReaders:
+					return
+				case <-ticker.C:
+				}
+				config.leaks.check(counters.total())
+			}
+		}()
+	}
+
+	// the checkpointer is a background job of the application that leaves
+	// the locking to sqlite, so it ignores locker too
+	if checkpointWorker != nil {
+		readerWG.Add(1)
+		go func() {
+			defer readerWG.Done()
+			ticker := time.NewTicker(config.checkpoints.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stopReaders:
+					return
+				case <-ticker.C:
+				}
+				if err := config.checkpoints.checkpoint(ctx, checkpointWorker); err != nil {
+					fmt.Fprint(config.out, WRITE_RETRY_CODE)
+					errs.add(err)
+				}
+			}
+		}()
+	}
+
+	// the chaos writer is a stuck request inside the application, it takes
+	// locker like any other writer and then sits on its write transaction
+	if staller != nil {
+		readerWG.Add(1)
+		go func() {
+			defer readerWG.Done()
+			for {
+				select {
+				case <-stopReaders:
+					return
+				case <-time.After(config.stallInterval):
+				}
+
+				storeMax(&peakWaiting, atomic.AddInt64(&waiting, 1))
+				locker.Lock()
+				atomic.AddInt64(&waiting, -1)
+				err := staller.tx(ctx, func(tx txConn) error {
+					if _, err := tx.exec(ctx, config.schema.touch(random.Intn(config.numRows+1))); err != nil {
+						return err
+					}
+					fmt.Fprint(config.out, STALL_START_CODE)
+					time.Sleep(config.stallHold)
+					fmt.Fprint(config.out, STALL_END_CODE)
+					return nil
+				})
+				locker.Unlock()
+
+				if err != nil {
+					fmt.Fprint(config.out, WRITE_RETRY_CODE)
+					errs.add(err)
+				} else {
+					atomic.AddInt64(&stalls, 1)
+				}
+			}
+		}()
+	}
+
+	if config.watchdog != nil {
+		readerWG.Add(1)
+		go func() {
+			defer readerWG.Done()
+			config.watchdog.run(stopReaders)
+		}()
+	}
+
+	// measureStart is closed once the warm up is over, writersDone once the
+	// writers have finished
+	measureStart := make(chan bool)
+	writersDone := make(chan bool)
+
+	// the starvation watch compares what every reader and writer completed
+	// each window with the window before, from the start of measuring until
+	// the writers are done
+	var starvedReaders, starvedWriters int64
+	if config.starvationWindow > 0 {
+		readerWG.Add(1)
+		go func() {
+			defer readerWG.Done()
+			select {
+			case <-measureStart:
+			case <-writersDone:
+				return
+			}
+
+			ticker := time.NewTicker(config.starvationWindow)
+			defer ticker.Stop()
+			lastReads, lastWrites := make([]int64, readerCount), make([]int64, writerCount)
+			watch := func(kind string, ops, last []int64, starved *int64) {
+				for i := range ops {
+					n := atomic.LoadInt64(&ops[i])
+					if n == last[i] {
+						fmt.Fprintf(config.out, "\n%s %d completed no ops in the last %s\n", kind, i, config.starvationWindow)
+						atomic.AddInt64(starved, 1)
+					}
+					last[i] = n
+				}
+			}
+			for {
+				select {
+				case <-writersDone:
+					return
+				case <-ticker.C:
+				}
+				watch("Reader", readerOps, lastReads, &starvedReaders)
+				watch("Writer", writerOps, lastWrites, &starvedWriters)
+			}
+		}()
+	}
+
+	var writerWG sync.WaitGroup
+	// workChan is a queue that is consumed in parallel by writers
+	// to update one of the rows in the database
+	workChan := make(chan work, writerCount*2)
+	for i := 0; i < writerCount; i++ {
+		writerWG.Add(1)
+		go func(id int, w worker) {
+			defer writerWG.Done()
+			if replayWrites != nil {
+				for e := range replayWrites {
+					if do(w, e.op(), e.due) {
+						atomic.AddInt64(&writerOps[id], 1)
+					}
+				}
+				return
+			}
+			for unit := range workChan {
+				if unit.stop { // abort all writers
+					close(workChan)
+					return
+				}
+
+				if do(w, config.workload.WriteOp(), unit.due) {
+					atomic.AddInt64(&writerOps[id], 1)
+				}
+			}
+		}(i, writers[i])
+	}
+
+	// maintenance jobs run one after the other, each at its time after
+	// measuring starts, as long as the writers are still going
+	maintResults := make([]maintenanceResult, len(config.maintenance))
+	var maintWG sync.WaitGroup
+	maintWG.Add(1)
+	go func() {
+		defer maintWG.Done()
+		completed := counters.total
+
+		var begin time.Time
+		select {
+		case <-measureStart:
+			begin = time.Now()
+		case <-writersDone:
+		}
+
+		for i, m := range config.maintenance {
+			maintResults[i].name = m.name
+			if begin.IsZero() {
+				continue
+			}
+			select {
+			case <-writersDone:
+				begin = time.Time{}
+				continue
+			case <-time.After(time.Until(begin.Add(m.at))):
+			}
+
+			atomic.StoreInt64(&maintRetries, 0)
+			atomic.StoreInt64(&maintGap, 0)
+			atomic.StoreInt32(&maintRunning, 1)
+			start, before := time.Now(), completed()
+			storeMax(&peakWaiting, atomic.AddInt64(&waiting, 1))
+			locker.Lock()
+			atomic.AddInt64(&waiting, -1)
+			fmt.Fprint(config.out, MAINT_START_CODE)
+			for {
+				_, err := maintainer.exec(ctx, m.stmts...)
+				if err == nil {
+					break
+				}
+				fmt.Fprint(config.out, WRITE_RETRY_CODE)
+				errs.add(err)
+				if !retryable(config.retryPolicy, err) {
+					abort(m.name, err)
+					break
+				}
+				maintResults[i].retries++
+			}
+			fmt.Fprint(config.out, MAINT_END_CODE)
+			locker.Unlock()
+			storeMax(&maintGap, time.Now().UnixNano()-atomic.LoadInt64(&lastDone))
+			atomic.StoreInt32(&maintRunning, 0)
+
+			maintResults[i].ran = true
+			maintResults[i].took = time.Since(start)
+			maintResults[i].opsDuring = completed() - before
+			maintResults[i].retriesDuring = atomic.LoadInt64(&maintRetries)
+			maintResults[i].longestGap = time.Duration(atomic.LoadInt64(&maintGap))
+		}
+	}()
+
+	if config.recorder != nil {
+		config.recorder.start()
+	}
+
+	started := make(chan time.Time, 1)
+	go func() {
+		if config.replay != nil {
+			atomic.StoreInt32(&measuring, 1)
+			started <- time.Now()
+			close(measureStart)
+			config.replay.dispatch(config.replaySpeed, replayReads, replayWrites)
+			return
+		}
+
+		// bucket is nil when writers run flat out, otherwise it says when
+		// each unit of work is due. Units are handed out when they are due
+		// even when the writers fell behind, so a stall shows up in the
+		// latency from when they were due instead of lowering the rate, up
+		// to the burst of the bucket.
+		var bucket *tokenBucket
+		if config.writeRate > 0 {
+			bucket = newTokenBucket(config.writeRate, config.writeBurst)
+		}
+
+		// send queues the next unit of work, false means done fired first
+		send := func(done <-chan time.Time) bool {
+			var unit work
+			if bucket != nil {
+				unit.due = bucket.take()
+				select {
+				case <-done:
+					return false
+				case <-aborted:
+					return false
+				case <-time.After(time.Until(unit.due)):
+				}
+			}
+
+			select {
+			case <-done:
+				return false
+			case <-aborted:
+				return false
+			case workChan <- unit:
+				return true
+			}
+		}
+
+		if config.warmup > 0 {
+			warmupDone := time.After(config.warmup)
+			for send(warmupDone) {
+			}
+		}
+		atomic.StoreInt32(&measuring, 1)
+		// a backlog from the warm up is not held against the run
+		if bucket != nil {
+			bucket.reset()
+		}
+		if readBucket != nil {
+			readBucket.reset()
+		}
+		if config.zeroRows != nil {
+			atomic.StoreInt64(config.zeroRows, 0)
+		}
+		if config.reads != nil {
+			config.reads.reset()
+		}
+		if config.staleness != nil {
+			config.staleness.reset()
+		}
+		if config.snapshotChecks != nil {
+			config.snapshotChecks.reset()
+		}
+		if config.stmtStats != nil {
+			config.stmtStats.reset()
+		}
+		if config.pools != nil {
+			config.pools.reset()
+		}
+		if config.runtime != nil {
+			config.runtime.reset()
+		}
+		if config.cpu != nil {
+			config.cpu.reset()
+		}
+		if config.io != nil {
+			config.io.reset()
+		}
+		if config.usage != nil {
+			config.usage.reset()
+		}
+		if config.writeAmp != nil {
+			config.writeAmp.reset()
+		}
+		if config.syncs != nil {
+			config.syncs.reset()
+		}
+		if config.checkpoints != nil {
+			config.checkpoints.reset()
+		}
+		dbSize.reset()
+		started <- time.Now()
+		close(measureStart)
+
+		// a nil deadline never fires so only numUpdates ends the run
+		var deadline <-chan time.Time
+		if config.duration > 0 {
+			deadline = time.After(config.duration)
+		}
+
+		for i := 0; config.duration > 0 || i < numUpdates; i++ {
+			if !send(deadline) {
+				break
+			}
+		}
+		workChan <- work{stop: true} // stop signal
+	}()
+
+	writerWG.Wait()
+	dur := time.Now().Sub(<-started)
+	var io *ioCounters
+	if config.io != nil {
+		counters := config.io.result()
+		io = &counters
+	}
+	var usage *resourceUsage
+	if config.usage != nil {
+		r := config.usage.result()
+		usage = &r
+	}
+	var amp *writeAmpResult
+	if config.writeAmp != nil {
+		r := config.writeAmp.result(dbSize.result().growth())
+		amp = &r
+	}
+	var syncs *syncCounts
+	if config.syncs != nil {
+		counts := config.syncs.result()
+		syncs = &counts
+	}
+	close(writersDone)
+	maintWG.Wait()
+
+	close(stopReaders)
+	readerWG.Wait()
+
+	result := testResult{
+		duration:    dur,
+		ops:         counters.results(),
+		skipped:     atomic.LoadInt64(&skipped),
+		zeroRows:    loadCount(config.zeroRows),
+		snapshots:   atomic.LoadInt64(&snapshots),
+		snapshotWAL: snapshotWALGrowth,
+		dbSize:      dbSize.result(),
+		wal:         walSize.result(),
+		shm:         shmSize.result(),
+		stalls:      atomic.LoadInt64(&stalls),
+		peakWaiting: atomic.LoadInt64(&peakWaiting),
+		maintenance: maintResults,
+		errors:      errs.entries(),
+		io:          io,
+		writeAmp:    amp,
+		usage:       usage,
+		syncs:       syncs,
+		readers:     spreadOf(readerOps),
+		writers:     spreadOf(writerOps),
+
+		starvedReaders: starvedReaders,
+		starvedWriters: starvedWriters,
+	}
+	if config.slow != nil {
+		result.slowStatements = atomic.LoadInt64(&config.slow.count)
+	}
+	if config.stmtStats != nil {
+		result.statements = config.stmtStats.results()
+	}
+	if config.pools != nil {
+		result.pools = config.pools.results()
+	}
+	if config.runtime != nil {
+		stats := config.runtime.result()
+		result.runtime = &stats
+	}
+	if config.cpu != nil {
+		stats := config.cpu.result()
+		result.cpu = &stats
+	}
+	if config.watchdog != nil {
+		result.stuck = atomic.LoadInt64(&config.watchdog.stuck)
+		result.cancelled = atomic.LoadInt64(&config.watchdog.cancelled)
+	}
+	if abortErr != nil {
+		return result, abortErr
+	}
+	if config.reads != nil {
+		checks := config.reads.result()
+		result.readChecks = &checks
+	}
+	if config.staleness != nil {
+		stats := config.staleness.stats()
+		result.staleness = &stats
+	}
+	if config.snapshotChecks != nil {
+		checks := config.snapshotChecks.result()
+		result.snapshotChecks = &checks
+	}
+	if config.checkpoints != nil {
+		checkpoints := config.checkpoints.result()
+		result.checkpoints = &checkpoints
+	}
+	if config.leaks != nil {
+		leaks := config.leaks.result()
+		result.leaks = &leaks
+	}
+	if config.quickCheck != nil {
+		checks := config.quickCheck.result()
+		result.quickChecks = &checks
+		if len(checks.problems) > 0 {
+			return result, fmt.Errorf("quick_check found %d problems during the run", len(checks.problems))
+		}
+	}
+
+	// the workload is verified on a read-write worker of its own, readers
+	// may be read only. It is opened once the others are closed so a pool
+	// sized for them has a connection to spare.
+	for _, w := range workers {
+		w.close()
+	}
+	workers = nil
+	verifier, err := newWorker(ctx, false)
+	if err != nil {
+		return result, err
+	}
+	defer verifier.close()
+	if err := config.workload.Verify(ctx, workloadConn{verifier}); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// work is a unit of work handed to the writers, due is when it should start
+// with a rate set. stop ends the writers.
+type work struct {
+	due  time.Time
+	stop bool
+}
+
+// loadCount reads a counter that may not be set
+func loadCount(addr *int64) int64 {
+	if addr == nil {
+		return 0
+	}
+	return atomic.LoadInt64(addr)
+}
+
+// lockedWriter serialises the writes to w
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// storeMax sets *addr to v if v is larger
+func storeMax(addr *int64, v int64) {
+	for {
+		old := atomic.LoadInt64(addr)
+		if v <= old || atomic.CompareAndSwapInt64(addr, old, v) {
+			return
+		}
+	}
+}
+
+// verifyCounters checks that the counters add up to the number of successful
+// increments, anything else means an update was lost or applied twice
+func verifyCounters(ctx context.Context, w worker, s schema, increments int64) error {
+	var sum int64
+	err := w.tx(ctx, func(tx txConn) error {
+		var err error
+		sum, _, err = tx.queryInt(ctx, s.sumValues())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if sum != increments {
+		return fmt.Errorf("counter check failed, counters add up to %d but %d increments succeeded", sum, increments)
+	}
+	return nil
+}
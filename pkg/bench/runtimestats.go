@@ -0,0 +1,97 @@
+package bench
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// runtimeSampler watches the Go runtime during a run. A locking strategy that
+// allocates a lot, a channel per op say, spends time in the garbage collector
+// that looks like it was spent waiting on locks.
+type runtimeSampler struct {
+	mu             sync.Mutex
+	start          runtime.MemStats
+	peakHeap       uint64
+	peakGoroutines int
+}
+
+func newRuntimeSampler() *runtimeSampler {
+	r := &runtimeSampler{}
+	r.reset()
+	return r
+}
+
+// reset starts counting from now, like after the warm up
+func (r *runtimeSampler) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runtime.ReadMemStats(&r.start)
+	r.peakHeap = r.start.HeapInuse
+	r.peakGoroutines = runtime.NumGoroutine()
+}
+
+// sample records the heap in use and the goroutines running right now
+func (r *runtimeSampler) sample() {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	goroutines := runtime.NumGoroutine()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if mem.HeapInuse > r.peakHeap {
+		r.peakHeap = mem.HeapInuse
+	}
+	if goroutines > r.peakGoroutines {
+		r.peakGoroutines = goroutines
+	}
+}
+
+// runtimeResult is what the Go runtime did during the run
+type runtimeResult struct {
+	gcs               uint32
+	pauses, maxPause  time.Duration
+	allocated, allocs uint64
+	peakHeap          uint64
+	peakGoroutines    int
+}
+
+func (r *runtimeSampler) result() runtimeResult {
+	r.sample()
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := runtimeResult{
+		gcs:            mem.NumGC - r.start.NumGC,
+		pauses:         time.Duration(mem.PauseTotalNs - r.start.PauseTotalNs),
+		allocated:      mem.TotalAlloc - r.start.TotalAlloc,
+		allocs:         mem.Mallocs - r.start.Mallocs,
+		peakHeap:       r.peakHeap,
+		peakGoroutines: r.peakGoroutines,
+	}
+	// PauseNs only keeps the most recent pauses
+	for i := uint32(0); i < result.gcs && i < uint32(len(mem.PauseNs)); i++ {
+		pause := time.Duration(mem.PauseNs[(mem.NumGC-i+255)%256])
+		if pause > result.maxPause {
+			result.maxPause = pause
+		}
+	}
+	return result
+}
+
+// print shows the allocations per op, ops being every op counted in the run
+func (r runtimeResult) print(ops int64) {
+	perOp := func(n uint64) float64 {
+		if ops == 0 {
+			return 0
+		}
+		return float64(n) / float64(ops)
+	}
+	fmt.Printf("Go runtime: %d GCs, %s paused (max %s), %d bytes in %d allocations (%.0f bytes, %.1f allocations/op)\n",
+		r.gcs, r.pauses.Round(time.Microsecond), r.maxPause.Round(time.Microsecond), r.allocated, r.allocs, perOp(r.allocated), perOp(r.allocs))
+	fmt.Printf("  peak heap in use %d bytes, peak goroutines %d\n", r.peakHeap, r.peakGoroutines)
+}
@@ -0,0 +1,61 @@
+package bench
+
+import (
+	"fmt"
+	"sync"
+)
+
+// resourceUsage is what the process used, the context switches tell a
+// locker that blocks from one that spins. A goroutine parked on a mutex or a
+// busy timeout sleeping gives up its thread voluntarily, one spinning on
+// retries gets preempted.
+type resourceUsage struct {
+	maxRSS                 int64
+	voluntary, involuntary int64
+	fds                    int
+}
+
+// usageSampler measures the resource usage during the measured part of a
+// run. The peak RSS and the open files are the process's, the context
+// switches only count from reset.
+type usageSampler struct {
+	mu    sync.Mutex
+	start resourceUsage
+}
+
+// newUsageSampler returns an error when the usage can not be read here
+func newUsageSampler() (*usageSampler, error) {
+	start, err := processUsage()
+	if err != nil {
+		return nil, err
+	}
+	return &usageSampler{start: start}, nil
+}
+
+// reset starts counting from now, like after the warm up
+func (s *usageSampler) reset() {
+	if now, err := processUsage(); err == nil {
+		s.mu.Lock()
+		s.start = now
+		s.mu.Unlock()
+	}
+}
+
+func (s *usageSampler) result() resourceUsage {
+	now, _ := processUsage()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now.voluntary -= s.start.voluntary
+	now.involuntary -= s.start.involuntary
+	return now
+}
+
+// print shows the context switches per op as well
+func (r resourceUsage) print(ops int64) {
+	perOp := 0.0
+	if ops > 0 {
+		perOp = float64(r.voluntary+r.involuntary) / float64(ops)
+	}
+	fmt.Printf("Resources: max RSS %d bytes, %d open files, context switches %d voluntary, %d involuntary (%.2f/op)\n",
+		r.maxRSS, r.fds, r.voluntary, r.involuntary, perOp)
+}
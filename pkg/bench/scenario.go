@@ -0,0 +1,139 @@
+package bench
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// scenario is a -config file, the names of flags and the values to give
+// them. It is YAML or TOML depending on the file extension. A list sets a
+// repeatable flag like -pragma once per value.
+type scenario map[string]interface{}
+
+func loadScenario(path string) (scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := scenario{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &s)
+	case ".toml":
+		_, err = toml.Decode(string(data), &s)
+	default:
+		return nil, fmt.Errorf("%s is not a .yaml, .yml or .toml file", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return s, nil
+}
+
+// apply sets the flags of the scenario on fs, in name order, leaving out the
+// ones already set on the command line so they can override the file
+func (s scenario) apply(fs *flag.FlagSet) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	var names []string
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if fs.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("no flag named %s", name)
+		}
+		if given[name] {
+			continue
+		}
+		values, ok := s[name].([]interface{})
+		if !ok {
+			values = []interface{}{s[name]}
+		}
+		for _, v := range values {
+			switch v.(type) {
+			case map[interface{}]interface{}, map[string]interface{}, []interface{}:
+				return fmt.Errorf("%s: expecting a value, got %v", name, v)
+			}
+			if err := fs.Set(name, fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("%s: invalid value %q, %v", name, fmt.Sprint(v), err)
+			}
+		}
+	}
+	return nil
+}
+
+// presets are the built in scenarios picked with -scenario, starting points
+// for common comparisons. -config and the command line override them.
+var presets = map[string]scenario{
+	// many readers and a single writer, point reads over a larger table
+	"read-heavy": {
+		"wal":          true,
+		"readers":      16,
+		"writers":      1,
+		"rows":         10000,
+		"read-pattern": readPoint,
+		"duration":     "10s",
+	},
+	// writers outnumber readers, updates, inserts and deletes spread over
+	// the table
+	"write-heavy": {
+		"wal":      true,
+		"readers":  2,
+		"writers":  8,
+		"rows":     10000,
+		"mix":      "read=10,update=60,insert=20,delete=10",
+		"duration": "10s",
+	},
+	// every writer updates the same row, the worst case for contention
+	"hot-row": {
+		"wal":      true,
+		"readers":  4,
+		"writers":  8,
+		"hot-row":  true,
+		"duration": "10s",
+	},
+	// writers enqueue jobs and readers claim them
+	"queue": {
+		"wal":      true,
+		"readers":  4,
+		"writers":  4,
+		"workload": workloadQueue,
+		"duration": "10s",
+	},
+	// a long mixed run watching for leaks, starvation and corruption
+	"soak": {
+		"wal":               true,
+		"readers":           8,
+		"writers":           4,
+		"rows":              10000,
+		"mix":               "read=80,update=15,insert=4,delete=1",
+		"distribution":      distZipfian,
+		"duration":          "10m",
+		"warmup":            "10s",
+		"leak-check":        "30s",
+		"quick-check":       "1m",
+		"starvation-window": "5s",
+		"runtime-stats":     true,
+	},
+}
+
+// presetNames returns the -scenario names in order
+func presetNames() []string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
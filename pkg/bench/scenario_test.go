@@ -0,0 +1,99 @@
+package bench
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// parseFlags parses args like the benchmark does, with a -config file of the
+// given name and contents when name is not empty
+func parseFlags(t *testing.T, name, config string, args ...string) (*benchFlags, bool) {
+	t.Helper()
+	if name != "" {
+		path := filepath.Join(t.TempDir(), name)
+		if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		args = append([]string{"-config", path}, args...)
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := registerFlags(fs)
+	return f, f.parse(fs, args)
+}
+
+func TestScenarioPrecedence(t *testing.T) {
+	// read-heavy sets 16 readers, 1 writer and 10000 rows
+	f, ok := parseFlags(t, "test.yaml", "writers: 3\nrows: 50\n", "-scenario", "read-heavy", "-rows", "7")
+	if !ok {
+		t.Fatal("parse failed")
+	}
+	if f.readerCount != 16 {
+		t.Errorf("readers = %d, want 16 from -scenario", f.readerCount)
+	}
+	if f.writerCount != 3 {
+		t.Errorf("writers = %d, want 3 from -config over -scenario", f.writerCount)
+	}
+	if f.numRows != 7 {
+		t.Errorf("rows = %d, want 7 from the command line over -config and -scenario", f.numRows)
+	}
+	if !f.walMode || f.duration != 10*time.Second {
+		t.Errorf("wal = %v, duration = %v, want the -scenario values", f.walMode, f.duration)
+	}
+}
+
+func TestScenarioFormats(t *testing.T) {
+	tests := []struct {
+		name, config string
+	}{
+		{"test.yaml", "wal: true\nreaders: 5\npragma:\n  - synchronous=OFF\n  - cache_size=-2000\n"},
+		{"test.yml", "wal: true\nreaders: 5\npragma: [synchronous=OFF, cache_size=-2000]\n"},
+		{"test.toml", "wal = true\nreaders = 5\npragma = [\"synchronous=OFF\", \"cache_size=-2000\"]\n"},
+	}
+	for _, tt := range tests {
+		f, ok := parseFlags(t, tt.name, tt.config)
+		if !ok {
+			t.Errorf("%s: parse failed", tt.name)
+			continue
+		}
+		if !f.walMode || f.readerCount != 5 {
+			t.Errorf("%s: wal = %v, readers = %d, want true and 5", tt.name, f.walMode, f.readerCount)
+		}
+		if want := (pragmaList{"synchronous=OFF", "cache_size=-2000"}); !reflect.DeepEqual(f.pragmas, want) {
+			t.Errorf("%s: pragmas = %q, want %q", tt.name, f.pragmas, want)
+		}
+	}
+}
+
+func TestScenarioInvalid(t *testing.T) {
+	tests := []struct {
+		name, config string
+		args         []string
+	}{
+		{"unknown flag", "bogus: 1\n", nil},
+		{"config flag", "config: other.yaml\n", nil},
+		{"nested value", "readers:\n  count: 2\n", nil},
+		{"bad value", "readers: many\n", nil},
+		{"unknown scenario", "", []string{"-scenario", "bogus"}},
+	}
+	for _, tt := range tests {
+		name := "test.yaml"
+		if tt.config == "" {
+			name = ""
+		}
+		if _, ok := parseFlags(t, name, tt.config, tt.args...); ok {
+			t.Errorf("%s: parse succeeded, want a failure", tt.name)
+		}
+	}
+}
+
+func TestPresetsApply(t *testing.T) {
+	for _, name := range presetNames() {
+		if _, ok := parseFlags(t, "", "", "-scenario", name); !ok {
+			t.Errorf("-scenario %s failed to apply", name)
+		}
+	}
+}
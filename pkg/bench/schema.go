@@ -0,0 +1,789 @@
+package bench
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	payloadLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	schemaSimple     = "simple"
+	schemaRelational = "relational"
+	schemaGenerated  = "generated"
+
+	// testData is a clustered WITHOUT ROWID table by default, the rowid
+	// form keeps rows in a rowid b-tree with id as its alias
+	formWithoutRowID = "without-rowid"
+	formRowID        = "rowid"
+	formBoth         = "both"
+
+	// strictVersion is the first sqlite with STRICT tables
+	strictVersion = "3.37.0"
+
+	// generatedVersion is the first sqlite with generated columns
+	generatedVersion = "3.31.0"
+
+	// returningVersion is the first sqlite with RETURNING clauses
+	returningVersion = "3.35.0"
+
+	// spatialExtent is the width and height of the area boxes are placed in,
+	// boxes are up to boxSize wide and bounding box queries bboxSize
+	spatialExtent = 1000
+	boxSize       = 10
+	bboxSize      = 50
+
+	// online schema migrations run partway through a test
+	migrationAddColumn = "add-column"
+	migrationTableCopy = "table-copy"
+	migrationIndexSwap = "index-swap"
+
+	readPoint = "point"
+	readRange = "range"
+	readScan  = "scan"
+
+	// readAggregate groups every row by value, a long running read that
+	// holds its snapshot for the whole table
+	readAggregate = "aggregate"
+
+	// readOffset and readKeyset page through the whole table rangeSize rows
+	// at a time, each page is its own statement
+	readOffset = "offset"
+	readKeyset = "keyset"
+
+	// readTag walks the -collation index on tag from a random tag
+	readTag = "tag"
+
+	// tagSize is the length of the random tags
+	tagSize = 8
+
+	// maxVariables is SQLITE_MAX_VARIABLE_NUMBER for the bundled sqlite
+	maxVariables = 999
+
+	// childrenPerParent is how many testChild rows each testData row gets in
+	// the relational schema
+	childrenPerParent = 3
+)
+
+// schema describes the test tables and builds the statements workers run on
+// them
+type schema struct {
+	// valueSize adds a data column carrying this many bytes to every row
+	valueSize int
+
+	// blob stores the data column as random bytes instead of text
+	blob bool
+
+	// realistic adds name and email columns to testData and fills every row
+	// with faker style data instead of random letters and integers
+	realistic bool
+
+	// rowid creates testData as an ordinary rowid table instead of WITHOUT
+	// ROWID
+	rowid bool
+
+	// strict creates every table as a STRICT table, sqlite 3.37+
+	strict bool
+
+	// valueIndex adds an index on the value column so every update also has
+	// to update the index
+	valueIndex bool
+
+	// generated adds a stored and a virtual generated column computed from
+	// value, every update has to recompute them
+	generated bool
+
+	// partialIndex adds an index on value covering only rows with a positive
+	// value
+	partialIndex bool
+
+	// auditTriggers installs this many AFTER UPDATE triggers on testData,
+	// each one writes a row to testAudit
+	auditTriggers int
+
+	// relational adds a testChild table, writers touch parent and children
+	// in one transaction and readers JOIN them
+	relational bool
+
+	// readPattern is point (WHERE id=?), range (WHERE id BETWEEN), scan,
+	// aggregate or one of the paginated offset and keyset reads
+	readPattern string
+
+	// rangeSize is how many ids a range read covers, or the rows per page
+	rangeSize int
+
+	// collation when set adds a tag text column using it, with an index, so
+	// every write and tag read compares through the collation
+	collation string
+
+	// versioned adds a version column that every update reads and writes
+	// back one higher, see versionTracker
+	versioned bool
+
+	// sequenced adds the writeSeq table, a single counter every write
+	// transaction bumps for -staleness
+	sequenced bool
+
+	// udf when set is the SQL function reads call on the value of every row
+	// they return, ie: go_abs
+	udf string
+
+	// jobQueue adds a jobs table used as a work queue
+	jobQueue bool
+
+	// timeSeries adds an append only events table, window is how far back
+	// recent event queries look
+	timeSeries bool
+	window     time.Duration
+
+	// attached adds an auxData table in the aux database ATTACHed to every
+	// connection
+	attached bool
+
+	// spatial adds a boxes rtree virtual table, the linked sqlite must be
+	// built with ENABLE_RTREE
+	spatial bool
+
+	// virtual adds a vData virtual table whose rows live in Go, see vtab.go
+	virtual bool
+}
+
+// newSchema returns the schema named kind: simple, relational or generated
+func newSchema(kind string, valueSize int, blob bool) (schema, error) {
+	s := schema{valueSize: valueSize, blob: blob}
+	switch kind {
+	case schemaSimple:
+	case schemaRelational:
+		s.relational = true
+	case schemaGenerated:
+		s.generated = true
+	default:
+		return s, fmt.Errorf("invalid schema %q, expecting one of [%s, %s, %s]", kind, schemaSimple, schemaRelational, schemaGenerated)
+	}
+
+	if blob && valueSize <= 0 {
+		return s, fmt.Errorf("-blob requires -value-size")
+	}
+
+	s.readPattern, s.rangeSize = readScan, 1
+	return s, nil
+}
+
+func (s schema) hasPayload() bool {
+	return s.valueSize > 0
+}
+
+// value is the value written for val, a skewed amount with realistic data
+func (s schema) value(val int) int {
+	if s.realistic {
+		return fakeValue()
+	}
+	return val
+}
+
+// person returns the name and email of a new realistic row
+func (s schema) person() (string, string) {
+	first, last := fakeName()
+	return first + " " + last, fakeEmail(first, last)
+}
+
+func (s schema) createSQL() []string {
+	tables := []string{s.createTestData("testData") + ";"}
+	for _, stmt := range s.testDataIndexes() {
+		tables = append(tables, stmt.query+";")
+	}
+
+	if s.auditTriggers > 0 {
+		tables = append(tables, "CREATE TABLE testAudit(id integer primary key, row_id integer not null, old_value integer not null, new_value integer not null, trigger integer not null)"+s.tableOptions()+";")
+	}
+	for _, stmt := range s.testDataTriggers() {
+		tables = append(tables, stmt.query+";")
+	}
+
+	if s.relational {
+		tables = append(tables,
+			"CREATE TABLE testChild(id integer primary key, parent_id integer not null, value integer not null)"+s.tableOptions()+";",
+			"CREATE INDEX testChild_parent ON testChild(parent_id);",
+		)
+		if s.valueIndex {
+			tables = append(tables, "CREATE INDEX testChild_value ON testChild(value);")
+		}
+	}
+
+	if s.jobQueue {
+		tables = append(tables,
+			"CREATE TABLE jobs(id integer primary key, status text not null, payload integer not null)"+s.tableOptions()+";",
+			"CREATE INDEX jobs_status ON jobs(status, id);",
+		)
+	}
+
+	if s.timeSeries {
+		tables = append(tables,
+			"CREATE TABLE events(id integer primary key, ts integer not null, value integer not null)"+s.tableOptions()+";",
+			"CREATE INDEX events_ts ON events(ts);",
+		)
+	}
+
+	if s.attached {
+		tables = append(tables, "CREATE TABLE aux.auxData(id integer primary key, value integer not null)"+s.tableOptions()+";")
+	}
+
+	if s.spatial {
+		tables = append(tables, "CREATE VIRTUAL TABLE boxes USING rtree(id, minX, maxX, minY, maxY);")
+	}
+
+	if s.virtual {
+		tables = append(tables, "CREATE VIRTUAL TABLE vData USING "+vtabModuleName+";")
+	}
+
+	if s.sequenced {
+		tables = append(tables, "CREATE TABLE writeSeq(seq integer not null)"+s.tableOptions()+";")
+	}
+	return tables
+}
+
+// testDataIndexes creates the optional indexes on testData
+func (s schema) testDataIndexes() []statement {
+	var stmts []statement
+	if s.valueIndex {
+		stmts = append(stmts, s.createValueIndex("testData_value"))
+	}
+	if s.partialIndex {
+		stmts = append(stmts, statement{query: "CREATE INDEX testData_positive ON testData(value) WHERE value > 0"})
+	}
+	if s.collation != "" {
+		stmts = append(stmts, statement{query: "CREATE INDEX testData_tag ON testData(tag)"})
+	}
+	return stmts
+}
+
+// testDataTriggers creates the audit triggers on testData
+func (s schema) testDataTriggers() []statement {
+	var stmts []statement
+	for i := 0; i < s.auditTriggers; i++ {
+		stmts = append(stmts, statement{query: fmt.Sprintf(
+			"CREATE TRIGGER testData_audit_%d AFTER UPDATE ON testData BEGIN "+
+				"INSERT INTO testAudit(row_id, old_value, new_value, trigger) VALUES (new.id, old.value, new.value, %d); END", i, i)})
+	}
+	return stmts
+}
+
+// testDataColumns are the testData columns that can be written
+func (s schema) testDataColumns() string {
+	columns := "id, value"
+	if s.realistic {
+		columns += ", name, email"
+	}
+	if s.hasPayload() {
+		columns += ", data"
+	}
+	if s.collation != "" {
+		columns += ", tag"
+	}
+	if s.versioned {
+		columns += ", version"
+	}
+	return columns
+}
+
+// createTestData returns the CREATE TABLE for a table with testData's layout
+func (s schema) createTestData(name string) string {
+	columns := "id integer primary key, value integer not null"
+	if s.realistic {
+		columns += ", name text not null, email text not null"
+	}
+	if s.hasPayload() {
+		if s.blob {
+			columns += ", data blob"
+		} else {
+			columns += ", data text"
+		}
+	}
+	if s.collation != "" {
+		columns += ", tag text not null COLLATE " + s.collation
+	}
+	if s.versioned {
+		columns += ", version integer not null"
+	}
+	if s.generated {
+		columns += ", doubled integer GENERATED ALWAYS AS (value * 2) STORED" +
+			", label text GENERATED ALWAYS AS ('value ' || value) VIRTUAL"
+	}
+	var options []string
+	if !s.rowid {
+		options = append(options, "WITHOUT ROWID")
+	}
+	return "CREATE TABLE " + name + "(" + columns + ")" + s.tableOptions(options...)
+}
+
+// createValueIndex builds an index called name on testData's value column
+func (s schema) createValueIndex(name string) statement {
+	return statement{query: "CREATE INDEX " + name + " ON testData(value)"}
+}
+
+// migration returns the statements of an online schema migration of testData:
+// add-column, table-copy or index-swap
+func (s schema) migration(kind string) ([]statement, error) {
+	switch kind {
+	case migrationAddColumn:
+		return []statement{{query: "ALTER TABLE testData ADD COLUMN note text"}}, nil
+	case migrationTableCopy:
+		// the 12 step copy from the ALTER TABLE docs, minus the foreign keys
+		// the test tables don't have
+		columns := s.testDataColumns()
+		stmts := []statement{
+			{query: s.createTestData("testData_new")},
+			{query: "INSERT INTO testData_new(" + columns + ") SELECT " + columns + " FROM testData"},
+			{query: "DROP TABLE testData"},
+			{query: "ALTER TABLE testData_new RENAME TO testData"},
+		}
+		stmts = append(stmts, s.testDataIndexes()...)
+		return append(stmts, s.testDataTriggers()...), nil
+	case migrationIndexSwap:
+		return []statement{
+			s.createValueIndex("testData_value_swap"),
+			{query: "DROP INDEX IF EXISTS testData_value"},
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid migration %q, expecting one of [%s, %s, %s]",
+			kind, migrationAddColumn, migrationTableCopy, migrationIndexSwap)
+	}
+}
+
+// tableOptions returns the table options that follow a CREATE TABLE's column
+// list, STRICT is added to options when set
+func (s schema) tableOptions(options ...string) string {
+	if s.strict {
+		options = append(options, "STRICT")
+	}
+	if len(options) == 0 {
+		return ""
+	}
+	return " " + strings.Join(options, ", ")
+}
+
+// setReadPattern sets how reads pick their rows: point, range, scan,
+// aggregate, offset or keyset
+func (s *schema) setReadPattern(pattern string, rangeSize int) error {
+	switch pattern {
+	case readPoint, readRange, readScan, readAggregate, readOffset, readKeyset, readTag:
+	default:
+		return fmt.Errorf("invalid read pattern %q, expecting one of [%s, %s, %s, %s, %s, %s, %s]",
+			pattern, readPoint, readRange, readScan, readAggregate, readOffset, readKeyset, readTag)
+	}
+	if rangeSize < 1 {
+		return fmt.Errorf("range size must be at least 1, got %d", rangeSize)
+	}
+
+	s.readPattern, s.rangeSize = pattern, rangeSize
+	return nil
+}
+
+// read returns the SELECT for the read pattern, id is where point and range
+// reads start
+func (s schema) read(id int) statement {
+	query := "SELECT *" + s.udfColumn("value") + s.seqColumn() + " FROM testData"
+	idColumn := "id"
+	if s.relational {
+		query = "SELECT p.id, p.value, c.id, c.value" + s.udfColumn("c.value") + s.seqColumn() + " FROM testData p JOIN testChild c ON c.parent_id = p.id"
+		idColumn = "p.id"
+	}
+
+	if s.readPattern == readTag {
+		return statement{
+			query: "SELECT id, tag" + s.seqColumn() + " FROM testData WHERE tag >= ? ORDER BY tag LIMIT ?",
+			args:  []interface{}{s.tag(), s.rangeSize},
+		}
+	}
+
+	if s.readPattern == readAggregate {
+		if s.relational {
+			return statement{query: "SELECT p.value, COUNT(*), SUM(c.value)" + s.udfColumn("p.value") + s.seqColumn() + " FROM testData p JOIN testChild c ON c.parent_id = p.id GROUP BY p.value"}
+		}
+		return statement{query: "SELECT value, COUNT(*)" + s.udfColumn("value") + s.seqColumn() + " FROM testData GROUP BY value"}
+	}
+
+	switch s.readPattern {
+	case readPoint:
+		return statement{query: query + " WHERE " + idColumn + "=?", args: []interface{}{id}}
+	case readRange:
+		return statement{
+			query: query + " WHERE " + idColumn + " BETWEEN ? AND ?",
+			args:  []interface{}{id, id + s.rangeSize - 1},
+		}
+	default:
+		return statement{query: query}
+	}
+}
+
+// udfColumn returns the extra column calling the -udf function on column, or
+// nothing without -udf
+func (s schema) udfColumn(column string) string {
+	if s.udf == "" {
+		return ""
+	}
+	return ", " + s.udf + "(" + column + ")"
+}
+
+// seqColumn returns the extra column with the writeSeq sequence a read's
+// snapshot sees, or nothing without -staleness
+func (s schema) seqColumn() string {
+	if !s.sequenced {
+		return ""
+	}
+	return ", (SELECT seq FROM writeSeq)"
+}
+
+// paginated is true when reads page through the table
+func (s schema) paginated() bool {
+	return s.readPattern == readOffset || s.readPattern == readKeyset
+}
+
+// page returns the SELECT for one page of a paginated read. Offset pages skip
+// offset rows, keyset pages start after afterID which is the last id of the
+// previous page.
+func (s schema) page(offset int, afterID int64) statement {
+	if s.readPattern == readKeyset {
+		return statement{
+			query: "SELECT *" + s.udfColumn("value") + s.seqColumn() + " FROM testData WHERE id > ? ORDER BY id LIMIT ?",
+			args:  []interface{}{afterID, s.rangeSize},
+		}
+	}
+	return statement{
+		query: "SELECT *" + s.udfColumn("value") + s.seqColumn() + " FROM testData ORDER BY id LIMIT ? OFFSET ?",
+		args:  []interface{}{s.rangeSize, offset},
+	}
+}
+
+// update sets the value of row id to val, which is expected to have been
+// through s.value already
+func (s schema) update(id, val int) []statement {
+	set, args := "value=?", []interface{}{val}
+	if s.hasPayload() {
+		set, args = set+", data=?", append(args, s.payload())
+	}
+	if s.collation != "" {
+		set, args = set+", tag=?", append(args, s.tag())
+	}
+	stmts := []statement{{query: "UPDATE testData set " + set + " WHERE id=?", args: append(args, id)}}
+
+	if s.relational {
+		stmts = append(stmts, statement{query: "UPDATE testChild set value=? WHERE parent_id=?", args: []interface{}{val, id}})
+	}
+	return stmts
+}
+
+// maxBatch is the most ids a single insert can take before running out of
+// bind variables
+func (s schema) maxBatch() int {
+	perRow := 2
+	if s.realistic {
+		perRow += 2
+	}
+	if s.hasPayload() {
+		perRow++
+	}
+	if s.collation != "" {
+		perRow++
+	}
+	if s.versioned {
+		perRow++
+	}
+	if s.relational {
+		perRow = 3 * childrenPerParent
+	}
+	return maxVariables / perRow
+}
+
+// insert adds a row for each of ids with val. More than one id becomes a
+// single multi row VALUES statement.
+func (s schema) insert(val int, ids ...int) []statement {
+	columns := s.testDataColumns()
+	parent := statement{query: "INSERT INTO testData(" + columns + ") VALUES "}
+	placeholders := "(?" + strings.Repeat(",?", strings.Count(columns, ",")) + ")"
+	child := statement{query: "INSERT INTO testChild(id, parent_id, value) VALUES "}
+
+	for i, id := range ids {
+		if i > 0 {
+			parent.query += ","
+		}
+		v := s.value(val)
+		parent.query += placeholders
+		parent.args = append(parent.args, s.rowArgs(id, v)...)
+
+		for c := 0; c < childrenPerParent; c++ {
+			if len(child.args) > 0 {
+				child.query += ","
+			}
+			child.query += "(?,?,?)"
+			child.args = append(child.args, id*childrenPerParent+c, id, v)
+		}
+	}
+
+	if s.relational {
+		return []statement{parent, child}
+	}
+	return []statement{parent}
+}
+
+// rowArgs are the testDataColumns of a new row id with val
+func (s schema) rowArgs(id, val int) []interface{} {
+	args := []interface{}{id, val}
+	if s.realistic {
+		name, email := s.person()
+		args = append(args, name, email)
+	}
+	if s.hasPayload() {
+		args = append(args, s.payload())
+	}
+	if s.collation != "" {
+		args = append(args, s.tag())
+	}
+	if s.versioned {
+		args = append(args, 0)
+	}
+	return args
+}
+
+// tag returns a random mixed case tag, the collation has to fold every
+// letter it compares
+func (s schema) tag() string {
+	b := make([]byte, tagSize)
+	for i := range b {
+		b[i] = payloadLetters[random.Intn(len(payloadLetters))]
+	}
+	return string(b)
+}
+
+// upsert inserts row id or updates its value when it already exists, val is
+// expected to have been through s.value already
+func (s schema) upsert(id, val int) []statement {
+	columns := s.testDataColumns()
+	parent := statement{
+		query: "INSERT INTO testData(" + columns + ") VALUES (?" + strings.Repeat(",?", strings.Count(columns, ",")) + ")" +
+			" ON CONFLICT(id) DO UPDATE SET value=excluded.value",
+		args: s.rowArgs(id, val),
+	}
+	if s.hasPayload() {
+		parent.query += ", data=excluded.data"
+	}
+	if s.collation != "" {
+		parent.query += ", tag=excluded.tag"
+	}
+	stmts := []statement{parent}
+
+	if s.relational {
+		for c := 0; c < childrenPerParent; c++ {
+			stmts = append(stmts, statement{
+				query: "INSERT INTO testChild(id, parent_id, value) VALUES (?,?,?) ON CONFLICT(id) DO UPDATE SET value=excluded.value",
+				args:  []interface{}{id*childrenPerParent + c, id, val},
+			})
+		}
+	}
+	return stmts
+}
+
+// updateReturning sets the value of row id and reads it back in the same
+// statement, it has to be run as a query
+func (s schema) updateReturning(id, val int) statement {
+	return statement{query: "UPDATE testData SET value=? WHERE id=? RETURNING value", args: []interface{}{val, id}}
+}
+
+// flip moves row id in or out of the partial index, a positive value becomes
+// 0 and 0 becomes val
+func (s schema) flip(id, val int) statement {
+	return statement{
+		query: "UPDATE testData SET value = CASE WHEN value > 0 THEN 0 ELSE ? END WHERE id=?",
+		args:  []interface{}{val, id},
+	}
+}
+
+// savepoint, release and rollbackTo manage the named savepoint inside a
+// transaction
+func (s schema) savepoint(name string) statement {
+	return statement{query: "SAVEPOINT " + name}
+}
+
+func (s schema) release(name string) statement {
+	return statement{query: "RELEASE " + name}
+}
+
+func (s schema) rollbackTo(name string) statement {
+	return statement{query: "ROLLBACK TO " + name}
+}
+
+// crossUpdate sets the value of row id in both the main and the attached
+// database, run together they are one transaction across both files
+func (s schema) crossUpdate(id, val int) []statement {
+	return []statement{
+		{query: "UPDATE testData set value=? WHERE id=?", args: []interface{}{val, id}},
+		{query: "UPDATE aux.auxData set value=? WHERE id=?", args: []interface{}{val, id}},
+	}
+}
+
+// readVersion selects the version of row id
+func (s schema) readVersion(id int) statement {
+	return statement{query: "SELECT version FROM testData WHERE id=?", args: []interface{}{id}}
+}
+
+// setVersion sets the value and version of row id
+func (s schema) setVersion(id, val int, version int64) statement {
+	return statement{query: "UPDATE testData set value=?, version=? WHERE id=?", args: []interface{}{val, version, id}}
+}
+
+// readValue selects the value of row id
+func (s schema) readValue(id int) statement {
+	return statement{query: "SELECT value FROM testData WHERE id=?", args: []interface{}{id}}
+}
+
+// setValue sets only the value of row id
+func (s schema) setValue(id int, val int64) statement {
+	return statement{query: "UPDATE testData set value=? WHERE id=?", args: []interface{}{val, id}}
+}
+
+// touch writes row id without changing it, enough to take the write lock
+func (s schema) touch(id int) statement {
+	return statement{query: "UPDATE testData SET value=value WHERE id=?", args: []interface{}{id}}
+}
+
+// increment adds one to the value of row id
+func (s schema) increment(id int) statement {
+	return statement{query: "UPDATE testData SET value = value + 1 WHERE id=?", args: []interface{}{id}}
+}
+
+// sumValues adds up the value of every row
+func (s schema) sumValues() statement {
+	return statement{query: "SELECT COALESCE(SUM(value), 0) FROM testData"}
+}
+
+// bumpSeq moves writeSeq on to the next sequence
+func (s schema) bumpSeq() statement {
+	return statement{query: "UPDATE writeSeq SET seq = seq + 1"}
+}
+
+// readSeq selects the current sequence of writeSeq
+func (s schema) readSeq() statement {
+	return statement{query: "SELECT seq FROM writeSeq"}
+}
+
+// count is the cheap COUNT(*) a health check or dashboard polls
+func (s schema) count() statement {
+	return statement{query: "SELECT COUNT(*) FROM testData"}
+}
+
+// enqueue adds a new job to the jobs table
+func (s schema) enqueue(val int) statement {
+	return statement{query: "INSERT INTO jobs(status, payload) VALUES ('new', ?)", args: []interface{}{val}}
+}
+
+// claim marks the oldest new job as claimed. Without RETURNING (sqlite 3.35+)
+// the single statement is what keeps two consumers from claiming the same
+// job, zero rows affected means the queue was empty.
+func (s schema) claim() statement {
+	return statement{query: "UPDATE jobs SET status='claimed' WHERE id = (SELECT id FROM jobs WHERE status='new' ORDER BY id LIMIT 1)"}
+}
+
+// appendEvent adds an event stamped with the current time
+func (s schema) appendEvent(val int) statement {
+	return statement{query: "INSERT INTO events(ts, value) VALUES (?,?)", args: []interface{}{time.Now().UnixNano(), val}}
+}
+
+// recentEvents summarises the events in the last window
+func (s schema) recentEvents() statement {
+	since := time.Now().Add(-s.window).UnixNano()
+	return statement{
+		query: "SELECT COUNT(*), COALESCE(AVG(value), 0) FROM events WHERE ts >= ?",
+		args:  []interface{}{since},
+	}
+}
+
+// insertBox adds a random box to the rtree
+func (s schema) insertBox() statement {
+	x, y := random.Float64()*spatialExtent, random.Float64()*spatialExtent
+	return statement{
+		query: "INSERT INTO boxes(minX, maxX, minY, maxY) VALUES (?,?,?,?)",
+		args:  []interface{}{x, x + random.Float64()*boxSize, y, y + random.Float64()*boxSize},
+	}
+}
+
+// virtualRead reads row id of the vData virtual table
+func (s schema) virtualRead(id int) statement {
+	return statement{query: "SELECT id, value FROM vData WHERE id=?", args: []interface{}{id}}
+}
+
+// virtualUpdate sets the value of row id of the vData virtual table
+func (s schema) virtualUpdate(id, val int) statement {
+	return statement{query: "UPDATE vData SET value=? WHERE id=?", args: []interface{}{val, id}}
+}
+
+// boxesWithin finds the boxes overlapping a random bounding box
+func (s schema) boxesWithin() statement {
+	x, y := random.Float64()*spatialExtent, random.Float64()*spatialExtent
+	return statement{
+		query: "SELECT id FROM boxes WHERE minX <= ? AND maxX >= ? AND minY <= ? AND maxY >= ?",
+		args:  []interface{}{x + bboxSize, x, y + bboxSize, y},
+	}
+}
+
+func (s schema) delete(id int) []statement {
+	stmts := []statement{{query: "DELETE FROM testData WHERE id=?", args: []interface{}{id}}}
+	if s.relational {
+		stmts = append(stmts, statement{query: "DELETE FROM testChild WHERE parent_id=?", args: []interface{}{id}})
+	}
+	return stmts
+}
+
+// payload returns valueSize random bytes, as a []byte for blobs or a string.
+// With realistic data the string is made of words.
+func (s schema) payload() interface{} {
+	if s.realistic && !s.blob {
+		return fakeText(s.valueSize)
+	}
+	if s.blob {
+		// random.Read is not safe for concurrent use, random.Intn is
+		b := make([]byte, s.valueSize)
+		for i := range b {
+			b[i] = byte(random.Intn(256))
+		}
+		return b
+	}
+
+	b := make([]byte, s.valueSize)
+	for i := range b {
+		b[i] = payloadLetters[random.Intn(len(payloadLetters))]
+	}
+	return string(b)
+}
+
+// create makes the test tables
+func (s schema) create(db *sql.DB) error {
+	for _, query := range s.createSQL() {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fill creates the records the test will be using
+func (s schema) fill(db *sql.DB, numRows int) error {
+	if s.sequenced {
+		if _, err := db.Exec("INSERT INTO writeSeq(seq) VALUES (0)"); err != nil {
+			return err
+		}
+	}
+	for i := 0; i <= numRows; i++ {
+		stmts := s.insert(0, i)
+		if s.attached {
+			stmts = append(stmts, statement{query: "INSERT INTO aux.auxData(id, value) VALUES (?,?)", args: []interface{}{i, 0}})
+		}
+		for _, stmt := range stmts {
+			if _, err := db.Exec(stmt.query, stmt.args...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
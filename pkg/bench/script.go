@@ -0,0 +1,420 @@
+package bench
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/mostlygeek/go-sqlite3-locking/pkg/workloads"
+	"go.starlark.net/starlark"
+)
+
+// scriptWorkload is a workload described by a -script written in Starlark.
+// The script sets these globals, all optional except for at least one op:
+//
+//	setup         list of SQL statements run once before the test
+//	reads, writes dicts of op function name to weight, readers pick from
+//	              reads and writers from writes
+//	rows          ids key() picks from, defaults to -rows
+//	distribution  how key() picks ids, defaults to -distribution
+//	rate          writer ops per second, 0 is as fast as possible
+//	checks        dict of SQL returning one integer to the value it must
+//	              have after the run
+//
+// Op functions take no arguments and return query(sql, args...) or
+// exec(sql, args...), or a list of them which runs in one transaction.
+// key(), new_key(), randint(lo, hi) and randstring(n) are predeclared.
+// The globals are frozen once the script ran, op functions are called from
+// every reader and writer at once and can not change them.
+type scriptWorkload struct {
+	path    string
+	globals starlark.StringDict
+	keys    *keySpace
+
+	// threads hands every op function call a thread of its own, they are
+	// not safe for concurrent use
+	threads sync.Pool
+
+	setup  []string
+	reads  scriptMix
+	writes scriptMix
+	rate   int
+	checks map[string]int64
+}
+
+// scriptMix is a weighted choice of op functions
+type scriptMix struct {
+	names   []string
+	funcs   []starlark.Callable
+	weights []int
+	total   int
+}
+
+func (m scriptMix) pick() (string, starlark.Callable) {
+	n := random.Intn(m.total)
+	for i, w := range m.weights {
+		if n < w {
+			return m.names[i], m.funcs[i]
+		}
+		n -= w
+	}
+	panic("unreachable")
+}
+
+// scriptStatement is what query() and exec() return to a script
+type scriptStatement struct {
+	read bool
+	s    statement
+}
+
+func (s *scriptStatement) String() string        { return s.s.query }
+func (s *scriptStatement) Type() string          { return "statement" }
+func (s *scriptStatement) Freeze()               {}
+func (s *scriptStatement) Truth() starlark.Bool  { return starlark.True }
+func (s *scriptStatement) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: statement") }
+
+// loadScript runs the script at path and reads its globals. numRows and dist
+// are the key space used when the script does not set rows or distribution.
+func loadScript(path string, numRows int, dist string) (*scriptWorkload, error) {
+	w := &scriptWorkload{path: path}
+	w.threads.New = func() interface{} { return &starlark.Thread{Name: path} }
+
+	predeclared := starlark.StringDict{
+		"query":      starlark.NewBuiltin("query", scriptQuery(true)),
+		"exec":       starlark.NewBuiltin("exec", scriptQuery(false)),
+		"key":        starlark.NewBuiltin("key", w.key),
+		"new_key":    starlark.NewBuiltin("new_key", w.newKey),
+		"randint":    starlark.NewBuiltin("randint", scriptRandint),
+		"randstring": starlark.NewBuiltin("randstring", scriptRandstring),
+	}
+	globals, err := starlark.ExecFile(&starlark.Thread{Name: path}, path, nil, predeclared)
+	if err != nil {
+		return nil, err
+	}
+	globals.Freeze()
+	w.globals = globals
+
+	if v, ok := globals["rows"]; ok {
+		if numRows, err = starlark.AsInt32(v); err != nil {
+			return nil, fmt.Errorf("rows: %v", err)
+		}
+	}
+	if v, ok := globals["distribution"]; ok {
+		s, ok := starlark.AsString(v)
+		if !ok {
+			return nil, fmt.Errorf("distribution must be a string, got %s", v.Type())
+		}
+		dist = s
+	}
+	if w.keys, err = newKeySpace(numRows, dist); err != nil {
+		return nil, err
+	}
+
+	if v, ok := globals["setup"]; ok {
+		list, ok := v.(*starlark.List)
+		if !ok {
+			return nil, fmt.Errorf("setup must be a list of SQL statements, got %s", v.Type())
+		}
+		for i := 0; i < list.Len(); i++ {
+			s, ok := starlark.AsString(list.Index(i))
+			if !ok {
+				return nil, fmt.Errorf("setup[%d] must be a string, got %s", i, list.Index(i).Type())
+			}
+			w.setup = append(w.setup, s)
+		}
+	}
+
+	if w.reads, err = w.mix("reads"); err != nil {
+		return nil, err
+	}
+	if w.writes, err = w.mix("writes"); err != nil {
+		return nil, err
+	}
+	if w.reads.total == 0 && w.writes.total == 0 {
+		return nil, fmt.Errorf("%s has no reads or writes", path)
+	}
+
+	if v, ok := globals["rate"]; ok {
+		if w.rate, err = starlark.AsInt32(v); err != nil {
+			return nil, fmt.Errorf("rate: %v", err)
+		}
+	}
+
+	if v, ok := globals["checks"]; ok {
+		dict, ok := v.(*starlark.Dict)
+		if !ok {
+			return nil, fmt.Errorf("checks must be a dict of SQL to value, got %s", v.Type())
+		}
+		w.checks = make(map[string]int64)
+		for _, item := range dict.Items() {
+			query, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("checks keys must be SQL strings, got %s", item[0].Type())
+			}
+			want, err := starlark.AsInt32(item[1])
+			if err != nil {
+				return nil, fmt.Errorf("checks[%q]: %v", query, err)
+			}
+			w.checks[query] = int64(want)
+		}
+	}
+	return w, nil
+}
+
+// mix reads the reads or writes global
+func (w *scriptWorkload) mix(global string) (scriptMix, error) {
+	var m scriptMix
+	v, ok := w.globals[global]
+	if !ok {
+		return m, nil
+	}
+	dict, ok := v.(*starlark.Dict)
+	if !ok {
+		return m, fmt.Errorf("%s must be a dict of op function name to weight, got %s", global, v.Type())
+	}
+
+	items := dict.Items()
+	sort.Slice(items, func(i, j int) bool { return items[i][0].String() < items[j][0].String() })
+	for _, item := range items {
+		name, ok := starlark.AsString(item[0])
+		if !ok {
+			return m, fmt.Errorf("%s keys must be op function names, got %s", global, item[0].Type())
+		}
+		fn, ok := w.globals[name].(starlark.Callable)
+		if !ok {
+			return m, fmt.Errorf("%s: %q is not a function", global, name)
+		}
+		weight, err := starlark.AsInt32(item[1])
+		if err != nil || weight < 0 {
+			return m, fmt.Errorf("%s: invalid weight for %s: %s", global, name, item[1])
+		}
+		m.names, m.funcs, m.weights = append(m.names, name), append(m.funcs, fn), append(m.weights, weight)
+		m.total += weight
+	}
+	return m, nil
+}
+
+func (w *scriptWorkload) Setup(ctx context.Context, db *sql.DB) error {
+	for _, query := range w.setup {
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("%s: %v", query, err)
+		}
+	}
+	return nil
+}
+
+func (w *scriptWorkload) ReadOp() workloads.Op {
+	if w.reads.total == 0 {
+		return w.op(w.writes)
+	}
+	return w.op(w.reads)
+}
+
+func (w *scriptWorkload) WriteOp() workloads.Op {
+	if w.writes.total == 0 {
+		return w.op(w.reads)
+	}
+	return w.op(w.writes)
+}
+
+// op calls one of the op functions of m. The statements it returns are run
+// on every attempt, a broken script returns an op that fails the test.
+func (w *scriptWorkload) op(m scriptMix) workloads.Op {
+	name, fn := m.pick()
+	thread := w.threads.Get().(*starlark.Thread)
+	v, err := starlark.Call(thread, fn, nil, nil)
+	w.threads.Put(thread)
+	if err == nil {
+		var op workloads.Op
+		if op, err = scriptOp(name, v); err == nil {
+			return op
+		}
+	}
+	err = fatalError{fmt.Errorf("script error: %v", err)}
+	return workloads.Op{
+		Name: name,
+		Run: func(ctx context.Context, c workloads.Conn) error {
+			return err
+		},
+	}
+}
+
+// scriptOp turns the value an op function returned into an op
+func scriptOp(name string, v starlark.Value) (workloads.Op, error) {
+	if s, ok := v.(*scriptStatement); ok {
+		return workloads.Op{
+			Name: name,
+			Read: s.read,
+			Run: func(ctx context.Context, c workloads.Conn) error {
+				w := asWorker(c)
+				if s.read {
+					return w.query(ctx, s.s, nil)
+				}
+				_, err := w.exec(ctx, s.s)
+				return err
+			},
+		}, nil
+	}
+
+	list, ok := v.(*starlark.List)
+	if !ok || list.Len() == 0 {
+		return workloads.Op{}, fmt.Errorf("expected query(), exec() or a list of them, got %s", v)
+	}
+	var stmts []*scriptStatement
+	read := true
+	for i := 0; i < list.Len(); i++ {
+		s, ok := list.Index(i).(*scriptStatement)
+		if !ok {
+			return workloads.Op{}, fmt.Errorf("expected query() or exec() in the list, got %s", list.Index(i))
+		}
+		stmts, read = append(stmts, s), read && s.read
+	}
+	return workloads.Op{
+		Name: name,
+		Read: read,
+		Run: func(ctx context.Context, c workloads.Conn) error {
+			return asWorker(c).tx(ctx, func(tx txConn) error {
+				for _, s := range stmts {
+					var err error
+					if s.read {
+						_, _, err = tx.queryInt(ctx, s.s)
+					} else {
+						_, err = tx.exec(ctx, s.s)
+					}
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		},
+	}, nil
+}
+
+// Verify runs the checks
+func (w *scriptWorkload) Verify(ctx context.Context, c workloads.Conn) error {
+	queries := make([]string, 0, len(w.checks))
+	for query := range w.checks {
+		queries = append(queries, query)
+	}
+	sort.Strings(queries)
+
+	for _, query := range queries {
+		var got int64
+		err := asWorker(c).tx(ctx, func(tx txConn) error {
+			var err error
+			got, _, err = tx.queryInt(ctx, statement{query: query})
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("check %s: %v", query, err)
+		}
+		if got != w.checks[query] {
+			return fmt.Errorf("check failed, %s returned %d, expected %d", query, got, w.checks[query])
+		}
+	}
+	if len(queries) > 0 {
+		fmt.Println()
+		fmt.Println()
+		fmt.Println("Script checks passed:", len(queries))
+	}
+	return nil
+}
+
+// scriptQuery is the query() or exec() builtin
+func scriptQuery(read bool) func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+	return func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if len(args) == 0 || len(kwargs) > 0 {
+			return nil, fmt.Errorf("%s: expected the SQL and its arguments", b.Name())
+		}
+		query, ok := starlark.AsString(args[0])
+		if !ok {
+			return nil, fmt.Errorf("%s: SQL must be a string, got %s", b.Name(), args[0].Type())
+		}
+
+		s := &scriptStatement{read: read, s: statement{query: query}}
+		for _, arg := range args[1:] {
+			v, err := scriptArg(arg)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", b.Name(), err)
+			}
+			s.s.args = append(s.s.args, v)
+		}
+		return s, nil
+	}
+}
+
+// scriptArg converts a Starlark value to a statement argument
+func scriptArg(v starlark.Value) (interface{}, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case starlark.Int:
+		n, ok := v.Int64()
+		if !ok {
+			return nil, fmt.Errorf("%s does not fit in 64 bits", v)
+		}
+		return n, nil
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Bytes:
+		return []byte(v), nil
+	default:
+		return nil, fmt.Errorf("unsupported argument type %s", v.Type())
+	}
+}
+
+func (w *scriptWorkload) key(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	if w.keys == nil {
+		return nil, fmt.Errorf("%s: can only be called from op functions", b.Name())
+	}
+	return starlark.MakeInt(w.keys.existing()), nil
+}
+
+func (w *scriptWorkload) newKey(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	if w.keys == nil {
+		return nil, fmt.Errorf("%s: can only be called from op functions", b.Name())
+	}
+	return starlark.MakeInt(w.keys.next(1)[0]), nil
+}
+
+func scriptRandint(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var lo, hi int
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "lo", &lo, "hi", &hi); err != nil {
+		return nil, err
+	}
+	if lo > hi {
+		return nil, fmt.Errorf("%s: lo %d is larger than hi %d", b.Name(), lo, hi)
+	}
+	return starlark.MakeInt(lo + random.Intn(hi-lo+1)), nil
+}
+
+func scriptRandstring(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var n int
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "n", &n); err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("%s: n must not be negative", b.Name())
+	}
+	buf := make([]byte, n)
+	for i := range buf {
+		buf[i] = payloadLetters[random.Intn(len(payloadLetters))]
+	}
+	return starlark.String(buf), nil
+}
@@ -0,0 +1,45 @@
+package bench
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// random makes every random choice of the benchmark, the values written, the
+// rows picked and the ops run, so -seed can repeat them. Unlike a rand.Rand
+// of its own it is safe for concurrent use.
+var random = rand.New(&lockedSource{src: rand.NewSource(time.Now().UnixNano()).(rand.Source64)})
+
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source64
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Uint64()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+// seedRandom restarts random from seed, 0 picks one from the clock. It
+// returns the seed used.
+func seedRandom(seed int64) int64 {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	random.Seed(seed)
+	return seed
+}
@@ -0,0 +1,94 @@
+package bench
+
+import (
+	"math"
+	"sort"
+)
+
+// mannWhitney returns the two sided p value of the Mann-Whitney U test, the
+// chance of two samples at least this far apart when they come from the same
+// distribution. It makes no assumption about the shape of the distribution,
+// which for throughput is often skewed by a slow run. Without ties the p
+// value is exact, with ties it is the normal approximation.
+func mannWhitney(a, b []float64) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 1
+	}
+
+	// u counts the pairs where a beats b, a tie counting half
+	var u float64
+	for _, x := range a {
+		for _, y := range b {
+			switch {
+			case x > y:
+				u++
+			case x == y:
+				u += 0.5
+			}
+		}
+	}
+
+	all := append(append([]float64(nil), a...), b...)
+	sort.Float64s(all)
+	var ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j] == all[i] {
+			j++
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+
+	n1, n2 := float64(len(a)), float64(len(b))
+	if ties == 0 {
+		return exactU(len(a), len(b), math.Min(u, n1*n2-u))
+	}
+
+	n := n1 + n2
+	mean := n1 * n2 / 2
+	sd := math.Sqrt(n1 * n2 / 12 * (n + 1 - ties/(n*(n-1))))
+	if sd == 0 {
+		return 1
+	}
+	z := math.Max(math.Abs(u-mean)-0.5, 0) / sd
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// exactU returns the chance of a U of at most u, doubled for both sides, when
+// every ordering of the n1+n2 values is as likely
+func exactU(n1, n2 int, u float64) float64 {
+	// counts[m][k] is how many orderings of m values of one sample and n
+	// of the other have a U of k, built up one n at a time
+	counts := make([][]float64, n1+1)
+	for m := range counts {
+		counts[m] = []float64{1}
+	}
+	for n := 1; n <= n2; n++ {
+		next := make([][]float64, n1+1)
+		next[0] = []float64{1}
+		for m := 1; m <= n1; m++ {
+			// the largest value is either of the first sample, beating
+			// all n of the other, or of the second sample
+			c := make([]float64, m*n+1)
+			for k, ways := range next[m-1] {
+				c[k+n] += ways
+			}
+			for k, ways := range counts[m] {
+				c[k] += ways
+			}
+			next[m] = c
+		}
+		counts = next
+	}
+
+	var total, below float64
+	for k, ways := range counts[n1] {
+		total += ways
+		if float64(k) <= u {
+			below += ways
+		}
+	}
+	return math.Min(1, 2*below/total)
+}
@@ -0,0 +1,64 @@
+package bench
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMannWhitney(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		// fully separated samples, the p value is 2 over the number of
+		// orderings of the values
+		{"3 v 3", []float64{1, 2, 3}, []float64{4, 5, 6}, 2.0 / 20},
+		{"4 v 4", []float64{1, 2, 3, 4}, []float64{5, 6, 7, 8}, 2.0 / 70},
+		{"5 v 5", []float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 2.0 / 252},
+		{"either side", []float64{6, 7, 8, 9, 10}, []float64{1, 2, 3, 4, 5}, 2.0 / 252},
+		{"interleaved", []float64{1, 3, 5, 7}, []float64{2, 4, 6, 8}, 0.6857},
+		{"all tied", []float64{5, 5, 5}, []float64{5, 5, 5}, 1},
+		{"empty", nil, []float64{1, 2}, 1},
+	}
+	for _, tt := range tests {
+		if got := mannWhitney(tt.a, tt.b); math.Abs(got-tt.want) > 1e-4 {
+			t.Errorf("%s: mannWhitney = %.4f, want %.4f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMannWhitneyTies(t *testing.T) {
+	// with ties the normal approximation is used, it still tells apart
+	// samples that barely overlap from ones that are the same
+	apart := mannWhitney([]float64{1, 2, 2, 3, 4, 5}, []float64{5, 6, 7, 7, 8, 9})
+	same := mannWhitney([]float64{1, 2, 2, 3}, []float64{1, 2, 2, 3})
+	if apart > 0.05 {
+		t.Errorf("barely overlapping samples p = %.4f, want under 0.05", apart)
+	}
+	if same < 0.9 {
+		t.Errorf("identical samples p = %.4f, want about 1", same)
+	}
+}
+
+func TestExactU(t *testing.T) {
+	tests := []struct {
+		n1, n2 int
+		u      float64
+		want   float64
+	}{
+		{1, 1, 0, 1},
+		{2, 2, 0, 2.0 / 6},
+		{2, 2, 1, 4.0 / 6},
+		{3, 3, 0, 2.0 / 20},
+		{3, 3, 1, 4.0 / 20},
+		{2, 3, 0, 2.0 / 10},
+		{3, 2, 0, 2.0 / 10},
+		{4, 4, 8, 1},
+	}
+	for _, tt := range tests {
+		if got := exactU(tt.n1, tt.n2, tt.u); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("exactU(%d, %d, %g) = %.4f, want %.4f", tt.n1, tt.n2, tt.u, got, tt.want)
+		}
+	}
+}
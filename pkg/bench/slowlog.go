@@ -0,0 +1,97 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// slowLog prints every statement that takes longer than threshold for
+// -slow-threshold, so a latency spike can be tied to the statement behind it
+type slowLog struct {
+	threshold time.Duration
+	count     int64
+}
+
+// log prints stmts when they took longer than the threshold. retries is how
+// many times the op had already been retried.
+func (l *slowLog) log(took time.Duration, retries int64, stmts ...statement) {
+	if took < l.threshold {
+		return
+	}
+	atomic.AddInt64(&l.count, 1)
+
+	queries := make([]string, len(stmts))
+	for i, s := range stmts {
+		queries[i] = s.query
+		if len(s.args) > 0 {
+			queries[i] += fmt.Sprint(" ", s.args)
+		}
+	}
+	fmt.Printf("\nSlow statement: %s, %d retries: %s\n", took.Round(time.Microsecond), retries, strings.Join(queries, "; "))
+}
+
+// timedWorker times every statement run through worker for -slow-threshold
+// and -stmt-stats, either of which may be nil
+type timedWorker struct {
+	worker
+	slow    *slowLog
+	stats   *stmtStats
+	retries int64
+}
+
+// observe hands stmts that started at start and ended with err to the slow
+// log and the statement stats
+func (w timedWorker) observe(start time.Time, err error, stmts ...statement) {
+	took := time.Since(start)
+	if w.slow != nil {
+		w.slow.log(took, w.retries, stmts...)
+	}
+	if w.stats != nil {
+		w.stats.add(took, err, stmts...)
+	}
+}
+
+func (w timedWorker) query(ctx context.Context, s statement, fn rowFunc) error {
+	start := time.Now()
+	err := w.worker.query(ctx, s, fn)
+	w.observe(start, err, s)
+	return err
+}
+
+// exec times stmts together, when there is more than one they are a single
+// transaction and its commit can be the slow part
+func (w timedWorker) exec(ctx context.Context, stmts ...statement) (int64, error) {
+	start := time.Now()
+	n, err := w.worker.exec(ctx, stmts...)
+	w.observe(start, err, stmts...)
+	return n, err
+}
+
+func (w timedWorker) tx(ctx context.Context, fn func(txConn) error) error {
+	return w.worker.tx(ctx, func(tx txConn) error {
+		return fn(timedTx{tx, w})
+	})
+}
+
+// timedTx times the statements run inside a timedWorker's tx
+type timedTx struct {
+	txConn
+	w timedWorker
+}
+
+func (t timedTx) queryInt(ctx context.Context, s statement) (int64, bool, error) {
+	start := time.Now()
+	val, found, err := t.txConn.queryInt(ctx, s)
+	t.w.observe(start, err, s)
+	return val, found, err
+}
+
+func (t timedTx) exec(ctx context.Context, s statement) (int64, error) {
+	start := time.Now()
+	n, err := t.txConn.exec(ctx, s)
+	t.w.observe(start, err, s)
+	return n, err
+}
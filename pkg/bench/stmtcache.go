@@ -0,0 +1,160 @@
+package bench
+
+import (
+	"container/list"
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// stmtCache holds a raw worker's prepared statements. Past size statements
+// the least recently used one is closed, a size of 0 never evicts.
+type stmtCache struct {
+	size  int
+	stats *stmtCacheStats
+
+	// order has the most recently used statement at the front
+	order *list.List
+	stmts map[string]*list.Element
+}
+
+type cachedStmt struct {
+	query string
+	stmt  driver.Stmt
+}
+
+// stmtCacheStats counts statement cache lookups across every raw worker
+type stmtCacheStats struct {
+	hits, misses int64
+}
+
+func newStmtCache(size int, stats *stmtCacheStats) *stmtCache {
+	return &stmtCache{
+		size:  size,
+		stats: stats,
+		order: list.New(),
+		stmts: make(map[string]*list.Element),
+	}
+}
+
+// get returns the prepared statement for query, preparing it on conn when it
+// is not cached
+func (c *stmtCache) get(conn *sqlite3.SQLiteConn, query string) (driver.Stmt, error) {
+	if e, ok := c.stmts[query]; ok {
+		atomic.AddInt64(&c.stats.hits, 1)
+		c.order.MoveToFront(e)
+		return e.Value.(*cachedStmt).stmt, nil
+	}
+
+	atomic.AddInt64(&c.stats.misses, 1)
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return nil, fmt.Errorf("prepare %s: %w", query, err)
+	}
+	c.stmts[query] = c.order.PushFront(&cachedStmt{query: query, stmt: stmt})
+
+	if c.size > 0 && c.order.Len() > c.size {
+		oldest := c.order.Remove(c.order.Back()).(*cachedStmt)
+		delete(c.stmts, oldest.query)
+		oldest.stmt.Close()
+	}
+	return stmt, nil
+}
+
+func (c *stmtCache) close() {
+	for _, e := range c.stmts {
+		e.Value.(*cachedStmt).stmt.Close()
+	}
+}
+
+// hitRate returns the percentage of lookups that found a prepared statement
+func (s *stmtCacheStats) hitRate() float64 {
+	hits, misses := atomic.LoadInt64(&s.hits), atomic.LoadInt64(&s.misses)
+	if hits+misses == 0 {
+		return 0
+	}
+	return 100 * float64(hits) / float64(hits+misses)
+}
+
+// parseCacheSizes parses a comma separated list of -stmt-cache sizes
+func parseCacheSizes(s string) ([]int, error) {
+	var sizes []int
+	for _, field := range strings.Split(s, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid size %q, expected a number >= 0", field)
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+// cacheSizeName names a -stmt-cache size in the output
+func cacheSizeName(size int) string {
+	if size == 0 {
+		return "unbounded"
+	}
+	return strconv.Itoa(size)
+}
+
+// variantWorkers wraps the workers from newWorker so every statement is
+// prefixed with one of n comments. Each query then has n distinct SQL texts,
+// as an application building its SQL on the fly would, and a statement cache
+// smaller than that starts missing.
+func variantWorkers(newWorker workerFactory, n int) workerFactory {
+	return func(ctx context.Context, reader bool) (worker, error) {
+		w, err := newWorker(ctx, reader)
+		if err != nil {
+			return nil, err
+		}
+		return variantWorker{worker: w, n: n}, nil
+	}
+}
+
+// variantWorker is the worker returned by variantWorkers
+type variantWorker struct {
+	worker
+	n int
+}
+
+func vary(s statement, n int) statement {
+	s.query = fmt.Sprintf("/* variant %d */ %s", random.Intn(n), s.query)
+	return s
+}
+
+func (w variantWorker) query(ctx context.Context, s statement, fn rowFunc) error {
+	return w.worker.query(ctx, vary(s, w.n), fn)
+}
+
+func (w variantWorker) exec(ctx context.Context, stmts ...statement) (int64, error) {
+	varied := make([]statement, len(stmts))
+	for i, s := range stmts {
+		varied[i] = vary(s, w.n)
+	}
+	return w.worker.exec(ctx, varied...)
+}
+
+func (w variantWorker) tx(ctx context.Context, fn func(txConn) error) error {
+	return w.worker.tx(ctx, func(tx txConn) error {
+		return fn(variantTx{tx, w.n})
+	})
+}
+
+// variantTx varies the statements run inside a variantWorker's tx
+type variantTx struct {
+	txConn
+	n int
+}
+
+func (t variantTx) queryInt(ctx context.Context, s statement) (int64, bool, error) {
+	return t.txConn.queryInt(ctx, vary(s, t.n))
+}
+
+func (t variantTx) exec(ctx context.Context, s statement) (int64, error) {
+	return t.txConn.exec(ctx, vary(s, t.n))
+}
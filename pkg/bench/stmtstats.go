@@ -0,0 +1,116 @@
+package bench
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxStmtStats is how many statements -stmt-stats lists
+const maxStmtStats = 10
+
+// stmtStats aggregates the latency and errors of every statement by its
+// normalized SQL for -stmt-stats, so a workload of many statements shows which
+// ones suffer under a locking strategy
+type stmtStats struct {
+	mu    sync.Mutex
+	bySQL map[string]*stmtStat
+}
+
+type stmtStat struct {
+	calls, errors int64
+	latency       latencies
+}
+
+func newStmtStats() *stmtStats {
+	return &stmtStats{bySQL: make(map[string]*stmtStat)}
+}
+
+var (
+	sqlComments = regexp.MustCompile(`/\*.*?\*/`)
+	sqlStrings  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	sqlNumbers  = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	sqlSpaces   = regexp.MustCompile(`\s+`)
+)
+
+// normalizeSQL strips comments, replaces literals with ? and collapses white
+// space, so statements that only differ in their values count as one
+func normalizeSQL(query string) string {
+	query = sqlComments.ReplaceAllString(query, " ")
+	query = sqlStrings.ReplaceAllString(query, "?")
+	query = sqlNumbers.ReplaceAllString(query, "?")
+	return strings.TrimSpace(sqlSpaces.ReplaceAllString(query, " "))
+}
+
+// add counts a call of stmts that took took and ended with err, more than one
+// statement are a single transaction
+func (s *stmtStats) add(took time.Duration, err error, stmts ...statement) {
+	queries := make([]string, len(stmts))
+	for i, stmt := range stmts {
+		queries[i] = normalizeSQL(stmt.query)
+	}
+	key := strings.Join(queries, "; ")
+
+	s.mu.Lock()
+	stat, ok := s.bySQL[key]
+	if !ok {
+		stat = &stmtStat{}
+		s.bySQL[key] = stat
+	}
+	s.mu.Unlock()
+
+	atomic.AddInt64(&stat.calls, 1)
+	if err != nil {
+		atomic.AddInt64(&stat.errors, 1)
+	}
+	stat.latency.add(took)
+}
+
+// reset forgets the calls so far, like the ones made during the warm up
+func (s *stmtStats) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bySQL = make(map[string]*stmtStat)
+}
+
+// stmtResult is what one normalized statement measured during the run
+type stmtResult struct {
+	query         string
+	calls, errors int64
+	total         time.Duration
+	latency       latencyStats
+}
+
+// results returns the statements that took the most time in total first
+func (s *stmtStats) results() []stmtResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var results []stmtResult
+	for query, stat := range s.bySQL {
+		r := stmtResult{
+			query:   query,
+			calls:   atomic.LoadInt64(&stat.calls),
+			errors:  atomic.LoadInt64(&stat.errors),
+			latency: stat.latency.stats(),
+		}
+		r.total = r.latency.avg * time.Duration(r.calls)
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].total > results[j].total })
+	return results
+}
+
+func printStmtResults(results []stmtResult) {
+	fmt.Println("Statements: ", len(results), "distinct, by total time")
+	if len(results) > maxStmtStats {
+		results = results[:maxStmtStats]
+	}
+	for _, r := range results {
+		fmt.Printf("  %d calls, %d errors, total %s, %s: %s\n", r.calls, r.errors, r.total.Round(time.Millisecond), r.latency, r.query)
+	}
+}
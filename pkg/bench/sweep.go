@@ -0,0 +1,155 @@
+package bench
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// the -metric values of a sweep's -csv
+const (
+	metricOps    = "ops"
+	metricReads  = "reads"
+	metricWrites = "writes"
+	metricP99    = "p99"
+)
+
+// sweepGrid is the runs of a sweep, every value of param with every value of
+// param2. Without param2 there is a single column.
+type sweepGrid struct {
+	param, param2 string
+	rows, columns []string
+}
+
+func newSweepGrid(fs *flag.FlagSet, param, values, param2, values2 string) (*sweepGrid, error) {
+	if err := checkSweepParam(fs, "-param", param); err != nil {
+		return nil, err
+	}
+	rows, err := expandValues(values)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -values, %v", err)
+	}
+	g := &sweepGrid{param: param, rows: rows, columns: []string{""}}
+
+	if param2 == "" {
+		if values2 != "" {
+			return nil, fmt.Errorf("-values2 needs -param2")
+		}
+		return g, nil
+	}
+	if err := checkSweepParam(fs, "-param2", param2); err != nil {
+		return nil, err
+	}
+	if param2 == param {
+		return nil, fmt.Errorf("invalid -param2, -%s is already -param", param2)
+	}
+	if g.columns, err = expandValues(values2); err != nil {
+		return nil, fmt.Errorf("invalid -values2, %v", err)
+	}
+	g.param2 = param2
+	return g, nil
+}
+
+// checkSweepParam returns an error when the flag name can not be swept
+func checkSweepParam(fs *flag.FlagSet, what, name string) error {
+	if fs.Lookup(name) == nil {
+		return fmt.Errorf("invalid %s, no flag -%s", what, name)
+	}
+	for _, fixed := range append(sweepFixed, "param", "values", "param2", "values2", "csv", "metric") {
+		if name == fixed {
+			return fmt.Errorf("invalid %s, -%s can not be swept", what, fixed)
+		}
+	}
+	return nil
+}
+
+// expandValues splits a comma separated list of values. An integer range
+// lo..hi stands for lo, 2*lo, 4*lo and so on up to hi, hi always included.
+func expandValues(spec string) ([]string, error) {
+	var values []string
+	for _, v := range strings.Split(spec, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return nil, fmt.Errorf("empty value in %q", spec)
+		}
+		bounds := strings.SplitN(v, "..", 2)
+		if len(bounds) == 1 {
+			values = append(values, v)
+			continue
+		}
+		lo, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("range %q, %v", v, err)
+		}
+		hi, err := strconv.Atoi(bounds[1])
+		if err != nil {
+			return nil, fmt.Errorf("range %q, %v", v, err)
+		}
+		if lo < 1 || hi < lo {
+			return nil, fmt.Errorf("range %q must go from at least 1 up", v)
+		}
+		for n := lo; n < hi; n *= 2 {
+			values = append(values, strconv.Itoa(n))
+		}
+		values = append(values, strconv.Itoa(hi))
+	}
+	return values, nil
+}
+
+func (g *sweepGrid) name() string {
+	if g.param2 == "" {
+		return g.param
+	}
+	return g.param + " and -" + g.param2
+}
+
+// variants returns a run for every cell, row by row
+func (g *sweepGrid) variants() []variant {
+	var runs []variant
+	for _, row := range g.rows {
+		for _, column := range g.columns {
+			v := variant{name: g.param + "=" + row, flags: []flagValue{{g.param, row}}}
+			if g.param2 != "" {
+				v.name += " " + g.param2 + "=" + column
+				v.flags = append(v.flags, flagValue{g.param2, column})
+			}
+			runs = append(runs, v)
+		}
+	}
+	return runs
+}
+
+// writeCSV writes the metric of every result as a matrix with a row for each
+// value of param and a column for each value of param2, results in the order
+// of variants. The top left cell names both params.
+func (g *sweepGrid) writeCSV(path, metric string, results []benchmarkResult) error {
+	var out io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := csv.NewWriter(out)
+	header := []string{g.param, metric}
+	if g.param2 != "" {
+		header = append([]string{g.param + `\` + g.param2}, g.columns...)
+	}
+	w.Write(header)
+	for i, row := range g.rows {
+		record := []string{row}
+		for j := range g.columns {
+			record = append(record, fmt.Sprintf("%.0f", results[i*len(g.columns)+j].mean(metric)))
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,41 @@
+package bench
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandValues(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"4", []string{"4"}},
+		{"1,2,4", []string{"1", "2", "4"}},
+		{" 1 , 2 ", []string{"1", "2"}},
+		{"1..8", []string{"1", "2", "4", "8"}},
+		{"3..10", []string{"3", "6", "10"}},
+		{"2..2", []string{"2"}},
+		{"1..4,100", []string{"1", "2", "4", "100"}},
+		{"wal,rollback", []string{"wal", "rollback"}},
+		{"10ms,1s", []string{"10ms", "1s"}},
+	}
+	for _, tt := range tests {
+		got, err := expandValues(tt.spec)
+		if err != nil {
+			t.Errorf("expandValues(%q): %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expandValues(%q) = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestExpandValuesInvalid(t *testing.T) {
+	for _, spec := range []string{"", "1,,2", "1,", "0..4", "4..2", "a..4", "1..b", "-2..4"} {
+		if got, err := expandValues(spec); err == nil {
+			t.Errorf("expandValues(%q) = %q, want an error", spec, got)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package bench
+
+import (
+	"fmt"
+	"sync"
+)
+
+// syncVFSName is the VFS -count-syncs opens the databases with. It passes
+// everything through to the default VFS and counts the xSync calls on the
+// way, the fsyncs that make a commit durable. It is only available when
+// built with -tags syncvfs, which needs the sqlite3.h header.
+const syncVFSName = "count_sync"
+
+// syncCounts are the xSync calls made by the sqlite connections, by the kind
+// of file synced
+type syncCounts struct {
+	db, journal, wal, other int64
+}
+
+func (c syncCounts) sub(o syncCounts) syncCounts {
+	return syncCounts{
+		db:      c.db - o.db,
+		journal: c.journal - o.journal,
+		wal:     c.wal - o.wal,
+		other:   c.other - o.other,
+	}
+}
+
+func (c syncCounts) total() int64 {
+	return c.db + c.journal + c.wal + c.other
+}
+
+// syncCounter measures the syncs during the measured part of a run, the
+// count_sync VFS counts them for the whole process
+type syncCounter struct {
+	mu    sync.Mutex
+	start syncCounts
+}
+
+// reset starts counting from now, like after the warm up
+func (s *syncCounter) reset() {
+	now := loadSyncCounts()
+	s.mu.Lock()
+	s.start = now
+	s.mu.Unlock()
+}
+
+// result returns the syncs since reset
+func (s *syncCounter) result() syncCounts {
+	now := loadSyncCounts()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return now.sub(s.start)
+}
+
+// print shows the syncs per write op as well
+func (c syncCounts) print(writes int64) {
+	perWrite := 0.0
+	if writes > 0 {
+		perWrite = float64(c.total()) / float64(writes)
+	}
+	fmt.Printf("Syncs: %d (%.2f/write op), database %d, journal %d, WAL %d, other %d\n",
+		c.total(), perWrite, c.db, c.journal, c.wal, c.other)
+}
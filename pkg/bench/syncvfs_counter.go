@@ -0,0 +1,179 @@
+//go:build syncvfs
+// +build syncvfs
+
+package bench
+
+/*
+#include <sqlite3.h>
+#include <string.h>
+
+// the kinds of file a sync is counted for, the fields of syncCounts
+enum { SYNC_DB, SYNC_JOURNAL, SYNC_WAL, SYNC_OTHER, SYNC_KINDS };
+
+static sqlite3_int64 syncs[SYNC_KINDS];
+
+// countFile is a file of the count_sync VFS, the default VFS's own file
+// follows it in memory
+typedef struct countFile {
+	const sqlite3_io_methods *pMethods;
+	int kind;
+} countFile;
+
+#define REAL(f) ((sqlite3_file *)(((countFile *)(f)) + 1))
+
+static sqlite3_vfs *root;
+static sqlite3_vfs countVFS;
+static sqlite3_io_methods countIO;
+
+static int countSync(sqlite3_file *f, int flags) {
+	__sync_fetch_and_add(&syncs[((countFile *)f)->kind], 1);
+	return REAL(f)->pMethods->xSync(REAL(f), flags);
+}
+
+static int countClose(sqlite3_file *f) {
+	return REAL(f)->pMethods->xClose(REAL(f));
+}
+static int countRead(sqlite3_file *f, void *p, int n, sqlite3_int64 off) {
+	return REAL(f)->pMethods->xRead(REAL(f), p, n, off);
+}
+static int countWrite(sqlite3_file *f, const void *p, int n, sqlite3_int64 off) {
+	return REAL(f)->pMethods->xWrite(REAL(f), p, n, off);
+}
+static int countTruncate(sqlite3_file *f, sqlite3_int64 size) {
+	return REAL(f)->pMethods->xTruncate(REAL(f), size);
+}
+static int countFileSize(sqlite3_file *f, sqlite3_int64 *size) {
+	return REAL(f)->pMethods->xFileSize(REAL(f), size);
+}
+static int countLock(sqlite3_file *f, int lock) {
+	return REAL(f)->pMethods->xLock(REAL(f), lock);
+}
+static int countUnlock(sqlite3_file *f, int lock) {
+	return REAL(f)->pMethods->xUnlock(REAL(f), lock);
+}
+static int countCheckReservedLock(sqlite3_file *f, int *out) {
+	return REAL(f)->pMethods->xCheckReservedLock(REAL(f), out);
+}
+static int countFileControl(sqlite3_file *f, int op, void *arg) {
+	return REAL(f)->pMethods->xFileControl(REAL(f), op, arg);
+}
+static int countSectorSize(sqlite3_file *f) {
+	return REAL(f)->pMethods->xSectorSize(REAL(f));
+}
+static int countDeviceCharacteristics(sqlite3_file *f) {
+	return REAL(f)->pMethods->xDeviceCharacteristics(REAL(f));
+}
+static int countShmMap(sqlite3_file *f, int region, int size, int extend, void volatile **pp) {
+	return REAL(f)->pMethods->xShmMap(REAL(f), region, size, extend, pp);
+}
+static int countShmLock(sqlite3_file *f, int offset, int n, int flags) {
+	return REAL(f)->pMethods->xShmLock(REAL(f), offset, n, flags);
+}
+static void countShmBarrier(sqlite3_file *f) {
+	REAL(f)->pMethods->xShmBarrier(REAL(f));
+}
+static int countShmUnmap(sqlite3_file *f, int deleteFlag) {
+	return REAL(f)->pMethods->xShmUnmap(REAL(f), deleteFlag);
+}
+static int countFetch(sqlite3_file *f, sqlite3_int64 off, int n, void **pp) {
+	return REAL(f)->pMethods->xFetch(REAL(f), off, n, pp);
+}
+static int countUnfetch(sqlite3_file *f, sqlite3_int64 off, void *p) {
+	return REAL(f)->pMethods->xUnfetch(REAL(f), off, p);
+}
+
+static int countOpen(sqlite3_vfs *vfs, const char *name, sqlite3_file *f, int flags, int *outFlags) {
+	countFile *cf = (countFile *)f;
+	int rc = root->xOpen(root, name, REAL(f), flags, outFlags);
+	if (rc != SQLITE_OK || REAL(f)->pMethods == 0) {
+		cf->pMethods = 0;
+		return rc;
+	}
+	if (flags & SQLITE_OPEN_MAIN_DB) {
+		cf->kind = SYNC_DB;
+	} else if (flags & SQLITE_OPEN_MAIN_JOURNAL) {
+		cf->kind = SYNC_JOURNAL;
+	} else if (flags & SQLITE_OPEN_WAL) {
+		cf->kind = SYNC_WAL;
+	} else {
+		cf->kind = SYNC_OTHER;
+	}
+	cf->pMethods = &countIO;
+	return SQLITE_OK;
+}
+
+// registerCountVFS registers count_sync in front of the default VFS, which
+// it copies everything but opening files from
+static int registerCountVFS(const char *name) {
+	root = sqlite3_vfs_find(0);
+	if (root == 0) {
+		return SQLITE_ERROR;
+	}
+	countVFS = *root;
+	countVFS.pNext = 0;
+	countVFS.zName = name;
+	countVFS.szOsFile = sizeof(countFile) + root->szOsFile;
+	countVFS.xOpen = countOpen;
+
+	countIO.iVersion = 3;
+	countIO.xClose = countClose;
+	countIO.xRead = countRead;
+	countIO.xWrite = countWrite;
+	countIO.xTruncate = countTruncate;
+	countIO.xSync = countSync;
+	countIO.xFileSize = countFileSize;
+	countIO.xLock = countLock;
+	countIO.xUnlock = countUnlock;
+	countIO.xCheckReservedLock = countCheckReservedLock;
+	countIO.xFileControl = countFileControl;
+	countIO.xSectorSize = countSectorSize;
+	countIO.xDeviceCharacteristics = countDeviceCharacteristics;
+	countIO.xShmMap = countShmMap;
+	countIO.xShmLock = countShmLock;
+	countIO.xShmBarrier = countShmBarrier;
+	countIO.xShmUnmap = countShmUnmap;
+	countIO.xFetch = countFetch;
+	countIO.xUnfetch = countUnfetch;
+	return sqlite3_vfs_register(&countVFS, 0);
+}
+
+static sqlite3_int64 loadSyncs(int kind) {
+	return __sync_fetch_and_add(&syncs[kind], 0);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"sync"
+
+	// the sqlite3 functions above are the ones go-sqlite3 links in
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	registerSyncOnce sync.Once
+	registerSyncErr  error
+)
+
+// registerSyncVFS makes the count_sync VFS available to every connection
+// opened afterwards
+func registerSyncVFS() error {
+	registerSyncOnce.Do(func() {
+		// sqlite keeps the name, so it is never freed
+		if rc := C.registerCountVFS(C.CString(syncVFSName)); rc != C.SQLITE_OK {
+			registerSyncErr = fmt.Errorf("registering the %s VFS failed with code %d", syncVFSName, int(rc))
+		}
+	})
+	return registerSyncErr
+}
+
+// loadSyncCounts returns the syncs counted so far
+func loadSyncCounts() syncCounts {
+	return syncCounts{
+		db:      int64(C.loadSyncs(C.SYNC_DB)),
+		journal: int64(C.loadSyncs(C.SYNC_JOURNAL)),
+		wal:     int64(C.loadSyncs(C.SYNC_WAL)),
+		other:   int64(C.loadSyncs(C.SYNC_OTHER)),
+	}
+}
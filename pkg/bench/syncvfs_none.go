@@ -0,0 +1,14 @@
+//go:build !syncvfs
+// +build !syncvfs
+
+package bench
+
+import "fmt"
+
+func registerSyncVFS() error {
+	return fmt.Errorf("%s needs a build with -tags syncvfs", syncVFSName)
+}
+
+func loadSyncCounts() syncCounts {
+	return syncCounts{}
+}
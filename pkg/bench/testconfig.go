@@ -0,0 +1,509 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/mostlygeek/go-sqlite3-locking/pkg/workloads"
+)
+
+// testConfig holds the knobs for a single runTest
+type testConfig struct {
+	writerCount int
+	readerCount int
+	numRows     int
+	numUpdates  int
+
+	// duration when set runs the test until it passes, ignoring numUpdates
+	duration time.Duration
+
+	// out is where the progress codes of the run are printed
+	out io.Writer
+
+	// warmup runs readers and writers before any measurements are taken so
+	// the page cache and connection pool are settled
+	warmup time.Duration
+
+	// readerMix and writerMix are the operations readers and writers pick
+	// from for every unit of work
+	readerMix mix
+	writerMix mix
+
+	// pollerCount readers run opPoll every pollInterval, 0 is flat out
+	pollerCount  int
+	pollInterval time.Duration
+
+	// snapshotHold when set keeps a read transaction open this long at a
+	// time, starving checkpoints in WAL mode and blocking writers otherwise.
+	// The holder's connection comes from newHolder, outside of the pools so
+	// holding it never keeps a reader or writer waiting for a connection.
+	snapshotHold time.Duration
+	newHolder    workerFactory
+
+	// dbFile, walFile and shmFile are sampled during the run for their
+	// sizes
+	dbFile, walFile, shmFile string
+
+	// pools when set samples the database/sql connection pools, nil with
+	// -raw workers that have none
+	pools *poolSampler
+
+	// runtime when set samples the Go heap and goroutines
+	runtime *runtimeSampler
+
+	// cpu when set samples the CPU used by the process and the system
+	cpu *cpuSampler
+
+	// io when set measures the I/O done by the process
+	io *ioSampler
+
+	// usage when set measures the resources used by the process
+	usage *usageSampler
+
+	// writeAmp when set counts the bytes written for -write-amp
+	writeAmp *writeAmp
+
+	// syncs when set counts the syncs of the count_sync VFS
+	syncs *syncCounter
+
+	// checkpoints when set runs and measures WAL checkpoints on an interval
+	checkpoints *checkpointer
+
+	// leaks when set watches the live heap and goroutines for growth
+	leaks *leakDetector
+
+	// stallHold when set has a chaos writer hold a write transaction this
+	// long every stallInterval
+	stallHold     time.Duration
+	stallInterval time.Duration
+
+	// quickCheck when set runs PRAGMA quick_check on an interval
+	quickCheck *quickChecker
+
+	// slow when set prints the statements slower than its threshold
+	slow *slowLog
+
+	// stmtStats when set measures every statement, see -stmt-stats
+	stmtStats *stmtStats
+
+	// watchdog when set reports the ops stuck for too long, see -stuck-after
+	watchdog *watchdog
+
+	// starvationWindow when set warns about every reader or writer that
+	// completed no ops in that long
+	starvationWindow time.Duration
+
+	// retryPolicy is which errors readers, writers and maintenance jobs
+	// retry, the first one that is not ends the run
+	retryPolicy string
+
+	// maintenance are one off jobs run partway through, in order of at
+	maintenance []maintenance
+
+	// distribution is how keySpace picks row ids
+	distribution string
+
+	// hotRow sends all updates to a single row
+	hotRow bool
+
+	// schema builds the statements for each op
+	schema schema
+
+	// txSize is how many write statements go into one transaction
+	txSize int
+
+	// batch is how many rows each insert statement adds
+	batch int
+
+	// rollbackRate is the chance a savepoint op rolls back each update
+	rollbackRate float64
+
+	// state when set tracks the updates and upserts for -verify
+	state *stateTracker
+
+	// versions when set tracks the row versions written by -versions updates
+	versions *versionTracker
+
+	// zeroRows counts the updates that matched no row, when set
+	zeroRows *int64
+
+	// reads when set checks the rows every read returns, see -check-reads
+	reads *readChecker
+
+	// staleness when set measures how far behind the reads are
+	staleness *staleness
+
+	// snapshotChecks runs the snapshot ops, set when the mixes have any
+	snapshotChecks *snapshotChecker
+
+	// file is the -workload-file behind fileread and filewrite ops
+	file *workloadFile
+
+	// workload hands out the ops readers and writers run
+	workload workloads.Workload
+
+	// recorder collects every successful op for -record
+	recorder *recorder
+
+	// replay replaces the generated ops, replaySpeed scales its timing
+	replay      *recording
+	replaySpeed float64
+
+	// writeRate limits the units of work handed to writers per second, 0
+	// is unlimited
+	writeRate int
+
+	// writeBurst is how many tokens the writeRate bucket holds, 0 is
+	// unlimited
+	writeBurst int
+
+	// readRate limits the reads of all readers together per second, 0 is
+	// unlimited, and readThink pauses each reader after every read
+	readRate  int
+	readThink time.Duration
+}
+
+// runOp runs a single op against w. val is the value to write and keys picks
+// the rows the op applies to. Write ops are repeated txSize times inside one
+// transaction.
+func (c testConfig) runOp(ctx context.Context, w worker, op opType, val int, keys *keySpace) error {
+	switch op {
+	case opRead:
+		if c.schema.paginated() {
+			return c.paginate(ctx, w)
+		}
+		id := keys.read()
+		fn, done := c.readRows(id)
+		if err := w.query(ctx, c.schema.read(id), fn); err != nil {
+			return err
+		}
+		done()
+		return nil
+	case opRecent:
+		return w.query(ctx, c.schema.recentEvents(), nil)
+	case opPoll:
+		return w.query(ctx, c.schema.count(), nil)
+	case opFileRead:
+		return w.query(ctx, c.file.next(true, keys, val), nil)
+	case opBBox:
+		return w.query(ctx, c.schema.boxesWithin(), nil)
+	case opVRead:
+		return w.query(ctx, c.schema.virtualRead(keys.read()), nil)
+	case opSnapshot:
+		return c.snapshotChecks.check(ctx, w, c.schema, keys.read())
+	case opReturning:
+		// RETURNING rows come back through a query, not exec
+		return w.query(ctx, c.schema.updateReturning(keys.existing(), val), nil)
+	case opClaim:
+		claimed, err := w.exec(ctx, c.schema.claim())
+		if err == nil && claimed == 0 {
+			// not a failure, the consumer just has nothing to do
+			return workloads.ErrSkip
+		}
+		return err
+	case opSavepoint:
+		return w.tx(ctx, func(tx txConn) error {
+			for i := 0; i < c.txSize; i++ {
+				if err := c.savepointUpdate(ctx, tx, keys.existing(), val); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case opUpdate:
+		if c.schema.versioned {
+			return c.versionedUpdate(ctx, w, keys, val)
+		}
+	case opRMW:
+		var missed int64
+		err := w.tx(ctx, func(tx txConn) error {
+			for i := 0; i < c.txSize; i++ {
+				found, err := c.readModifyWrite(ctx, tx, keys.existing())
+				if err != nil {
+					return err
+				}
+				if !found {
+					missed++
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			c.missed(missed)
+		}
+		return err
+	}
+
+	var stmts []statement
+	var written []rowValue
+	for i := 0; i < c.txSize; i++ {
+		switch op {
+		case opInsert:
+			stmts = append(stmts, c.schema.insert(val, keys.next(c.batch)...)...)
+		case opDelete:
+			stmts = append(stmts, c.schema.delete(keys.any())...)
+		case opUpsert:
+			id, v := keys.upsert(), c.schema.value(val)
+			stmts = append(stmts, c.schema.upsert(id, v)...)
+			written = append(written, rowValue{id, v})
+		case opIncrement:
+			stmts = append(stmts, c.schema.increment(keys.existing()))
+		case opEnqueue:
+			stmts = append(stmts, c.schema.enqueue(val))
+		case opAppend:
+			stmts = append(stmts, c.schema.appendEvent(val))
+		case opBox:
+			stmts = append(stmts, c.schema.insertBox())
+		case opVUpdate:
+			stmts = append(stmts, c.schema.virtualUpdate(keys.existing(), val))
+		case opFileWrite:
+			stmts = append(stmts, c.file.next(false, keys, val))
+		case opCross:
+			stmts = append(stmts, c.schema.crossUpdate(keys.existing(), val)...)
+		case opFlip:
+			stmts = append(stmts, c.schema.flip(keys.existing(), val+1))
+		case opRetain:
+			// keep a rolling window of rows, the newest in and the oldest out
+			id := keys.next(1)[0]
+			stmts = append(stmts, c.schema.insert(val, id)...)
+			stmts = append(stmts, c.schema.delete(keys.expired(id))...)
+		default:
+			id, v := keys.existing(), c.schema.value(val)
+			stmts = append(stmts, c.schema.update(id, v)...)
+			written = append(written, rowValue{id, v})
+		}
+	}
+
+	start := time.Now()
+	err := c.exec(ctx, w, stmts)
+	if err == nil && c.state != nil && len(written) > 0 {
+		c.state.record(start, time.Now(), written)
+	}
+	return err
+}
+
+// readRows returns what checks the rows of one read for -check-reads and
+// -staleness, nil when neither is on, and done to call once the read
+// succeeded
+func (c testConfig) readRows(id int) (rowFunc, func()) {
+	var p *probe
+	var r *staleRead
+	if c.reads != nil {
+		p = c.reads.probe(c.schema, id)
+	}
+	if c.staleness != nil {
+		r = c.staleness.read()
+	}
+
+	switch {
+	case p == nil && r == nil:
+		return nil, func() {}
+	case r == nil:
+		return p.row, p.done
+	case p == nil:
+		return r.row, r.done
+	}
+	fn := func(row []interface{}) error {
+		if err := p.row(row); err != nil {
+			return err
+		}
+		return r.row(row)
+	}
+	done := func() {
+		p.done()
+		r.done()
+	}
+	return fn, done
+}
+
+// paginate reads the whole table one page at a time. Pages are separate
+// statements outside of a transaction so writers can commit between them, the
+// way an application paging through results would see it.
+func (c testConfig) paginate(ctx context.Context, w worker) error {
+	fn, done := c.readRows(0)
+
+	offset, afterID := 0, int64(-1)
+	for {
+		rows := 0
+		err := w.query(ctx, c.schema.page(offset, afterID), func(row []interface{}) error {
+			rows++
+			id, ok := row[0].(int64)
+			if !ok {
+				return fmt.Errorf("page: expected an integer id, got %T", row[0])
+			}
+			afterID = id
+			if fn != nil {
+				return fn(row)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if rows < c.schema.rangeSize {
+			done()
+			return nil
+		}
+		offset += rows
+	}
+}
+
+// exec runs stmts on w, more than one inside a transaction, and counts every
+// UPDATE that matched no row once they commit. With -staleness the
+// transaction also bumps the write sequence, and publishes it on commit.
+func (c testConfig) exec(ctx context.Context, w worker, stmts []statement) error {
+	if len(stmts) == 1 && c.staleness == nil {
+		n, err := w.exec(ctx, stmts[0])
+		if err == nil && n == 0 && isUpdate(stmts[0]) {
+			c.missed(1)
+		}
+		return err
+	}
+
+	var missed, seq int64
+	err := w.tx(ctx, func(tx txConn) error {
+		for _, s := range stmts {
+			n, err := tx.exec(ctx, s)
+			if err != nil {
+				return err
+			}
+			if n == 0 && isUpdate(s) {
+				missed++
+			}
+		}
+		if c.staleness == nil {
+			return nil
+		}
+		if _, err := tx.exec(ctx, c.schema.bumpSeq()); err != nil {
+			return err
+		}
+		var err error
+		seq, _, err = tx.queryInt(ctx, c.schema.readSeq())
+		return err
+	})
+	if err == nil {
+		c.missed(missed)
+		if c.staleness != nil {
+			c.staleness.commit(seq)
+		}
+	}
+	return err
+}
+
+// isUpdate is true for UPDATE statements, which are expected to change the
+// row they target
+func isUpdate(s statement) bool {
+	return firstKeyword(s.query) == "UPDATE"
+}
+
+// firstKeyword returns the first word of query in upper case, after any
+// white space and comments
+func firstKeyword(query string) string {
+	for {
+		query = strings.TrimSpace(query)
+		switch {
+		case strings.HasPrefix(query, "--"):
+			end := strings.IndexByte(query, '\n')
+			if end < 0 {
+				return ""
+			}
+			query = query[end+1:]
+		case strings.HasPrefix(query, "/*"):
+			end := strings.Index(query, "*/")
+			if end < 0 {
+				return ""
+			}
+			query = query[end+2:]
+		default:
+			end := strings.IndexFunc(query, func(r rune) bool { return !unicode.IsLetter(r) })
+			if end < 0 {
+				end = len(query)
+			}
+			return strings.ToUpper(query[:end])
+		}
+	}
+}
+
+// missed counts n writes that silently matched no row
+func (c testConfig) missed(n int64) {
+	if c.zeroRows != nil && n > 0 {
+		atomic.AddInt64(c.zeroRows, n)
+	}
+}
+
+// versionedUpdate updates txSize rows in one transaction, reading each row's
+// version and writing it back one higher along with the new value. The
+// versions are only handed to the tracker once the transaction commits.
+func (c testConfig) versionedUpdate(ctx context.Context, w worker, keys *keySpace, val int) error {
+	var written []rowValue
+	var bumped []rowVersion
+	var missed int64
+	start := time.Now()
+	err := w.tx(ctx, func(tx txConn) error {
+		for i := 0; i < c.txSize; i++ {
+			id, v := keys.existing(), c.schema.value(val)
+			version, found, err := tx.queryInt(ctx, c.schema.readVersion(id))
+			if err != nil {
+				return err
+			}
+			if !found {
+				missed++
+				continue
+			}
+			if _, err := tx.exec(ctx, c.schema.setVersion(id, v, version+1)); err != nil {
+				return err
+			}
+			written = append(written, rowValue{id, v})
+			bumped = append(bumped, rowVersion{id, version + 1})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.missed(missed)
+	c.versions.record(bumped)
+	if c.state != nil {
+		c.state.record(start, time.Now(), written)
+	}
+	return nil
+}
+
+// readModifyWrite increments row id by reading it and writing it back. In a
+// deferred transaction the UPDATE has to upgrade the SHARED lock taken by the
+// SELECT, which is where SQLITE_BUSY deadlocks come from. It returns false
+// when there is no row id.
+func (c testConfig) readModifyWrite(ctx context.Context, tx txConn, id int) (bool, error) {
+	val, found, err := tx.queryInt(ctx, c.schema.readValue(id))
+	if err != nil || !found {
+		return false, err
+	}
+	_, err = tx.exec(ctx, c.schema.setValue(id, val+1))
+	return err == nil, err
+}
+
+// savepointUpdate updates row id inside a savepoint of the outer transaction
+// and rolls back to it rollbackRate of the time. RELEASE is needed either way,
+// ROLLBACK TO leaves the savepoint on the stack.
+func (c testConfig) savepointUpdate(ctx context.Context, tx txConn, id, val int) error {
+	const name = "update_row"
+	stmts := []statement{c.schema.savepoint(name)}
+	stmts = append(stmts, c.schema.update(id, c.schema.value(val))...)
+	if random.Float64() < c.rollbackRate {
+		stmts = append(stmts, c.schema.rollbackTo(name))
+	}
+	stmts = append(stmts, c.schema.release(name))
+
+	for _, s := range stmts {
+		if _, err := tx.exec(ctx, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
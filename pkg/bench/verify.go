@@ -0,0 +1,709 @@
+package bench
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mostlygeek/go-sqlite3-locking/pkg/dsn"
+)
+
+// untrackedWrites change testData values in ways -verify does not follow, a
+// run with any of them can not be checked
+var untrackedWrites = []opType{opDelete, opRetain, opRMW, opIncrement, opReturning, opFlip, opSavepoint, opCross, opFileWrite}
+
+// maxMismatches is how many diverging rows or versions a failed check lists
+const maxMismatches = 10
+
+// rowValue is a value written to row id
+type rowValue struct {
+	id    int
+	value int
+}
+
+// stateTracker remembers what every committed update and upsert wrote so the
+// database can be checked against it after the run.
+//
+// Writers run concurrently, so the order writes return in is not the order
+// they committed in. Each write is kept with the time it started and the time
+// it returned, and a write is only known to be overwritten once another write
+// to the same row started after it returned. Whatever is left can be the last
+// committed value.
+type stateTracker struct {
+	mu   sync.Mutex
+	rows map[int]*rowWrites
+}
+
+// rowWrites are the writes to a row that may still be its last one
+type rowWrites struct {
+	latestStart time.Time
+	writes      []trackedWrite
+}
+
+type trackedWrite struct {
+	start, end time.Time
+	value      int
+}
+
+func newStateTracker() *stateTracker {
+	return &stateTracker{rows: make(map[int]*rowWrites)}
+}
+
+// record adds the writes of one op that started at start and committed
+// before end. A row written more than once keeps the last value.
+func (t *stateTracker) record(start, end time.Time, written []rowValue) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, w := range written {
+		superseded := false
+		for _, later := range written[i+1:] {
+			superseded = superseded || later.id == w.id
+		}
+		if superseded {
+			continue
+		}
+
+		row := t.rows[w.id]
+		if row == nil {
+			row = &rowWrites{}
+			t.rows[w.id] = row
+		}
+		if start.After(row.latestStart) {
+			row.latestStart = start
+		}
+
+		// drop the writes that returned before the latest one started, this
+		// one too when a write that started after it was already recorded
+		kept := row.writes[:0]
+		for _, tw := range append(row.writes, trackedWrite{start: start, end: end, value: w.value}) {
+			if !tw.end.Before(row.latestStart) {
+				kept = append(kept, tw)
+			}
+		}
+		row.writes = kept
+	}
+}
+
+// verify compares every tracked row in the database with the values that can
+// have been committed to it last
+func (t *stateTracker) verify(ctx context.Context, w worker) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	found := make(map[int]int64, len(t.rows))
+	err := w.query(ctx, statement{query: "SELECT id, value FROM testData"}, func(row []interface{}) error {
+		id, ok := row[0].(int64)
+		if !ok {
+			return fmt.Errorf("verify: expected an integer id, got %T", row[0])
+		}
+		value, ok := row[1].(int64)
+		if !ok {
+			return fmt.Errorf("verify: expected an integer value for row %d, got %T", id, row[1])
+		}
+		if _, tracked := t.rows[int(id)]; tracked {
+			found[int(id)] = value
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var mismatches []string
+	for id, row := range t.rows {
+		value, ok := found[id]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("row %d is missing, expected %s", id, row.expected()))
+			continue
+		}
+		if !row.matches(value) {
+			mismatches = append(mismatches, fmt.Sprintf("row %d has %d, expected %s", id, value, row.expected()))
+		}
+	}
+	if len(mismatches) == 0 {
+		return nil
+	}
+
+	sort.Strings(mismatches)
+	total := len(mismatches)
+	if total > maxMismatches {
+		mismatches = mismatches[:maxMismatches]
+	}
+	return fmt.Errorf("consistency check failed, %d of %d rows diverged:\n  %s", total, len(t.rows), strings.Join(mismatches, "\n  "))
+}
+
+// len returns how many rows were tracked
+func (t *stateTracker) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.rows)
+}
+
+func (r *rowWrites) matches(value int64) bool {
+	for _, w := range r.writes {
+		if int64(w.value) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// expected lists the values the row can have
+func (r *rowWrites) expected() string {
+	values := make([]string, len(r.writes))
+	for i, w := range r.writes {
+		values[i] = fmt.Sprint(w.value)
+	}
+	if len(values) == 1 {
+		return values[0]
+	}
+	return "one of " + strings.Join(values, ", ")
+}
+
+// rowVersion is a version written to row id
+type rowVersion struct {
+	id      int
+	version int64
+}
+
+// versionTracker collects the versions -versions updates committed to every
+// row. Each update reads a row's version and writes back one higher, so the
+// versions of a row have to come out as 1, 2, 3 and so on. A version written
+// twice is a lost update, two writers read the same version and one of them
+// overwrote the other. A version the tracker never saw is an update that
+// committed but was reported as failed, and usually ran again on retry.
+type versionTracker struct {
+	mu   sync.Mutex
+	rows map[int][]int64
+}
+
+func newVersionTracker() *versionTracker {
+	return &versionTracker{rows: make(map[int][]int64)}
+}
+
+// record adds the versions of a committed transaction
+func (t *versionTracker) record(bumped []rowVersion) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, b := range bumped {
+		t.rows[b.id] = append(t.rows[b.id], b.version)
+	}
+}
+
+// verify checks the versions of every updated row, in the tracker and in the
+// database, and returns how many updates were checked
+func (t *versionTracker) verify(ctx context.Context, w worker) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	final := make(map[int]int64, len(t.rows))
+	err := w.query(ctx, statement{query: "SELECT id, version FROM testData"}, func(row []interface{}) error {
+		id, ok := row[0].(int64)
+		if !ok {
+			return fmt.Errorf("verify: expected an integer id, got %T", row[0])
+		}
+		version, ok := row[1].(int64)
+		if !ok {
+			return fmt.Errorf("verify: expected an integer version for row %d, got %T", id, row[1])
+		}
+		final[int(id)] = version
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var problems []string
+	updates := 0
+	for id, versions := range t.rows {
+		updates += len(versions)
+		sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+		want := int64(1)
+		for i, v := range versions {
+			if i > 0 && v == versions[i-1] {
+				problems = append(problems, fmt.Sprintf("row %d: version %d written twice, an update was lost", id, v))
+				continue
+			}
+			if v > want {
+				problems = append(problems, fmt.Sprintf("row %d: versions %d to %d committed without being counted", id, want, v-1))
+			}
+			want = v + 1
+		}
+
+		last := versions[len(versions)-1]
+		if got := final[id]; got > last {
+			problems = append(problems, fmt.Sprintf("row %d: at version %d but the last counted update wrote %d", id, got, last))
+		} else if got < last {
+			problems = append(problems, fmt.Sprintf("row %d: at version %d but an update committed version %d", id, got, last))
+		}
+	}
+	if len(problems) == 0 {
+		return updates, nil
+	}
+
+	sort.Strings(problems)
+	total := len(problems)
+	if total > maxMismatches {
+		problems = problems[:maxMismatches]
+	}
+	return 0, fmt.Errorf("version check failed, %d problems in %d updates:\n  %s", total, updates, strings.Join(problems, "\n  "))
+}
+
+// readChecker turns readers into consistency probes with -check-reads. Every
+// read's rows are checked for NULLs, and while no op adds or removes rows,
+// for ids that run on without gaps and for the number of rows expected.
+type readChecker struct {
+	numRows int
+
+	// fixedRows is set when testData keeps the same rows for the whole run
+	fixedRows bool
+
+	mu         sync.Mutex
+	reads      int64
+	violations int64
+	examples   []string
+}
+
+// probe checks the rows of a single read, nothing is counted until done
+type probe struct {
+	checker *readChecker
+
+	// first and last are the ids expected in order, last is -1 when ids
+	// are not checked
+	first, last int64
+
+	next     int64
+	problems []string
+}
+
+// probe returns the probe for a read of testData by s starting at id, or all
+// the pages of a paginated read
+func (c *readChecker) probe(s schema, id int) *probe {
+	p := &probe{checker: c, last: -1}
+	if !c.fixedRows || s.relational {
+		return p
+	}
+	switch s.readPattern {
+	case readPoint:
+		p.first, p.last = int64(id), int64(id)
+	case readRange:
+		p.first, p.last = int64(id), int64(id+s.rangeSize-1)
+		if p.last > int64(c.numRows) {
+			p.last = int64(c.numRows)
+		}
+	case readScan, readOffset, readKeyset:
+		p.first, p.last = 0, int64(c.numRows)
+	}
+	p.next = p.first
+	return p
+}
+
+func (p *probe) row(row []interface{}) error {
+	for i, v := range row {
+		if v == nil {
+			p.problems = append(p.problems, fmt.Sprintf("NULL in column %d", i+1))
+		}
+	}
+	if p.last < 0 {
+		return nil
+	}
+
+	id, ok := row[0].(int64)
+	if !ok {
+		return fmt.Errorf("read check: expected an integer id, got %T", row[0])
+	}
+	if id != p.next {
+		p.problems = append(p.problems, fmt.Sprintf("id %d where %d was expected", id, p.next))
+	}
+	p.next = id + 1
+	return nil
+}
+
+// done counts the read once its query succeeded
+func (p *probe) done() {
+	if p.last >= 0 && p.next <= p.last {
+		p.problems = append(p.problems, fmt.Sprintf("ended before id %d, %d rows expected", p.next, p.last-p.first+1))
+	}
+
+	c := p.checker
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reads++
+	c.violations += int64(len(p.problems))
+	for _, problem := range p.problems {
+		if len(c.examples) < maxMismatches {
+			c.examples = append(c.examples, problem)
+		}
+	}
+}
+
+// reset forgets the reads so far, like the ones made during the warm up
+func (c *readChecker) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reads, c.violations, c.examples = 0, 0, nil
+}
+
+// readCheckResult is what the read checks found during a run
+type readCheckResult struct {
+	reads, violations int64
+	examples          []string
+}
+
+func (c *readChecker) result() readCheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return readCheckResult{reads: c.reads, violations: c.violations, examples: c.examples}
+}
+
+func (r readCheckResult) print() {
+	fmt.Println("Read checks: ", r.reads, "reads,", r.violations, "violations")
+	for _, example := range r.examples {
+		fmt.Println("  " + example)
+	}
+}
+
+// checkIntegrity runs PRAGMA integrity_check on db, and foreign_key_check
+// when any table has a foreign key, and prints what they found. It returns an
+// error when either one found a problem.
+func checkIntegrity(db *sql.DB) error {
+	start := time.Now()
+	problems, err := pragmaRows(db, "PRAGMA integrity_check")
+	if err != nil {
+		return fmt.Errorf("integrity check failed to run, %v", err)
+	}
+	if len(problems) == 1 && problems[0] == "ok" {
+		problems = nil
+	}
+	printCheck("Integrity check", problems, ", took "+time.Since(start).String())
+
+	var foreignKeys int
+	err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master m, pragma_foreign_key_list(m.name) WHERE m.type = 'table'").Scan(&foreignKeys)
+	if err != nil {
+		return fmt.Errorf("failed to look for foreign keys, %v", err)
+	}
+	var violations []string
+	if foreignKeys > 0 {
+		if violations, err = pragmaRows(db, "PRAGMA foreign_key_check"); err != nil {
+			return fmt.Errorf("foreign key check failed to run, %v", err)
+		}
+		printCheck("Foreign key check", violations, "")
+	}
+
+	if len(problems) > 0 || len(violations) > 0 {
+		return fmt.Errorf("database failed its integrity checks")
+	}
+	return nil
+}
+
+// headerJournalMode returns WAL when the header of the database at path says
+// it is in WAL mode. Without it go-sqlite3 tries to take the database back to
+// DELETE as it opens, which a read only connection can not do.
+func headerJournalMode(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// bytes 18 and 19 are the file format write and read versions, 2 in WAL mode
+	header := make([]byte, 20)
+	if _, err := io.ReadFull(f, header); err != nil {
+		// too short to have a header, sqlite will report it as not a database
+		return "", nil
+	}
+	if header[18] == 2 {
+		return dsn.JournalWAL, nil
+	}
+	return "", nil
+}
+
+// verifyDatabase opens the database at path read only and runs
+// checkIntegrity on it, then prints its stateDigest when digest is set
+func verifyDatabase(path string, digest bool) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	journalMode, err := headerJournalMode(path)
+	if err != nil {
+		return err
+	}
+	dataSource, err := dsn.BuildDSN(dsn.Config{Filename: path, Mode: dsn.ModeReadOnly, JournalMode: journalMode})
+	if err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite3", dataSource)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := checkIntegrity(db); err != nil {
+		return err
+	}
+	if digest {
+		sum, rows, err := stateDigest(db)
+		if err != nil {
+			return fmt.Errorf("failed to digest testData, %v", err)
+		}
+		fmt.Printf("State digest: %s (%d rows)\n", sum, rows)
+	}
+	return nil
+}
+
+// stateDigest returns a SHA-256 of every testData row in id order and how
+// many rows there were. Two runs of the same -replay that end with the same
+// digest left the same rows behind.
+func stateDigest(db *sql.DB) (string, int, error) {
+	rows, err := pragmaRows(db, "SELECT * FROM testData ORDER BY id")
+	if err != nil {
+		return "", 0, err
+	}
+	h := sha256.New()
+	for _, row := range rows {
+		fmt.Fprintln(h, row)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), len(rows), nil
+}
+
+// checkEquivalence compares the state digests left behind by the runs of the
+// same -replay, printing each next to the first. Every locker and journal
+// mode should end with the same rows, one that differs lost or reordered
+// writes. It returns false when any differs, true without digests.
+func checkEquivalence(results []benchmarkResult) bool {
+	if len(results) == 0 || len(results[0].runs) == 0 || results[0].runs[0].digest == "" {
+		return true
+	}
+	want, wantName := results[0].runs[0].digest, results[0].name
+
+	fmt.Println()
+	fmt.Println()
+	fmt.Println("Final state equivalence")
+	fmt.Println("---------------------------")
+	same := true
+	for _, r := range results {
+		for i, run := range r.runs {
+			name := r.name
+			if len(r.runs) > 1 {
+				name = fmt.Sprintf("%s #%d", r.name, i+1)
+			}
+			verdict := "same"
+			if run.digest != want {
+				verdict = "DIFFERS from " + wantName
+				same = false
+			}
+			fmt.Printf("%-24s:  %.16s (%d rows), %s\n", name, run.digest, run.digestRows, verdict)
+		}
+	}
+	if !same {
+		fmt.Println("Final states differ, a run lost or reordered the writes of the replay")
+	}
+	return same
+}
+
+// pragmaRows returns every row of a checking PRAGMA or query, its columns
+// joined with spaces
+func pragmaRows(db *sql.DB, pragma string) ([]string, error) {
+	rows, err := db.Query(pragma)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		fields := make([]string, len(values))
+		for i, v := range values {
+			fields[i] = v.String
+		}
+		lines = append(lines, strings.Join(fields, " "))
+	}
+	return lines, rows.Err()
+}
+
+// printCheck prints ok when a check found nothing, or the number of problems
+// and the first few of them
+func printCheck(name string, problems []string, suffix string) {
+	if len(problems) == 0 {
+		fmt.Println(name + ": ok" + suffix)
+		return
+	}
+	fmt.Printf("%s: %d problems%s\n", name, len(problems), suffix)
+	if len(problems) > maxMismatches {
+		problems = problems[:maxMismatches]
+	}
+	for _, problem := range problems {
+		fmt.Println("  " + problem)
+	}
+}
+
+// quickChecker runs PRAGMA quick_check on its own connection every interval
+// of a run for -quick-check, timing each one
+type quickChecker struct {
+	interval time.Duration
+	latency  latencies
+
+	mu       sync.Mutex
+	checks   int
+	problems []string
+}
+
+// quickCheckResult is what the quick checks of one run took and found
+type quickCheckResult struct {
+	checks   int
+	latency  latencyStats
+	problems []string
+}
+
+// check runs one quick_check on w, problems are printed as soon as they are
+// found rather than at the end of a long run
+func (q *quickChecker) check(ctx context.Context, w worker) error {
+	start := time.Now()
+	var problems []string
+	err := w.query(ctx, statement{query: "PRAGMA quick_check"}, func(row []interface{}) error {
+		problems = append(problems, fmt.Sprintf("%s", row[0]))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	q.latency.add(time.Since(start))
+	if len(problems) == 1 && problems[0] == "ok" {
+		problems = nil
+	}
+
+	q.mu.Lock()
+	q.checks++
+	q.problems = append(q.problems, problems...)
+	q.mu.Unlock()
+
+	if len(problems) > 0 {
+		fmt.Println()
+		printCheck("Quick check", problems, "")
+	}
+	return nil
+}
+
+func (q *quickChecker) result() quickCheckResult {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return quickCheckResult{
+		checks:   q.checks,
+		latency:  q.latency.stats(),
+		problems: q.problems,
+	}
+}
+
+func (r quickCheckResult) print() {
+	fmt.Printf("Quick checks: %d, %s, %d problems\n", r.checks, r.latency, len(r.problems))
+}
+
+// snapshotPause is how long a snapshot op waits between its two passes,
+// long enough for writers to commit in between
+const snapshotPause = time.Millisecond
+
+// snapshotChecker runs the snapshot ops, read transactions that run the same
+// statements twice and count every answer that changed in between
+type snapshotChecker struct {
+	mu         sync.Mutex
+	checks     int64
+	violations int64
+	examples   []string
+}
+
+// snapshotCheckResult is what the snapshot ops of one run found
+type snapshotCheckResult struct {
+	checks, violations int64
+	examples           []string
+}
+
+// check runs one snapshot op on w, reading the row count, the sum of all
+// values and row id twice inside one transaction
+func (c *snapshotChecker) check(ctx context.Context, w worker, s schema, id int) error {
+	stmts := []statement{s.count(), s.sumValues(), s.readValue(id)}
+	first := make([]int64, len(stmts))
+	found := make([]bool, len(stmts))
+	var problems []string
+	err := w.tx(ctx, func(tx txConn) error {
+		problems = problems[:0]
+		for i, stmt := range stmts {
+			var err error
+			if first[i], found[i], err = tx.queryInt(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		time.Sleep(snapshotPause)
+		for i, stmt := range stmts {
+			val, ok, err := tx.queryInt(ctx, stmt)
+			if err != nil {
+				return err
+			}
+			name := stmt.query
+			if len(stmt.args) > 0 {
+				name += fmt.Sprint(" ", stmt.args)
+			}
+			switch {
+			case ok != found[i]:
+				problems = append(problems, fmt.Sprintf("%s: found %v, then %v", name, found[i], ok))
+			case val != first[i]:
+				problems = append(problems, fmt.Sprintf("%s: %d, then %d", name, first[i], val))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks++
+	c.violations += int64(len(problems))
+	for _, problem := range problems {
+		if len(c.examples) < maxMismatches {
+			c.examples = append(c.examples, problem)
+		}
+	}
+	return nil
+}
+
+// reset forgets the checks so far, like the ones made during the warm up
+func (c *snapshotChecker) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks, c.violations, c.examples = 0, 0, nil
+}
+
+func (c *snapshotChecker) result() snapshotCheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return snapshotCheckResult{checks: c.checks, violations: c.violations, examples: c.examples}
+}
+
+func (r snapshotCheckResult) print() {
+	fmt.Println("Snapshot checks: ", r.checks, "transactions,", r.violations, "violations")
+	for _, example := range r.examples {
+		fmt.Println("  " + example)
+	}
+}
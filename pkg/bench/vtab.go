@@ -0,0 +1,47 @@
+package bench
+
+import "sync"
+
+// vtabModuleName is the module behind the vData virtual table of -workload
+// vtab. It is only available when built with -tags vtable, go-sqlite3 leaves
+// out its virtual table support otherwise.
+const vtabModuleName = "go_values"
+
+// vtabStore holds the rows of vData in Go. Every connection's vData reads
+// and writes the same store, so it is guarded by its own lock, and changes
+// are not part of any sqlite transaction.
+type vtabStore struct {
+	mu     sync.RWMutex
+	values []int64
+}
+
+// newVTabStore returns a store of rows 0 to numRows, all with value 0 like
+// the rows of testData after schema.fill
+func newVTabStore(numRows int) *vtabStore {
+	return &vtabStore{values: make([]int64, numRows+1)}
+}
+
+func (s *vtabStore) len() int64 {
+	return int64(len(s.values))
+}
+
+// get returns the value of row id, false when there is no such row
+func (s *vtabStore) get(id int64) (int64, bool) {
+	if id < 0 || id >= s.len() {
+		return 0, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.values[id], true
+}
+
+// set changes the value of row id, false when there is no such row
+func (s *vtabStore) set(id, value int64) bool {
+	if id < 0 || id >= s.len() {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[id] = value
+	return true
+}
@@ -0,0 +1,142 @@
+//go:build vtable
+// +build vtable
+
+package bench
+
+import (
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// vtabSupported is true when go-sqlite3 was built with its virtual table
+// support
+const vtabSupported = true
+
+// registerVTab makes the go_values module backed by store available on conn
+func registerVTab(conn *sqlite3.SQLiteConn, store *vtabStore) error {
+	return conn.CreateModule(vtabModuleName, vtabModule{store})
+}
+
+// vtabModule creates vData tables over its store, CREATE and every later
+// connect to the table get the same rows
+type vtabModule struct {
+	store *vtabStore
+}
+
+func (m vtabModule) Create(c *sqlite3.SQLiteConn, args []string) (sqlite3.VTab, error) {
+	if err := c.DeclareVTab("CREATE TABLE x(id integer, value integer)"); err != nil {
+		return nil, err
+	}
+	return vtabTable{m.store}, nil
+}
+
+func (m vtabModule) Connect(c *sqlite3.SQLiteConn, args []string) (sqlite3.VTab, error) {
+	return m.Create(c, args)
+}
+
+func (m vtabModule) DestroyModule() {}
+
+// vtabTable is one connection's vData, rowids are the ids
+type vtabTable struct {
+	store *vtabStore
+}
+
+// index numbers handed from BestIndex to Filter
+const (
+	vtabScan = iota
+	vtabPoint
+)
+
+// BestIndex uses id = ? to visit a single row, anything else scans the store
+func (t vtabTable) BestIndex(cst []sqlite3.InfoConstraint, ob []sqlite3.InfoOrderBy) (*sqlite3.IndexResult, error) {
+	used := make([]bool, len(cst))
+	for i, c := range cst {
+		if c.Usable && c.Column == 0 && c.Op == sqlite3.OpEQ {
+			used[i] = true
+			return &sqlite3.IndexResult{Used: used, IdxNum: vtabPoint, EstimatedCost: 1, EstimatedRows: 1}, nil
+		}
+	}
+	rows := float64(t.store.len())
+	return &sqlite3.IndexResult{Used: used, IdxNum: vtabScan, EstimatedCost: rows, EstimatedRows: rows}, nil
+}
+
+func (t vtabTable) Open() (sqlite3.VTabCursor, error) {
+	return &vtabCursor{store: t.store}, nil
+}
+
+func (t vtabTable) Disconnect() error { return nil }
+func (t vtabTable) Destroy() error    { return nil }
+
+// Update only changes values, rows can not be added, removed or renumbered
+func (t vtabTable) Update(rowid interface{}, cols []interface{}) error {
+	id, ok := rowid.(int64)
+	if !ok {
+		return fmt.Errorf("%s: expected an integer rowid, got %T", vtabModuleName, rowid)
+	}
+	value, ok := cols[1].(int64)
+	if !ok {
+		return fmt.Errorf("%s: expected an integer value, got %T", vtabModuleName, cols[1])
+	}
+	if !t.store.set(id, value) {
+		return fmt.Errorf("%s: no row %d", vtabModuleName, id)
+	}
+	return nil
+}
+
+func (t vtabTable) Insert(rowid interface{}, cols []interface{}) (int64, error) {
+	return 0, fmt.Errorf("%s: rows can not be inserted", vtabModuleName)
+}
+
+func (t vtabTable) Delete(rowid interface{}) error {
+	return fmt.Errorf("%s: rows can not be deleted", vtabModuleName)
+}
+
+// vtabCursor walks the ids from id to end
+type vtabCursor struct {
+	store   *vtabStore
+	id, end int64
+}
+
+func (c *vtabCursor) Filter(idxNum int, idxStr string, vals []interface{}) error {
+	c.id, c.end = 0, c.store.len()
+	if idxNum != vtabPoint {
+		return nil
+	}
+
+	id, ok := vals[0].(int64)
+	if !ok || id < 0 || id >= c.end {
+		// no such row, the cursor starts at the end
+		c.id = c.end
+		return nil
+	}
+	c.id, c.end = id, id+1
+	return nil
+}
+
+func (c *vtabCursor) Next() error {
+	c.id++
+	return nil
+}
+
+func (c *vtabCursor) EOF() bool {
+	return c.id >= c.end
+}
+
+func (c *vtabCursor) Column(ctx *sqlite3.SQLiteContext, col int) error {
+	if col == 0 {
+		ctx.ResultInt64(c.id)
+		return nil
+	}
+	value, _ := c.store.get(c.id)
+	ctx.ResultInt64(value)
+	return nil
+}
+
+func (c *vtabCursor) Rowid() (int64, error) {
+	return c.id, nil
+}
+
+func (c *vtabCursor) Close() error {
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build !vtable
+// +build !vtable
+
+package bench
+
+import (
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// vtabSupported is false, go-sqlite3 only has virtual table support when
+// built with -tags vtable
+const vtabSupported = false
+
+func registerVTab(conn *sqlite3.SQLiteConn, store *vtabStore) error {
+	return fmt.Errorf("%s needs a build with -tags vtable", vtabModuleName)
+}
@@ -0,0 +1,189 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// watchdog reports every op that has been in flight for longer than after,
+// with the statement it is running and its goroutine's stack, so a hung run
+// shows where it hangs. With cancel set the op's context is cancelled too.
+type watchdog struct {
+	after  time.Duration
+	cancel bool
+
+	mu  sync.Mutex
+	ops map[*inflightOp]bool
+
+	stuck, cancelled int64
+}
+
+// inflightOp is one op the watchdog is watching
+type inflightOp struct {
+	name      string
+	start     time.Time
+	goroutine string
+	cancel    context.CancelFunc
+	reported  bool
+
+	mu      sync.Mutex
+	current string
+}
+
+func newWatchdog(after time.Duration, cancel bool) *watchdog {
+	return &watchdog{after: after, cancel: cancel, ops: make(map[*inflightOp]bool)}
+}
+
+// start watches a new op called name, run by the calling goroutine. The op
+// has to run with the returned context and call done when it returns.
+func (d *watchdog) start(ctx context.Context, name string) (context.Context, *inflightOp) {
+	ctx, cancel := context.WithCancel(ctx)
+	op := &inflightOp{name: name, start: time.Now(), goroutine: goroutineID(), cancel: cancel, current: "waiting for the lock"}
+
+	d.mu.Lock()
+	d.ops[op] = true
+	d.mu.Unlock()
+	return ctx, op
+}
+
+func (d *watchdog) done(op *inflightOp) {
+	op.cancel()
+	d.mu.Lock()
+	delete(d.ops, op)
+	d.mu.Unlock()
+}
+
+// run checks the ops in flight until stop is closed
+func (d *watchdog) run(stop <-chan bool) {
+	ticker := time.NewTicker(d.after / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		d.mu.Lock()
+		var stuck []*inflightOp
+		for op := range d.ops {
+			if !op.reported && time.Since(op.start) > d.after {
+				op.reported = true
+				stuck = append(stuck, op)
+			}
+		}
+		d.mu.Unlock()
+
+		for _, op := range stuck {
+			d.report(op)
+		}
+	}
+}
+
+func (d *watchdog) report(op *inflightOp) {
+	atomic.AddInt64(&d.stuck, 1)
+	op.mu.Lock()
+	current := op.current
+	op.mu.Unlock()
+
+	fmt.Printf("\nStuck op: %s in flight for %s, %s\n", op.name, time.Since(op.start).Round(time.Millisecond), current)
+	fmt.Println(goroutineStack(op.goroutine))
+	if d.cancel {
+		fmt.Println("Cancelling", op.name)
+		atomic.AddInt64(&d.cancelled, 1)
+		op.cancel()
+	}
+}
+
+// running notes stmts as the statements op is running
+func (op *inflightOp) running(stmts ...statement) {
+	current := "running"
+	for i, s := range stmts {
+		if i > 0 {
+			current += ";"
+		}
+		current += " " + s.query
+		if len(s.args) > 0 {
+			current += fmt.Sprint(" ", s.args)
+		}
+	}
+	op.mu.Lock()
+	op.current = current
+	op.mu.Unlock()
+}
+
+// goroutineID returns the id of the calling goroutine, taken from the first
+// line of its stack: goroutine 18 [running]:
+func goroutineID() string {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	fields := bytes.Fields(buf)
+	if len(fields) < 2 {
+		return ""
+	}
+	return string(fields[1])
+}
+
+// goroutineStack returns the stack of goroutine id
+func goroutineStack(id string) string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	prefix := []byte("goroutine " + id + " ")
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.HasPrefix(stack, prefix) {
+			return string(stack)
+		}
+	}
+	return "goroutine " + id + " has no stack"
+}
+
+// watchedWorker tells op about every statement run through worker
+type watchedWorker struct {
+	worker
+	op *inflightOp
+}
+
+func (w watchedWorker) query(ctx context.Context, s statement, fn rowFunc) error {
+	w.op.running(s)
+	return w.worker.query(ctx, s, fn)
+}
+
+func (w watchedWorker) exec(ctx context.Context, stmts ...statement) (int64, error) {
+	w.op.running(stmts...)
+	return w.worker.exec(ctx, stmts...)
+}
+
+func (w watchedWorker) tx(ctx context.Context, fn func(txConn) error) error {
+	return w.worker.tx(ctx, func(tx txConn) error {
+		return fn(watchedTx{tx, w.op})
+	})
+}
+
+// watchedTx tells op about the statements run inside a watchedWorker's tx
+type watchedTx struct {
+	txConn
+	op *inflightOp
+}
+
+func (t watchedTx) queryInt(ctx context.Context, s statement) (int64, bool, error) {
+	t.op.running(s)
+	return t.txConn.queryInt(ctx, s)
+}
+
+func (t watchedTx) exec(ctx context.Context, s statement) (int64, error) {
+	t.op.running(s)
+	return t.txConn.exec(ctx, s)
+}
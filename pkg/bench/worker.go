@@ -0,0 +1,531 @@
+package bench
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/mostlygeek/go-sqlite3-locking/pkg/workloads"
+)
+
+// statement is a single SQL statement and its arguments
+type statement struct {
+	query string
+	args  []interface{}
+}
+
+// worker is a single reader or writer goroutine's handle on the database
+type worker interface {
+	// query runs a SELECT and passes each row to fn, a nil fn just drains
+	// the rows
+	query(ctx context.Context, s statement, fn rowFunc) error
+
+	// exec runs stmts, more than one are wrapped in a transaction. It returns
+	// the total number of rows affected.
+	exec(ctx context.Context, stmts ...statement) (int64, error)
+
+	// tx runs fn inside a transaction, it is committed if fn returns nil
+	tx(ctx context.Context, fn func(txConn) error) error
+
+	close()
+}
+
+// txConn runs statements inside a worker's transaction
+type txConn interface {
+	// queryInt returns the first column of the first row of s, found is
+	// false when there are no rows
+	queryInt(ctx context.Context, s statement) (val int64, found bool, err error)
+
+	// exec runs s and returns the number of rows affected
+	exec(ctx context.Context, s statement) (int64, error)
+}
+
+// rowFunc is called with the column values of each row a query returns
+type rowFunc func(row []interface{}) error
+
+// workerFactory opens the worker for one reader (reader = true) or writer
+type workerFactory func(ctx context.Context, reader bool) (worker, error)
+
+// querier is the part of *sql.DB and *sql.Conn used by readers and writers
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// sqlWorker goes through database/sql, either through the pool or a pinned
+// *sql.Conn
+type sqlWorker struct {
+	conn    querier
+	release func()
+
+	// stmts caches a prepared statement for every query when prepare is set,
+	// database/sql prepares it again on each pool connection it runs on
+	prepare bool
+	stmts   map[string]*sql.Stmt
+
+	// pending are queries first seen inside a transaction, they are prepared
+	// once it ends since the transaction may hold the only pool connection
+	pending []string
+}
+
+// sqlWorkers returns a factory for workers using db, readers use readDB. When
+// pin is set each worker checks out its own *sql.Conn for the whole run, when
+// prepare is set workers prepare each statement once and reuse it.
+func sqlWorkers(db, readDB *sql.DB, pin, prepare bool) workerFactory {
+	return func(ctx context.Context, reader bool) (worker, error) {
+		handle := db
+		if reader {
+			handle = readDB
+		}
+
+		w := &sqlWorker{conn: handle, release: func() {}, prepare: prepare, stmts: make(map[string]*sql.Stmt)}
+		if !pin {
+			return w, nil
+		}
+
+		conn, err := handle.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		w.conn, w.release = conn, func() { conn.Close() }
+		return w, nil
+	}
+}
+
+// prepared returns the prepared statement for query
+func (w *sqlWorker) prepared(ctx context.Context, query string) (*sql.Stmt, error) {
+	if stmt, ok := w.stmts[query]; ok {
+		return stmt, nil
+	}
+
+	stmt, err := w.conn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("prepare %s: %w", query, err)
+	}
+	w.stmts[query] = stmt
+	return stmt, nil
+}
+
+func (w *sqlWorker) query(ctx context.Context, s statement, fn rowFunc) error {
+	var rows *sql.Rows
+	var err error
+	if w.prepare {
+		var stmt *sql.Stmt
+		if stmt, err = w.prepared(ctx, s.query); err != nil {
+			return err
+		}
+		rows, err = stmt.QueryContext(ctx, s.args...)
+	} else {
+		rows, err = w.conn.QueryContext(ctx, s.query, s.args...)
+	}
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if fn == nil {
+		for rows.Next() {
+			// purge it
+		}
+		return rows.Err()
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	row := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range row {
+		dest[i] = &row[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (w *sqlWorker) exec(ctx context.Context, stmts ...statement) (int64, error) {
+	if len(stmts) == 1 {
+		var res sql.Result
+		var err error
+		if w.prepare {
+			var stmt *sql.Stmt
+			if stmt, err = w.prepared(ctx, stmts[0].query); err != nil {
+				return 0, err
+			}
+			res, err = stmt.ExecContext(ctx, stmts[0].args...)
+		} else {
+			res, err = w.conn.ExecContext(ctx, stmts[0].query, stmts[0].args...)
+		}
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
+	}
+
+	var affected int64
+	err := w.tx(ctx, func(tx txConn) error {
+		for _, s := range stmts {
+			n, err := tx.exec(ctx, s)
+			if err != nil {
+				return err
+			}
+			affected += n
+		}
+		return nil
+	})
+	return affected, err
+}
+
+func (w *sqlWorker) tx(ctx context.Context, fn func(txConn) error) error {
+	tx, err := w.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(sqlTx{tx: tx, w: w}); err != nil {
+		tx.Rollback()
+		w.preparePending(ctx)
+		return err
+	}
+	err = tx.Commit()
+	w.preparePending(ctx)
+	return err
+}
+
+// preparePending prepares the queries first run inside a transaction, a
+// failure leaves them unprepared to be tried again next time
+func (w *sqlWorker) preparePending(ctx context.Context) {
+	for _, query := range w.pending {
+		w.prepared(ctx, query)
+	}
+	w.pending = w.pending[:0]
+}
+
+// sqlTx is the txConn for sqlWorker
+type sqlTx struct {
+	tx *sql.Tx
+	w  *sqlWorker
+}
+
+// stmt returns the worker's prepared statement for query bound to the
+// transaction, nil when the worker does not prepare statements or has not
+// prepared query yet
+func (t sqlTx) stmt(ctx context.Context, query string) *sql.Stmt {
+	if !t.w.prepare {
+		return nil
+	}
+	stmt, ok := t.w.stmts[query]
+	if !ok {
+		t.w.pending = append(t.w.pending, query)
+		return nil
+	}
+	return t.tx.StmtContext(ctx, stmt)
+}
+
+func (t sqlTx) queryInt(ctx context.Context, s statement) (int64, bool, error) {
+	var val int64
+	var err error
+	if stmt := t.stmt(ctx, s.query); stmt != nil {
+		err = stmt.QueryRowContext(ctx, s.args...).Scan(&val)
+	} else {
+		err = t.tx.QueryRowContext(ctx, s.query, s.args...).Scan(&val)
+	}
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return val, err == nil, err
+}
+
+func (t sqlTx) exec(ctx context.Context, s statement) (int64, error) {
+	var res sql.Result
+	var err error
+	if stmt := t.stmt(ctx, s.query); stmt != nil {
+		res, err = stmt.ExecContext(ctx, s.args...)
+	} else {
+		res, err = t.tx.ExecContext(ctx, s.query, s.args...)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (w *sqlWorker) close() {
+	for _, stmt := range w.stmts {
+		stmt.Close()
+	}
+	w.release()
+}
+
+// rawWorker skips database/sql entirely and holds its own sqlite3 driver
+// connection. Every statement is prepared the first time it is used and
+// reused for as long as it stays in the cache.
+type rawWorker struct {
+	conn  *sqlite3.SQLiteConn
+	stmts *stmtCache
+}
+
+// rawWorkers returns a factory that opens a new driver connection for every
+// worker, readers use readSource. Each worker caches up to cacheSize
+// prepared statements, 0 caches every one, and counts lookups in stats.
+func rawWorkers(d *sqlite3.SQLiteDriver, dataSource, readSource string, cacheSize int, stats *stmtCacheStats) workerFactory {
+	return func(ctx context.Context, reader bool) (worker, error) {
+		source := dataSource
+		if reader {
+			source = readSource
+		}
+
+		conn, err := d.Open(source)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rawWorker{
+			conn:  conn.(*sqlite3.SQLiteConn),
+			stmts: newStmtCache(cacheSize, stats),
+		}, nil
+	}
+}
+
+// prepared returns the prepared statement for query
+func (w *rawWorker) prepared(query string) (driver.Stmt, error) {
+	return w.stmts.get(w.conn, query)
+}
+
+func (w *rawWorker) query(ctx context.Context, s statement, fn rowFunc) error {
+	stmt, err := w.prepared(s.query)
+	if err != nil {
+		return err
+	}
+
+	rows, err := stmt.(driver.StmtQueryContext).QueryContext(ctx, args(s.args...))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	dest := make([]driver.Value, len(rows.Columns()))
+	row := make([]interface{}, len(dest))
+	for {
+		if err := rows.Next(dest); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if fn == nil {
+			continue
+		}
+		for i, v := range dest {
+			row[i] = v
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *rawWorker) exec(ctx context.Context, stmts ...statement) (int64, error) {
+	if len(stmts) == 1 {
+		return w.execOne(ctx, stmts[0])
+	}
+
+	var affected int64
+	err := w.tx(ctx, func(tx txConn) error {
+		for _, s := range stmts {
+			n, err := tx.exec(ctx, s)
+			if err != nil {
+				return err
+			}
+			affected += n
+		}
+		return nil
+	})
+	return affected, err
+}
+
+func (w *rawWorker) execOne(ctx context.Context, s statement) (int64, error) {
+	stmt, err := w.prepared(s.query)
+	if err != nil {
+		return 0, err
+	}
+	res, err := stmt.(driver.StmtExecContext).ExecContext(ctx, args(s.args...))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (w *rawWorker) tx(ctx context.Context, fn func(txConn) error) error {
+	tx, err := w.conn.BeginTx(ctx, driver.TxOptions{})
+	if err != nil {
+		return err
+	}
+	if err := fn(rawTx{w}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// rawTx is the txConn for rawWorker, the driver connection is already inside
+// the transaction so statements run on it directly
+type rawTx struct {
+	w *rawWorker
+}
+
+func (t rawTx) queryInt(ctx context.Context, s statement) (int64, bool, error) {
+	stmt, err := t.w.prepared(s.query)
+	if err != nil {
+		return 0, false, err
+	}
+
+	rows, err := stmt.(driver.StmtQueryContext).QueryContext(ctx, args(s.args...))
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+
+	dest := make([]driver.Value, len(rows.Columns()))
+	if err := rows.Next(dest); err == io.EOF {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+
+	val, ok := dest[0].(int64)
+	if !ok {
+		return 0, false, fmt.Errorf("%s: expected an integer, got %T", s.query, dest[0])
+	}
+	return val, true, nil
+}
+
+func (t rawTx) exec(ctx context.Context, s statement) (int64, error) {
+	return t.w.execOne(ctx, s)
+}
+
+// args converts values to the arguments the driver expects, ints become
+// int64 which is what database/sql would have converted them to. sql.Named
+// values keep their name.
+func args(values ...interface{}) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(values))
+	for i, v := range values {
+		var name string
+		if arg, ok := v.(sql.NamedArg); ok {
+			name, v = arg.Name, arg.Value
+		}
+		if n, ok := v.(int); ok {
+			v = int64(n)
+		}
+		named[i] = driver.NamedValue{Name: name, Ordinal: i + 1, Value: v}
+	}
+	return named
+}
+
+func (w *rawWorker) close() {
+	w.stmts.close()
+	w.conn.Close()
+}
+
+// workloadConn exposes a worker to a workloads.Workload
+type workloadConn struct {
+	w worker
+}
+
+func (c workloadConn) Query(ctx context.Context, s workloads.Statement, fn workloads.RowFunc) error {
+	return c.w.query(ctx, fromWorkload(s), rowFunc(fn))
+}
+
+func (c workloadConn) Exec(ctx context.Context, stmts ...workloads.Statement) (int64, error) {
+	converted := make([]statement, len(stmts))
+	for i, s := range stmts {
+		converted[i] = fromWorkload(s)
+	}
+	return c.w.exec(ctx, converted...)
+}
+
+func (c workloadConn) Tx(ctx context.Context, fn func(workloads.Tx) error) error {
+	return c.w.tx(ctx, func(tx txConn) error {
+		return fn(workloadTx{tx})
+	})
+}
+
+// workloadTx is the workloads.Tx for workloadConn
+type workloadTx struct {
+	tx txConn
+}
+
+func (t workloadTx) QueryInt(ctx context.Context, s workloads.Statement) (int64, bool, error) {
+	return t.tx.queryInt(ctx, fromWorkload(s))
+}
+
+func (t workloadTx) Exec(ctx context.Context, s workloads.Statement) (int64, error) {
+	return t.tx.exec(ctx, fromWorkload(s))
+}
+
+// asWorker turns a workloads.Conn back into a worker, so ops written against
+// workers can run on it
+func asWorker(c workloads.Conn) worker {
+	if wc, ok := c.(workloadConn); ok {
+		return wc.w
+	}
+	return connWorker{c}
+}
+
+// connWorker is the worker for a workloads.Conn that did not come from one
+type connWorker struct {
+	c workloads.Conn
+}
+
+func (w connWorker) query(ctx context.Context, s statement, fn rowFunc) error {
+	return w.c.Query(ctx, toWorkload(s), workloads.RowFunc(fn))
+}
+
+func (w connWorker) exec(ctx context.Context, stmts ...statement) (int64, error) {
+	converted := make([]workloads.Statement, len(stmts))
+	for i, s := range stmts {
+		converted[i] = toWorkload(s)
+	}
+	return w.c.Exec(ctx, converted...)
+}
+
+func (w connWorker) tx(ctx context.Context, fn func(txConn) error) error {
+	return w.c.Tx(ctx, func(tx workloads.Tx) error {
+		return fn(connTx{tx})
+	})
+}
+
+func (w connWorker) close() {}
+
+// connTx is the txConn for connWorker
+type connTx struct {
+	tx workloads.Tx
+}
+
+func (t connTx) queryInt(ctx context.Context, s statement) (int64, bool, error) {
+	return t.tx.QueryInt(ctx, toWorkload(s))
+}
+
+func (t connTx) exec(ctx context.Context, s statement) (int64, error) {
+	return t.tx.Exec(ctx, toWorkload(s))
+}
+
+func toWorkload(s statement) workloads.Statement {
+	return workloads.Statement{Query: s.query, Args: s.args}
+}
+
+func fromWorkload(s workloads.Statement) statement {
+	return statement{query: s.Query, args: s.Args}
+}
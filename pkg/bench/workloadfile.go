@@ -0,0 +1,198 @@
+package bench
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	// fileParam matches the named parameters a workload file statement can
+	// use: :id is an existing row, :new_id a new one and :value the value to
+	// write
+	fileParam = regexp.MustCompile(`[:@$](id|new_id|value)\b`)
+
+	// fileTemplate matches a {{func arg...}} placeholder
+	fileTemplate = regexp.MustCompile(`\{\{\s*(\w+)((?:\s+[^\s}]+)*)\s*\}\}`)
+)
+
+// paramFunc generates the value bound to a parameter for every execution
+type paramFunc func(keys *keySpace, val int, read bool) interface{}
+
+// fileStatement is one statement from a workload file and the parameters it
+// binds
+type fileStatement struct {
+	query  string
+	names  []string
+	params []paramFunc
+}
+
+// workloadFile is a -workload-file. CREATE statements are run once after the
+// test tables are made, readers cycle through the SELECTs and writers through
+// everything else.
+type workloadFile struct {
+	setup  []string
+	reads  []fileStatement
+	writes []fileStatement
+
+	// nextRead and nextWrite are advanced by every worker, so together they
+	// walk through the statements in order
+	nextRead  uint64
+	nextWrite uint64
+}
+
+// loadWorkloadFile reads path. Statements end with a ; at the end of a line,
+// lines starting with -- are comments. {{randint lo hi}} and {{randstring n}}
+// placeholders become parameters with a new random value for every execution.
+func loadWorkloadFile(path string) (*workloadFile, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &workloadFile{}
+	var current []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "--") {
+			continue
+		}
+		current = append(current, line)
+		if strings.HasSuffix(line, ";") {
+			if err := f.add(strings.TrimSuffix(strings.Join(current, " "), ";")); err != nil {
+				return nil, err
+			}
+			current = nil
+		}
+	}
+	if len(current) > 0 {
+		if err := f.add(strings.Join(current, " ")); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(f.reads) == 0 && len(f.writes) == 0 {
+		return nil, fmt.Errorf("%s has no statements to run", path)
+	}
+	return f, nil
+}
+
+// add sorts query into setup, reads or writes by its first keyword
+func (f *workloadFile) add(query string) error {
+	keyword := firstKeyword(query)
+	if keyword == "CREATE" {
+		f.setup = append(f.setup, query)
+		return nil
+	}
+
+	s := fileStatement{}
+	var err error
+	query = fileTemplate.ReplaceAllStringFunc(query, func(placeholder string) string {
+		match := fileTemplate.FindStringSubmatch(placeholder)
+		param, perr := templateParam(match[1], strings.Fields(match[2]))
+		if perr != nil {
+			err = fmt.Errorf("%s: %v", placeholder, perr)
+			return placeholder
+		}
+		name := "t" + strconv.Itoa(len(s.names))
+		s.names, s.params = append(s.names, name), append(s.params, param)
+		return ":" + name
+	})
+	if err != nil {
+		return err
+	}
+	s.query = query
+
+	seen := make(map[string]bool)
+	for _, match := range fileParam.FindAllStringSubmatch(query, -1) {
+		name := match[1]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		s.names, s.params = append(s.names, name), append(s.params, namedParam(name))
+	}
+
+	if keyword == "SELECT" || keyword == "WITH" {
+		f.reads = append(f.reads, s)
+	} else {
+		f.writes = append(f.writes, s)
+	}
+	return nil
+}
+
+// namedParam generates :id, :new_id and :value
+func namedParam(name string) paramFunc {
+	switch name {
+	case "id":
+		return func(keys *keySpace, val int, read bool) interface{} {
+			if read {
+				return keys.read()
+			}
+			return keys.existing()
+		}
+	case "new_id":
+		return func(keys *keySpace, val int, read bool) interface{} { return keys.next(1)[0] }
+	default:
+		return func(keys *keySpace, val int, read bool) interface{} { return val }
+	}
+}
+
+// templateParam generates the value of a {{fn args...}} placeholder
+func templateParam(fn string, args []string) (paramFunc, error) {
+	ints := make([]int, len(args))
+	for i, arg := range args {
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s expects integer arguments, got %q", fn, arg)
+		}
+		ints[i] = n
+	}
+
+	switch {
+	case fn == "randint" && len(ints) == 2 && ints[0] <= ints[1]:
+		lo, hi := ints[0], ints[1]
+		return func(*keySpace, int, bool) interface{} { return lo + random.Intn(hi-lo+1) }, nil
+	case fn == "randstring" && len(ints) == 1 && ints[0] >= 0:
+		n := ints[0]
+		return func(*keySpace, int, bool) interface{} {
+			b := make([]byte, n)
+			for i := range b {
+				b[i] = payloadLetters[random.Intn(len(payloadLetters))]
+			}
+			return string(b)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown template, expecting {{randint lo hi}} or {{randstring n}}")
+	}
+}
+
+// create runs the setup statements
+func (f *workloadFile) create(db *sql.DB) error {
+	for _, query := range f.setup {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("%s: %v", query, err)
+		}
+	}
+	return nil
+}
+
+// next returns the next read or write with its parameters bound
+func (f *workloadFile) next(read bool, keys *keySpace, val int) statement {
+	var s fileStatement
+	if read {
+		s = f.reads[(atomic.AddUint64(&f.nextRead, 1)-1)%uint64(len(f.reads))]
+	} else {
+		s = f.writes[(atomic.AddUint64(&f.nextWrite, 1)-1)%uint64(len(f.writes))]
+	}
+
+	stmt := statement{query: s.query}
+	for i, name := range s.names {
+		stmt.args = append(stmt.args, sql.Named(name, s.params[i](keys, val, read)))
+	}
+	return stmt
+}
@@ -0,0 +1,125 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// writeAmp counts the logical bytes the workload asked to write for
+// -write-amp, the values bound to its writing statements. Against the
+// bytes that reached the files it is the write amplification of a
+// configuration.
+type writeAmp struct {
+	logical int64
+
+	// io is nil where the process's counters can not be read
+	io *ioSampler
+}
+
+func newWriteAmp() *writeAmp {
+	io, _ := newIOSampler()
+	return &writeAmp{io: io}
+}
+
+// argSize is the number of bytes of one bound value
+func argSize(arg interface{}) int64 {
+	switch v := arg.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	default:
+		// integers, floats and times are stored in up to 8 bytes
+		return 8
+	}
+}
+
+func stmtSize(s statement) int64 {
+	var n int64
+	for _, arg := range s.args {
+		n += argSize(arg)
+	}
+	return n
+}
+
+// sizingWorker adds up the bound values of the statements that write
+// through worker. Reads leave bytes at 0, even the ones of a tx.
+type sizingWorker struct {
+	worker
+	bytes *int64
+}
+
+func (w sizingWorker) exec(ctx context.Context, stmts ...statement) (int64, error) {
+	for _, s := range stmts {
+		*w.bytes += stmtSize(s)
+	}
+	return w.worker.exec(ctx, stmts...)
+}
+
+func (w sizingWorker) tx(ctx context.Context, fn func(txConn) error) error {
+	return w.worker.tx(ctx, func(tx txConn) error {
+		return fn(sizingTx{tx, w.bytes})
+	})
+}
+
+// sizingTx adds up the statements run inside a sizingWorker's tx
+type sizingTx struct {
+	txConn
+	bytes *int64
+}
+
+func (t sizingTx) exec(ctx context.Context, s statement) (int64, error) {
+	*t.bytes += stmtSize(s)
+	return t.txConn.exec(ctx, s)
+}
+
+// add counts the bytes of a successful op
+func (a *writeAmp) add(bytes int64) {
+	atomic.AddInt64(&a.logical, bytes)
+}
+
+// reset starts counting from now, like after the warm up
+func (a *writeAmp) reset() {
+	atomic.StoreInt64(&a.logical, 0)
+	if a.io != nil {
+		a.io.reset()
+	}
+}
+
+// result is what was written since reset, the database file having grown
+// by growth
+func (a *writeAmp) result(growth int64) writeAmpResult {
+	r := writeAmpResult{logical: atomic.LoadInt64(&a.logical), growth: growth}
+	if a.io != nil {
+		io := a.io.result()
+		r.io = &io
+	}
+	return r
+}
+
+// writeAmpResult is the logical bytes written while measuring against the
+// physical ones, io is nil where the process's counters can not be read
+type writeAmpResult struct {
+	logical int64
+	io      *ioCounters
+	growth  int64
+}
+
+func (r writeAmpResult) print() {
+	factor := func(n int64) string {
+		if r.logical == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1fx", float64(n)/float64(r.logical))
+	}
+	line := fmt.Sprintf("Write amplification: %d logical bytes", r.logical)
+	if r.io != nil {
+		line += fmt.Sprintf(", %s written (%d), %s to storage (%d)", factor(r.io.writeChars), r.io.writeChars, factor(r.io.writeBytes), r.io.writeBytes)
+	}
+	fmt.Printf("%s, %s database growth (%d)\n", line, factor(r.growth), r.growth)
+}
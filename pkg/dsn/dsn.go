@@ -0,0 +1,175 @@
+// Package dsn builds go-sqlite3 data source names from a Config so the
+// connection options used by a test run live in one place.
+package dsn
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// uriPrefix starts every DSN, so go-sqlite3 hands it to sqlite as a URI
+const uriPrefix = "file:"
+
+const (
+	CacheShared  = "shared"
+	CachePrivate = "private"
+
+	TxLockDeferred  = "deferred"
+	TxLockImmediate = "immediate"
+	TxLockExclusive = "exclusive"
+
+	ModeReadOnly        = "ro"
+	ModeReadWrite       = "rw"
+	ModeReadWriteCreate = "rwc"
+	ModeMemory          = "memory"
+
+	// MutexNo opens connections with SQLITE_OPEN_NOMUTEX (multi-thread mode)
+	MutexNo = "no"
+	// MutexFull opens connections with SQLITE_OPEN_FULLMUTEX (serialized mode)
+	MutexFull = "full"
+
+	JournalDelete   = "DELETE"
+	JournalTruncate = "TRUNCATE"
+	JournalPersist  = "PERSIST"
+	JournalMemory   = "MEMORY"
+	JournalWAL      = "WAL"
+	JournalOff      = "OFF"
+)
+
+// Config describes how to open a sqlite3 database. Zero values leave the
+// corresponding option out of the DSN so sqlite / go-sqlite3 defaults apply.
+type Config struct {
+	// Filename is the database file, with or without a file: prefix. Its
+	// options belong in the other fields, a ? or # is part of the name.
+	Filename string
+
+	// Cache is the sqlite URI cache parameter: shared or private
+	Cache string
+
+	// TxLock is the go-sqlite3 BEGIN behaviour: deferred, immediate or exclusive
+	TxLock string
+
+	// BusyTimeout is how long sqlite will wait on a locked database before
+	// returning SQLITE_BUSY. It is rounded down to milliseconds.
+	BusyTimeout time.Duration
+
+	// Mode is the sqlite URI mode parameter: ro, rw, rwc or memory
+	Mode string
+
+	// Mutex is the go-sqlite3 threading mode open flag: no or full
+	Mutex string
+
+	// JournalMode is the go-sqlite3 journal mode every connection sets as it
+	// opens: DELETE, TRUNCATE, PERSIST, MEMORY, WAL or OFF. go-sqlite3 sets
+	// DELETE when it is left out, even on a database already in WAL mode.
+	JournalMode string
+
+	// Immutable tells sqlite the file can not change so it skips all locking.
+	// Only safe when nothing else writes to the database.
+	Immutable bool
+
+	// VFS is the sqlite URI vfs parameter, the name of a registered VFS to
+	// open the database with instead of the default one
+	VFS string
+}
+
+// Validate checks that every option in c has a value sqlite understands
+func (c Config) Validate() error {
+	if c.Filename == "" || c.Filename == uriPrefix {
+		return errors.New("dsn: filename is required")
+	}
+
+	if err := oneOf("cache", c.Cache, CacheShared, CachePrivate); err != nil {
+		return err
+	}
+	if err := oneOf("txlock", c.TxLock, TxLockDeferred, TxLockImmediate, TxLockExclusive); err != nil {
+		return err
+	}
+	if err := oneOf("mode", c.Mode, ModeReadOnly, ModeReadWrite, ModeReadWriteCreate, ModeMemory); err != nil {
+		return err
+	}
+	if err := oneOf("mutex", c.Mutex, MutexNo, MutexFull); err != nil {
+		return err
+	}
+	if err := oneOf("journal mode", c.JournalMode, JournalDelete, JournalTruncate, JournalPersist, JournalMemory, JournalWAL, JournalOff); err != nil {
+		return err
+	}
+
+	if c.BusyTimeout < 0 {
+		return fmt.Errorf("dsn: busy timeout must not be negative, got %s", c.BusyTimeout)
+	}
+
+	// an immutable database that can be written to is corrupted for every
+	// connection that trusted it not to change
+	if c.Immutable && c.Mode != ModeReadOnly {
+		return fmt.Errorf("dsn: immutable needs mode %s, got mode %q", ModeReadOnly, c.Mode)
+	}
+	if c.Mode == ModeMemory && c.VFS != "" {
+		return fmt.Errorf("dsn: mode %s keeps the database out of any vfs, got vfs %q", ModeMemory, c.VFS)
+	}
+
+	return nil
+}
+
+// BuildDSN validates c and returns a file: URI suitable for sql.Open("sqlite3", ...)
+func BuildDSN(c Config) (string, error) {
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	if c.Cache != "" {
+		params.Set("cache", c.Cache)
+	}
+	if c.Mode != "" {
+		params.Set("mode", c.Mode)
+	}
+	if c.Immutable {
+		params.Set("immutable", "1")
+	}
+	if c.VFS != "" {
+		params.Set("vfs", c.VFS)
+	}
+	if c.Mutex != "" {
+		params.Set("_mutex", c.Mutex)
+	}
+	if c.TxLock != "" {
+		params.Set("_txlock", c.TxLock)
+	}
+	if c.JournalMode != "" {
+		params.Set("_journal_mode", c.JournalMode)
+	}
+	if c.BusyTimeout > 0 {
+		params.Set("_busy_timeout", strconv.FormatInt(int64(c.BusyTimeout/time.Millisecond), 10))
+	}
+
+	dsn := uriPrefix + escapeFilename(strings.TrimPrefix(c.Filename, uriPrefix))
+	if len(params) > 0 {
+		dsn += "?" + params.Encode()
+	}
+
+	return dsn, nil
+}
+
+// oneOf returns an error if value is set and is not one of allowed
+func oneOf(name, value string, allowed ...string) error {
+	if value == "" {
+		return nil
+	}
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("dsn: invalid %s %q, expecting one of [%s]", name, value, strings.Join(allowed, ", "))
+}
+
+// escapeFilename escapes the characters that have a special meaning in a
+// sqlite URI filename
+func escapeFilename(filename string) string {
+	return strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(filename)
+}
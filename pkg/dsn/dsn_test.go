@@ -0,0 +1,100 @@
+package dsn
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEscapeFilename(t *testing.T) {
+	tests := []struct {
+		filename, want string
+	}{
+		{"test.db", "test.db"},
+		{"/tmp/dir/test.db", "/tmp/dir/test.db"},
+		{"what?.db", "what%3f.db"},
+		{"#1.db", "%231.db"},
+		{"100%.db", "100%25.db"},
+		{"a%3f?#.db", "a%253f%3f%23.db"},
+	}
+	for _, tt := range tests {
+		if got := escapeFilename(tt.filename); got != tt.want {
+			t.Errorf("escapeFilename(%q) = %q, want %q", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestBuildDSN(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{"filename only", Config{Filename: "test.db"}, "file:test.db"},
+		{"file prefix", Config{Filename: "file:test.db"}, "file:test.db"},
+		{"file prefix escaped", Config{Filename: "file:a?b.db"}, "file:a%3fb.db"},
+		{"cache shared", Config{Filename: "test.db", Cache: CacheShared}, "file:test.db?cache=shared"},
+		{"cache private", Config{Filename: "test.db", Cache: CachePrivate}, "file:test.db?cache=private"},
+		{"mode ro", Config{Filename: "test.db", Mode: ModeReadOnly}, "file:test.db?mode=ro"},
+		{"mode rw", Config{Filename: "test.db", Mode: ModeReadWrite}, "file:test.db?mode=rw"},
+		{"mode rwc", Config{Filename: "test.db", Mode: ModeReadWriteCreate}, "file:test.db?mode=rwc"},
+		{"mode memory", Config{Filename: "test.db", Mode: ModeMemory}, "file:test.db?mode=memory"},
+		{"immutable", Config{Filename: "test.db", Mode: ModeReadOnly, Immutable: true}, "file:test.db?immutable=1&mode=ro"},
+		{"txlock deferred", Config{Filename: "test.db", TxLock: TxLockDeferred}, "file:test.db?_txlock=deferred"},
+		{"txlock immediate", Config{Filename: "test.db", TxLock: TxLockImmediate}, "file:test.db?_txlock=immediate"},
+		{"txlock exclusive", Config{Filename: "test.db", TxLock: TxLockExclusive}, "file:test.db?_txlock=exclusive"},
+		{"mutex no", Config{Filename: "test.db", Mutex: MutexNo}, "file:test.db?_mutex=no"},
+		{"mutex full", Config{Filename: "test.db", Mutex: MutexFull}, "file:test.db?_mutex=full"},
+		{"vfs", Config{Filename: "test.db", VFS: "count_sync"}, "file:test.db?vfs=count_sync"},
+		{"journal mode wal", Config{Filename: "test.db", JournalMode: JournalWAL}, "file:test.db?_journal_mode=WAL"},
+		{"journal mode delete", Config{Filename: "test.db", JournalMode: JournalDelete}, "file:test.db?_journal_mode=DELETE"},
+		{"journal mode read only", Config{Filename: "test.db", Mode: ModeReadOnly, JournalMode: JournalWAL}, "file:test.db?_journal_mode=WAL&mode=ro"},
+		{"busy timeout", Config{Filename: "test.db", BusyTimeout: 1500 * time.Millisecond}, "file:test.db?_busy_timeout=1500"},
+		{"busy timeout rounded down", Config{Filename: "test.db", BusyTimeout: 2500 * time.Microsecond}, "file:test.db?_busy_timeout=2"},
+		{
+			"everything",
+			Config{Filename: "x.db", Cache: CacheShared, TxLock: TxLockImmediate, Mutex: MutexNo, Mode: ModeReadWriteCreate, BusyTimeout: time.Second},
+			"file:x.db?_busy_timeout=1000&_mutex=no&_txlock=immediate&cache=shared&mode=rwc",
+		},
+	}
+	for _, tt := range tests {
+		got, err := BuildDSN(tt.config)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		err    string
+	}{
+		{"no filename", Config{}, "filename is required"},
+		{"file prefix only", Config{Filename: "file:"}, "filename is required"},
+		{"cache", Config{Filename: "test.db", Cache: "shard"}, `invalid cache "shard"`},
+		{"txlock", Config{Filename: "test.db", TxLock: "IMMEDIATE"}, `invalid txlock "IMMEDIATE"`},
+		{"mode", Config{Filename: "test.db", Mode: "rx"}, `invalid mode "rx"`},
+		{"mutex", Config{Filename: "test.db", Mutex: "off"}, `invalid mutex "off"`},
+		{"journal mode", Config{Filename: "test.db", JournalMode: "wal"}, `invalid journal mode "wal"`},
+		{"busy timeout", Config{Filename: "test.db", BusyTimeout: -time.Second}, "busy timeout must not be negative"},
+		{"immutable without mode", Config{Filename: "test.db", Immutable: true}, "immutable needs mode ro"},
+		{"immutable rw", Config{Filename: "test.db", Mode: ModeReadWrite, Immutable: true}, "immutable needs mode ro"},
+		{"immutable memory", Config{Filename: "test.db", Mode: ModeMemory, Immutable: true}, "immutable needs mode ro"},
+		{"memory vfs", Config{Filename: "test.db", Mode: ModeMemory, VFS: "count_sync"}, "mode memory keeps the database out of any vfs"},
+	}
+	for _, tt := range tests {
+		err := tt.config.Validate()
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want one containing %q", tt.name, err, tt.err)
+		}
+		if _, err := BuildDSN(tt.config); err == nil {
+			t.Errorf("%s: BuildDSN accepted an invalid config", tt.name)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Package lockers holds the Go level locks a benchmark run can take around
+// every op, and the registry plugins add their own to.
+package lockers
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Locker is the Go level lock the runner takes around every op, the read
+// lock for reads and the write lock for everything else
+type Locker interface {
+	sync.Locker
+	RLock()
+	RUnlock()
+}
+
+// None leaves all locking to sqlite
+type None struct{}
+
+func (None) Lock()    {}
+func (None) Unlock()  {}
+func (None) RLock()   {}
+func (None) RUnlock() {}
+
+// Mutex meets the Locker interface but just uses sync.Mutex for everything
+type Mutex struct {
+	sync.Mutex
+}
+
+func (l *Mutex) RLock()   { l.Lock() }
+func (l *Mutex) RUnlock() { l.Unlock() }
+
+// Channel is a mutex made of a channel with room for one, to compare with
+// sync.Mutex. RLock and RUnlock take it like Lock and Unlock.
+type Channel chan struct{}
+
+// NewChannel returns an unlocked Channel
+func NewChannel() Channel {
+	return make(Channel, 1)
+}
+
+func (c Channel) Lock()    { c <- struct{}{} }
+func (c Channel) Unlock()  { <-c }
+func (c Channel) RLock()   { c.Lock() }
+func (c Channel) RUnlock() { c.Unlock() }
+
+var (
+	registryMu sync.Mutex
+	lockers    = make(map[string]func() Locker)
+)
+
+// Register makes a Locker available as -type name. It is meant to be called
+// from the init function of a plugin loaded with -plugin and panics if name
+// is registered twice.
+func Register(name string, newLocker func() Locker) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := lockers[name]; dup {
+		panic(fmt.Sprintf("lockers: Register called twice for locker %q", name))
+	}
+	lockers[name] = newLocker
+}
+
+// Lookup returns the Locker registered as name
+func Lookup(name string) (func() Locker, bool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	newLocker, ok := lockers[name]
+	return newLocker, ok
+}
+
+// Names returns the registered lockers, sorted
+func Names() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	var names []string
+	for name := range lockers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,98 @@
+package lockers
+
+import (
+	"sync"
+	"testing"
+)
+
+// count has n goroutines increment a counter under l, half of them taking
+// the read lock, and returns it
+func count(l Locker, n int) int {
+	var total int
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(read bool) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if read {
+					l.RLock()
+					total++
+					l.RUnlock()
+				} else {
+					l.Lock()
+					total++
+					l.Unlock()
+				}
+			}
+		}(i%2 == 0)
+	}
+	wg.Wait()
+	return total
+}
+
+func TestExclusive(t *testing.T) {
+	// Mutex and Channel take the read lock exclusively too, so even the
+	// readers' increments are never lost
+	tests := []struct {
+		name   string
+		locker Locker
+	}{
+		{"mutex", &Mutex{}},
+		{"channel", NewChannel()},
+	}
+	for _, tt := range tests {
+		if got := count(tt.locker, 8); got != 800 {
+			t.Errorf("%s: counted %d, want 800", tt.name, got)
+		}
+	}
+}
+
+func TestChannel(t *testing.T) {
+	c := NewChannel()
+	c.Lock()
+	if len(c) != 1 {
+		t.Errorf("locked channel holds %d, want 1", len(c))
+	}
+	c.Unlock()
+	c.RLock()
+	if len(c) != 1 {
+		t.Errorf("read locked channel holds %d, want 1", len(c))
+	}
+	c.RUnlock()
+	if len(c) != 0 {
+		t.Errorf("unlocked channel holds %d, want 0", len(c))
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	// an earlier run of the test with -count registered it already
+	if _, ok := Lookup("test-none"); !ok {
+		Register("test-none", func() Locker { return None{} })
+	}
+	newLocker, ok := Lookup("test-none")
+	if !ok {
+		t.Fatal("Lookup did not find the registered locker")
+	}
+	if _, ok := newLocker().(None); !ok {
+		t.Errorf("registered locker made a %T, want None", newLocker())
+	}
+	if _, ok := Lookup("test-missing"); ok {
+		t.Error("Lookup found a locker that was never registered")
+	}
+
+	found := false
+	for _, name := range Names() {
+		found = found || name == "test-none"
+	}
+	if !found {
+		t.Errorf("Names() = %v, want it to include test-none", Names())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering test-none twice did not panic")
+		}
+	}()
+	Register("test-none", func() Locker { return &Mutex{} })
+}
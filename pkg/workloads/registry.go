@@ -0,0 +1,47 @@
+package workloads
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory creates a workload for one run
+type Factory func() (Workload, error)
+
+var (
+	registryMu sync.Mutex
+	workloads  = make(map[string]Factory)
+)
+
+// Register makes a workload available as -workload name. It is meant to be
+// called from the init function of a plugin loaded with -plugin and panics
+// if name is registered twice.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := workloads[name]; dup {
+		panic(fmt.Sprintf("workloads: Register called twice for workload %q", name))
+	}
+	workloads[name] = factory
+}
+
+// Lookup returns the workload registered as name
+func Lookup(name string) (Factory, bool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	factory, ok := workloads[name]
+	return factory, ok
+}
+
+// Names returns the registered workloads, sorted
+func Names() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	var names []string
+	for name := range workloads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,67 @@
+package workloads
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+// nop is a workload that does nothing
+type nop struct{}
+
+func (nop) Setup(ctx context.Context, db *sql.DB) error { return nil }
+func (nop) ReadOp() Op                                  { return Op{Name: "read", Read: true} }
+func (nop) WriteOp() Op                                 { return Op{Name: "write"} }
+func (nop) Verify(ctx context.Context, c Conn) error    { return nil }
+
+// registerOnce registers factory as name unless an earlier run of the test
+// with -count did
+func registerOnce(name string, factory Factory) {
+	if _, ok := Lookup(name); !ok {
+		Register(name, factory)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registerOnce("test-nop", func() (Workload, error) { return nop{}, nil })
+	registerOnce("test-broken", func() (Workload, error) { return nil, errors.New("broken") })
+
+	factory, ok := Lookup("test-nop")
+	if !ok {
+		t.Fatal("Lookup did not find the registered workload")
+	}
+	w, err := factory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op := w.ReadOp(); op.Name != "read" || !op.Read {
+		t.Errorf("ReadOp() = %+v, want the registered workload's read op", op)
+	}
+
+	if factory, ok := Lookup("test-broken"); !ok {
+		t.Error("Lookup did not find the registered workload")
+	} else if _, err := factory(); err == nil {
+		t.Error("broken factory returned no error")
+	}
+	if _, ok := Lookup("test-missing"); ok {
+		t.Error("Lookup found a workload that was never registered")
+	}
+
+	var names []string
+	for _, name := range Names() {
+		if name == "test-broken" || name == "test-nop" {
+			names = append(names, name)
+		}
+	}
+	if len(names) != 2 || names[0] != "test-broken" {
+		t.Errorf("Names() = %v, want test-broken and test-nop in order", Names())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering test-nop twice did not panic")
+		}
+	}()
+	Register("test-nop", func() (Workload, error) { return nop{}, nil })
+}
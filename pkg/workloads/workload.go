@@ -0,0 +1,80 @@
+// Package workloads defines what readers and writers do during a test run, so
+// new workloads can be added without changing the runner. The runner handles
+// locking, retries, timing and reporting; a Workload only hands out the ops.
+package workloads
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrSkip is returned by Op.Run when there was nothing to do, like a queue
+// consumer finding the queue empty. The attempt is neither retried nor
+// counted as an op.
+var ErrSkip = errors.New("workloads: nothing to do")
+
+// Statement is a single SQL statement and its arguments
+type Statement struct {
+	Query string
+	Args  []interface{}
+}
+
+// RowFunc is called with the column values of each row a query returns
+type RowFunc func(row []interface{}) error
+
+// Conn is a single reader's or writer's handle on the database
+type Conn interface {
+	// Query runs a SELECT and passes each row to fn, a nil fn just drains
+	// the rows
+	Query(ctx context.Context, s Statement, fn RowFunc) error
+
+	// Exec runs stmts, more than one are wrapped in a transaction. It returns
+	// the total number of rows affected.
+	Exec(ctx context.Context, stmts ...Statement) (int64, error)
+
+	// Tx runs fn inside a transaction, it is committed if fn returns nil
+	Tx(ctx context.Context, fn func(Tx) error) error
+}
+
+// Tx runs statements inside a Conn's transaction
+type Tx interface {
+	// QueryInt returns the first column of the first row of s, found is
+	// false when there are no rows
+	QueryInt(ctx context.Context, s Statement) (val int64, found bool, err error)
+
+	// Exec runs s and returns the number of rows affected
+	Exec(ctx context.Context, s Statement) (int64, error)
+}
+
+// Op is one operation picked by a Workload. The runner takes the read lock
+// for Read ops and the write lock for everything else, then calls Run until
+// it succeeds.
+type Op struct {
+	// Name groups the op in the results, ie: read or update
+	Name string
+
+	Read bool
+
+	// Code is the ASCII art printed when the op succeeds, empty prints the
+	// runner's read or write code
+	Code string
+
+	// Run does one attempt at the op on c. Every attempt after a failure
+	// calls it again.
+	Run func(ctx context.Context, c Conn) error
+}
+
+// Workload is what a test run does
+type Workload interface {
+	// Setup creates and fills the tables before any reader or writer starts
+	Setup(ctx context.Context, db *sql.DB) error
+
+	// ReadOp returns the next op for a reader, WriteOp the next one for a
+	// writer. They are called from every reader and writer at once.
+	ReadOp() Op
+	WriteOp() Op
+
+	// Verify checks the database after the readers and writers are done
+	Verify(ctx context.Context, c Conn) error
+}